@@ -0,0 +1,51 @@
+package btree
+
+// maxFreeNodes bounds the free list so a tree that shrinks a lot doesn't
+// keep all of its old nodes alive
+const maxFreeNodes = 64
+
+// newNode returns an empty node, recycled from the free list when possible.
+// Slices are sized for one entry (and child) over the maximum so the
+// temporary overflow before a split never reallocates. Every node of the
+// tree must come from here, bulk builds and joins included, entries are
+// only ever appended to these slices so the capacity is kept.
+func (t *BTree[K, V]) newNode(leaf bool) *Node[K, V] {
+	var node *Node[K, V]
+	if n := len(t.free); n > 0 {
+		node = t.free[n-1]
+		t.free[n-1] = nil
+		t.free = t.free[:n-1]
+	} else {
+		node = &Node[K, V]{
+			keys:   make([]K, 0, t.maxEntries()+1),
+			values: make([]V, 0, t.maxEntries()+1),
+		}
+	}
+	if !leaf && node.children == nil {
+		node.children = make([]*Node[K, V], 0, t.maxChildren()+1)
+	}
+	return node
+}
+
+// freeNode hands a node that is no longer part of the tree to the free list.
+// Its slices are cleared so recycled nodes don't keep keys and values alive.
+func (t *BTree[K, V]) freeNode(node *Node[K, V]) {
+	if t.aug != nil {
+		t.aug.forget(node)
+	}
+	clear(node.keys)
+	clear(node.values)
+	clear(node.children)
+	*node = Node[K, V]{keys: node.keys[:0], values: node.values[:0], children: node.children[:0]}
+	if len(t.free) < maxFreeNodes {
+		t.free = append(t.free, node)
+	}
+}
+
+// forgetAll drops the aggregates of a subtree that is being replaced
+func (t *BTree[K, V]) forgetAll(node *Node[K, V]) {
+	t.aug.forget(node)
+	for _, child := range node.children {
+		t.forgetAll(child)
+	}
+}
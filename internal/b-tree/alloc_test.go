@@ -0,0 +1,81 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteRecyclesNodes(t *testing.T) {
+	tree := sequentialTree(3, 1, 65)
+	for i := 1; i <= 64; i++ {
+		assert.NoError(t, tree.Delete(i))
+	}
+	assert.NotEmpty(t, tree.free)
+	assert.LessOrEqual(t, len(tree.free), maxFreeNodes)
+	for _, node := range tree.free {
+		// recycled nodes must not keep anything from the tree alive
+		assert.Nil(t, node.parent)
+		assert.Empty(t, node.keys)
+		assert.Empty(t, node.values)
+		assert.Empty(t, node.children)
+		for _, child := range node.children[:cap(node.children)] {
+			assert.Nil(t, child)
+		}
+	}
+
+	// the tree keeps working on top of recycled nodes
+	free := len(tree.free)
+	for i := 1; i <= 64; i++ {
+		assert.NoError(t, tree.Put(i, i))
+	}
+	assert.Less(t, len(tree.free), free)
+	assertValidStructure(t, tree, tree.root)
+	for i := 1; i <= 64; i++ {
+		v, ok := tree.Get(i)
+		assert.True(t, ok)
+		assert.Equal(t, i, v)
+	}
+}
+
+// assertRoomForOverflow checks that every node can take the entry (and
+// child) over the maximum that a split removes
+func assertRoomForOverflow(t *testing.T, tree *BTree[int, int], node *Node[int, int]) {
+	assert.Equal(t, tree.maxEntries()+1, cap(node.keys))
+	assert.Equal(t, tree.maxEntries()+1, cap(node.values))
+	if !tree.isLeaf(node) {
+		assert.Equal(t, tree.maxChildren()+1, cap(node.children))
+	}
+	for _, child := range node.children {
+		assertRoomForOverflow(t, tree, child)
+	}
+}
+
+func TestNodesKeepRoomForOverflow(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		tree := sequentialTree(order, 0, 300)
+		r := rand.New(rand.NewSource(int64(order)))
+		for i := 0; i < 200; i++ {
+			tree.Delete(r.Intn(300))
+		}
+		assertRoomForOverflow(t, tree, tree.root)
+
+		// bulk built and joined trees, the join redistributes along the graft
+		left, right := tree.SplitAt(150)
+		assertRoomForOverflow(t, left, left.root)
+		assertRoomForOverflow(t, right, right.root)
+		bulk := NewBTree[int, int](order, cmpInt)
+		items := make([]Item[int, int], 0, 50)
+		for i := 1000; i < 1050; i++ {
+			items = append(items, Item[int, int]{Key: i, Value: i})
+		}
+		bulk.buildSorted(items)
+		assertRoomForOverflow(t, bulk, bulk.root)
+		joined, err := Join(right, bulk)
+		assert.NoError(t, err)
+		joined, err = Join(left, joined)
+		assert.NoError(t, err)
+		assertRoomForOverflow(t, joined, joined.root)
+	}
+}
@@ -0,0 +1,135 @@
+package btree
+
+import "fmt"
+
+// Monoid describes how to summarize a set of entries: Measure turns a single
+// entry into a summary and Combine merges two summaries. Combine must be
+// associative and Identity must not change what it is combined with, entries
+// are always combined in key order so Combine doesn't need to be commutative.
+type Monoid[K comparable, V any, A any] struct {
+	Identity A
+	Combine  func(a, b A) A
+	Measure  func(key K, value V) A
+}
+
+// Augmented is a BTree that caches the aggregate of the whole subtree of
+// every node, which lets Aggregate answer range queries visiting O(log n)
+// nodes instead of scanning the range. The aggregates are kept in a map next
+// to the tree rather than in Node, which has no type parameter for them.
+type Augmented[K comparable, V any, A any] struct {
+	*BTree[K, V]
+	monoid Monoid[K, V, A]
+	// aggregate of the subtree of every node, kept out of Node so plain
+	// trees don't pay for it. Trees cut from this one by SplitAt share it.
+	aggs map[*Node[K, V]]A
+}
+
+// augmenter is what a BTree needs from Augmented: refresh recomputes the
+// aggregate of a node from its entries and children and forget drops it
+// once the node is no longer part of the tree
+type augmenter[K comparable, V any] interface {
+	refresh(node *Node[K, V])
+	forget(node *Node[K, V])
+}
+
+// NewAugmented creates an augmented B-tree with the given degree
+func NewAugmented[K comparable, V any, A any](
+	order int,
+	less Comparator[K],
+	monoid Monoid[K, V, A],
+) *Augmented[K, V, A] {
+	a := &Augmented[K, V, A]{
+		BTree:  NewBTree[K, V](order, less),
+		monoid: monoid,
+		aggs:   map[*Node[K, V]]A{},
+	}
+	a.BTree.aug = a
+	return a
+}
+
+// Count is the monoid that counts entries, with it Aggregate gives the number
+// of keys in a range, which is all that is needed for order statistics
+func Count[K comparable, V any]() Monoid[K, V, int] {
+	return Monoid[K, V, int]{
+		Identity: 0,
+		Combine:  func(a, b int) int { return a + b },
+		Measure:  func(K, V) int { return 1 },
+	}
+}
+
+func (a *Augmented[K, V, A]) refresh(node *Node[K, V]) {
+	acc := a.monoid.Identity
+	for i := range node.keys {
+		if !a.isLeaf(node) {
+			acc = a.monoid.Combine(acc, a.aggOf(node.children[i]))
+		}
+		acc = a.monoid.Combine(acc, a.monoid.Measure(a.key(node, i), node.values[i]))
+	}
+	if !a.isLeaf(node) {
+		acc = a.monoid.Combine(acc, a.aggOf(node.children[len(node.children)-1]))
+	}
+	a.aggs[node] = acc
+}
+
+func (a *Augmented[K, V, A]) forget(node *Node[K, V]) {
+	delete(a.aggs, node)
+}
+
+// aggOf returns the cached aggregate of node. Every node of the tree has
+// one, a missing node would make every aggregate above it wrong without a
+// trace, so it panics instead of passing a zero A along.
+func (a *Augmented[K, V, A]) aggOf(node *Node[K, V]) A {
+	agg, ok := a.aggs[node]
+	if !ok {
+		panic(fmt.Errorf("%w: node without an aggregate", ErrInvariant))
+	}
+	return agg
+}
+
+// Total returns the aggregate of every entry in the tree
+func (a *Augmented[K, V, A]) Total() A {
+	if a.root == nil {
+		return a.monoid.Identity
+	}
+	return a.aggOf(a.root)
+}
+
+// Aggregate returns the aggregate of the entries with lo <= key <= hi
+func (a *Augmented[K, V, A]) Aggregate(lo, hi K) A {
+	if a.root == nil || a.Less(lo, hi) > 0 {
+		return a.monoid.Identity
+	}
+	return a.aggregate(a.root, lo, hi, false, false)
+}
+
+// aggregate folds the part of the subtree inside [lo, hi]. loFree and hiFree
+// tell that every key of the subtree is already known to be on the right side
+// of that bound, once both are true the cached aggregate is the answer.
+// Only the two children that straddle a bound are visited recursively.
+func (a *Augmented[K, V, A]) aggregate(node *Node[K, V], lo, hi K, loFree, hiFree bool) A {
+	if loFree && hiFree {
+		return a.aggOf(node)
+	}
+	acc := a.monoid.Identity
+	n := len(node.keys)
+	for i := 0; i <= n; i++ {
+		// child i holds the keys between keys[i-1] and keys[i]
+		if !a.isLeaf(node) {
+			below := !loFree && i < n && a.Less(a.key(node, i), lo) <= 0
+			above := !hiFree && i > 0 && a.Less(a.key(node, i-1), hi) >= 0
+			if !below && !above {
+				childLoFree := loFree || (i > 0 && a.Less(a.key(node, i-1), lo) >= 0)
+				childHiFree := hiFree || (i < n && a.Less(a.key(node, i), hi) <= 0)
+				acc = a.monoid.Combine(acc, a.aggregate(node.children[i], lo, hi, childLoFree, childHiFree))
+			}
+		}
+		if i == n {
+			break
+		}
+		key := a.key(node, i)
+		if (loFree || a.Less(key, lo) >= 0) && (hiFree || a.Less(key, hi) <= 0) {
+			acc = a.monoid.Combine(acc, a.monoid.Measure(key, node.values[i]))
+		}
+	}
+	return acc
+}
@@ -0,0 +1,145 @@
+package btree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sumMonoid() Monoid[int, int, int] {
+	return Monoid[int, int, int]{
+		Identity: 0,
+		Combine:  func(a, b int) int { return a + b },
+		Measure:  func(_ int, v int) int { return v },
+	}
+}
+
+func maxMonoid() Monoid[int, int, int] {
+	return Monoid[int, int, int]{
+		Identity: math.MinInt,
+		Combine:  func(a, b int) int { return max(a, b) },
+		Measure:  func(_ int, v int) int { return v },
+	}
+}
+
+// assertValidAggregates checks every cached aggregate against a fresh fold
+func assertValidAggregates[A any](t *testing.T, tree *Augmented[int, int, A], node *Node[int, int]) A {
+	acc := tree.monoid.Identity
+	for i, key := range node.keys {
+		if !tree.isLeaf(node) {
+			acc = tree.monoid.Combine(acc, assertValidAggregates(t, tree, node.children[i]))
+		}
+		acc = tree.monoid.Combine(acc, tree.monoid.Measure(key, node.values[i]))
+	}
+	if !tree.isLeaf(node) {
+		acc = tree.monoid.Combine(acc, assertValidAggregates(t, tree, node.children[len(node.children)-1]))
+	}
+	assert.Equal(t, acc, tree.aggs[node])
+	return acc
+}
+
+func TestAugmentedAgainstBruteForce(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		sum := NewAugmented[int, int, int](order, cmpInt, sumMonoid())
+		maximum := NewAugmented[int, int, int](order, cmpInt, maxMonoid())
+		expected := map[int]int{}
+		r := rand.New(rand.NewSource(int64(order)))
+
+		for i := 0; i < 3000; i++ {
+			key := r.Intn(200)
+			if r.Intn(3) == 0 {
+				sum.Delete(key)
+				maximum.Delete(key)
+				delete(expected, key)
+			} else {
+				value := r.Intn(1000) - 500
+				sum.Put(key, value)
+				maximum.Put(key, value)
+				expected[key] = value
+			}
+
+			if i%100 != 0 {
+				continue
+			}
+			if sum.root != nil && !sum.isEmpty() {
+				assertValidAggregates(t, sum, sum.root)
+				assertValidAggregates(t, maximum, maximum.root)
+			}
+			for q := 0; q < 20; q++ {
+				lo := r.Intn(220) - 10
+				hi := lo + r.Intn(100)
+				wantSum, wantMax := 0, math.MinInt
+				for k, v := range expected {
+					if k >= lo && k <= hi {
+						wantSum += v
+						wantMax = max(wantMax, v)
+					}
+				}
+				assert.Equal(t, wantSum, sum.Aggregate(lo, hi), "sum [%d, %d]", lo, hi)
+				assert.Equal(t, wantMax, maximum.Aggregate(lo, hi), "max [%d, %d]", lo, hi)
+			}
+		}
+	}
+}
+
+func TestAugmentedCount(t *testing.T) {
+	tree := NewAugmented[int, string](3, cmpInt, Count[int, string]())
+	assert.Equal(t, 0, tree.Total())
+	for i := 0; i < 100; i++ {
+		tree.Put(i*2, "")
+	}
+	assert.Equal(t, 100, tree.Total())
+	assert.Equal(t, 5, tree.Aggregate(10, 18))
+	assert.Equal(t, 0, tree.Aggregate(18, 10), "empty range")
+	// rank of a key is the count of everything before it
+	assert.Equal(t, 25, tree.Aggregate(math.MinInt, 49))
+
+	tree.Put(10, "updated") // replacing a value doesn't change the count
+	assert.Equal(t, 100, tree.Total())
+	tree.Delete(10)
+	assert.Equal(t, 4, tree.Aggregate(10, 18))
+}
+
+func countNodes(node *Node[int, int]) int {
+	n := 1
+	for _, child := range node.children {
+		n += countNodes(child)
+	}
+	return n
+}
+
+func TestAugmentedForgetsDroppedNodes(t *testing.T) {
+	tree := NewAugmented[int, int](3, cmpInt, sumMonoid())
+	for i := 0; i < 500; i++ {
+		tree.Put(i, i)
+	}
+	assert.Len(t, tree.aggs, countNodes(tree.root))
+	for i := 0; i < 400; i++ {
+		tree.Delete(i)
+	}
+	assert.Len(t, tree.aggs, countNodes(tree.root), "merged nodes are forgotten")
+
+	left, right := tree.SplitAt(450)
+	joined, err := Join(left, right)
+	assert.NoError(t, err)
+	tree.BTree = joined
+	assert.Len(t, tree.aggs, countNodes(tree.root), "nodes cut by the split are forgotten")
+	assertValidAggregates(t, tree, tree.root)
+
+	tree.buildSorted([]Item[int, int]{{Key: 1, Value: 1}, {Key: 2, Value: 2}})
+	assert.Len(t, tree.aggs, countNodes(tree.root), "a rebuilt tree forgets the old one")
+	assert.Equal(t, 3, tree.Total())
+}
+
+func TestAugmentedPanicsOnMissingAggregate(t *testing.T) {
+	tree := NewAugmented[int, int](3, cmpInt, maxMonoid())
+	for i := 0; i < 20; i++ {
+		tree.Put(i, i)
+	}
+	delete(tree.aggs, tree.root.children[0])
+	assert.PanicsWithError(t, "btree: invariant violated: node without an aggregate", func() {
+		tree.refresh(tree.root)
+	}, "a zero aggregate would have hidden the missing node")
+}
@@ -0,0 +1,424 @@
+package btree
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// every benchmark op works on a tree of benchItems thousand keys, run them
+// with -benchmem to see the allocations per op
+func benchKeys() []int {
+	return rand.New(rand.NewSource(1)).Perm(benchItems * 1024)
+}
+
+func BenchmarkPut(b *testing.B) {
+	keys := benchKeys()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree := NewBTree[int, int](32, cmpInt)
+		for _, k := range keys {
+			tree.Put(k, k)
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	keys := benchKeys()
+	tree := NewBTree[int, int](32, cmpInt)
+	for _, k := range keys {
+		tree.Put(k, k)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			tree.Get(k)
+		}
+	}
+}
+
+func BenchmarkPutDelete(b *testing.B) {
+	keys := benchKeys()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree := NewBTree[int, int](32, cmpInt)
+		for _, k := range keys {
+			tree.Put(k, k)
+		}
+		for _, k := range keys {
+			tree.Delete(k)
+		}
+	}
+}
+
+// BenchmarkChurn keeps the tree at a steady size, deleting a key for every
+// one inserted, so freed nodes can be reused by later splits
+func BenchmarkChurn(b *testing.B) {
+	keys := benchKeys()
+	tree := NewBTree[int, int](32, cmpInt)
+	for _, k := range keys {
+		tree.Put(k, k)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, k := range keys {
+			tree.Delete(k)
+			tree.Put(k+len(keys)*(i%2+1), j)
+		}
+		for _, k := range keys {
+			tree.Delete(k + len(keys)*(i%2+1))
+			tree.Put(k, k)
+		}
+	}
+}
+
+// The rest of the file compares the tree against itself at different orders
+// and against the usual alternatives, a map that gets sorted when order is
+// needed and a skip list. Names are workload/keys/impl so benchstat can
+// line them up:
+//
+//	go test -run XXX -bench 'Insert|Lookup|Delete|Mixed|Scan' -benchmem ./internal/b-tree
+//
+// Every op is a single key (or a scan of scanLength keys) on a map of
+// benchItems thousand entries.
+//
+// Picking an order: below 16 everything is 2-4x slower, the tree is tall and
+// every level is a cache miss. From 32 to 64 the curve is flat for point
+// operations, bigger orders only keep helping scans while deletes and random
+// string inserts get slower again from moving entries around in wide nodes.
+// 32 or 64 is the right default. A map beats the tree at point operations by
+// ~10x but sorting makes it useless for scans once there are writes, the
+// skip list is slower than an order 32 tree at everything.
+
+var benchOrders = []int{3, 4, 8, 16, 32, 64, 128, 256}
+
+const scanLength = 100
+
+// orderedMap is what every implementation has to offer to be benchmarked
+type orderedMap[K cmp.Ordered] interface {
+	Put(key K, value int)
+	Get(key K) (int, bool)
+	Delete(key K)
+	// Scan visits up to n entries starting at lo
+	Scan(lo K, n int) int
+}
+
+type benchTree[K cmp.Ordered] struct{ *BTree[K, int] }
+
+func (b benchTree[K]) Put(key K, value int) { b.BTree.Put(key, value) }
+func (b benchTree[K]) Delete(key K)         { b.BTree.Delete(key) }
+
+func (b benchTree[K]) Scan(lo K, n int) int {
+	seen := 0
+	if b.root != nil {
+		b.walkFrom(b.root, lo, func(K, int) bool {
+			seen++
+			return seen < n
+		})
+	}
+	return seen
+}
+
+// mapSort is a plain map, order is only paid for when scanning, by sorting
+// the keys again if the map changed since the last scan
+type mapSort[K cmp.Ordered] struct {
+	m      map[K]int
+	sorted []K
+	dirty  bool
+}
+
+func (m *mapSort[K]) Put(key K, value int) {
+	if _, ok := m.m[key]; !ok {
+		m.dirty = true
+	}
+	m.m[key] = value
+}
+
+func (m *mapSort[K]) Get(key K) (int, bool) {
+	v, ok := m.m[key]
+	return v, ok
+}
+
+func (m *mapSort[K]) Delete(key K) {
+	if _, ok := m.m[key]; ok {
+		delete(m.m, key)
+		m.dirty = true
+	}
+}
+
+func (m *mapSort[K]) Scan(lo K, n int) int {
+	if m.dirty {
+		m.sorted = slices.Sorted(maps.Keys(m.m))
+		m.dirty = false
+	}
+	i, _ := slices.BinarySearch(m.sorted, lo)
+	seen := 0
+	for ; i < len(m.sorted) && seen < n; i++ {
+		_ = m.m[m.sorted[i]]
+		seen++
+	}
+	return seen
+}
+
+type benchSkipList[K cmp.Ordered] struct{ *skipList[K, int] }
+
+func (s benchSkipList[K]) Scan(lo K, n int) int {
+	seen := 0
+	s.ascend(lo, func(K, int) bool {
+		seen++
+		return seen < n
+	})
+	return seen
+}
+
+type benchImpl[K cmp.Ordered] struct {
+	name string
+	new  func() orderedMap[K]
+}
+
+func benchImpls[K cmp.Ordered]() []benchImpl[K] {
+	var impls []benchImpl[K]
+	for _, order := range benchOrders {
+		impls = append(impls, benchImpl[K]{
+			name: fmt.Sprintf("btree-%03d", order),
+			new:  func() orderedMap[K] { return benchTree[K]{NewBTree[K, int](order, cmp.Compare[K])} },
+		})
+	}
+	return append(impls,
+		benchImpl[K]{"map+sort", func() orderedMap[K] { return &mapSort[K]{m: map[K]int{}} }},
+		benchImpl[K]{"skiplist", func() orderedMap[K] { return benchSkipList[K]{newSkipList[K, int](cmp.Compare[K])} }},
+	)
+}
+
+// workloads generate the keys to insert, zipfian repeats a few hot keys a lot
+// so most of its puts are updates
+var workloads = []struct {
+	name string
+	keys func(n int) []int
+}{
+	{"sequential", func(n int) []int {
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = i
+		}
+		return keys
+	}},
+	{"random", func(n int) []int { return rand.New(rand.NewSource(1)).Perm(n) }},
+	{"zipfian", func(n int) []int {
+		z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, uint64(n-1))
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = int(z.Uint64())
+		}
+		return keys
+	}},
+}
+
+// stringKeys pads the numbers so both key types sort the same way
+func stringKeys(ints []int) []string {
+	keys := make([]string, len(ints))
+	for i, k := range ints {
+		keys[i] = fmt.Sprintf("key-%010d", k)
+	}
+	return keys
+}
+
+// runKeyTypes runs bench once with int keys and once with string keys
+func runKeyTypes(b *testing.B, ints []int, bench func(b *testing.B, ints []int, strs []string)) {
+	b.Run("int", func(b *testing.B) { bench(b, ints, nil) })
+	b.Run("string", func(b *testing.B) { bench(b, nil, stringKeys(ints)) })
+}
+
+func eachImpl[K cmp.Ordered](b *testing.B, keys []K, bench func(b *testing.B, impl benchImpl[K], keys []K)) {
+	for _, impl := range benchImpls[K]() {
+		b.Run(impl.name, func(b *testing.B) {
+			b.ReportAllocs()
+			bench(b, impl, keys)
+		})
+	}
+}
+
+func filled[K cmp.Ordered](impl benchImpl[K], keys []K) orderedMap[K] {
+	m := impl.new()
+	for i, k := range keys {
+		m.Put(k, i)
+	}
+	return m
+}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, w := range workloads {
+		b.Run(w.name, func(b *testing.B) {
+			runKeyTypes(b, w.keys(benchItems*1024), func(b *testing.B, ints []int, strs []string) {
+				if ints != nil {
+					eachImpl(b, ints, benchInsert[int])
+				} else {
+					eachImpl(b, strs, benchInsert[string])
+				}
+			})
+		})
+	}
+}
+
+// benchInsert starts over with an empty map every time all keys went in
+func benchInsert[K cmp.Ordered](b *testing.B, impl benchImpl[K], keys []K) {
+	m := impl.new()
+	for i := 0; i < b.N; i++ {
+		j := i % len(keys)
+		if j == 0 && i > 0 {
+			b.StopTimer()
+			m = impl.new()
+			b.StartTimer()
+		}
+		m.Put(keys[j], i)
+	}
+}
+
+func BenchmarkLookup(b *testing.B) {
+	runKeyTypes(b, benchKeys(), func(b *testing.B, ints []int, strs []string) {
+		if ints != nil {
+			eachImpl(b, ints, benchLookup[int])
+		} else {
+			eachImpl(b, strs, benchLookup[string])
+		}
+	})
+}
+
+func benchLookup[K cmp.Ordered](b *testing.B, impl benchImpl[K], keys []K) {
+	m := filled(impl, keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(keys[(i*7919)%len(keys)]) // hop around instead of the insert order
+	}
+}
+
+func BenchmarkDelete(b *testing.B) {
+	runKeyTypes(b, benchKeys(), func(b *testing.B, ints []int, strs []string) {
+		if ints != nil {
+			eachImpl(b, ints, benchDelete[int])
+		} else {
+			eachImpl(b, strs, benchDelete[string])
+		}
+	})
+}
+
+// benchDelete refills the map every time it runs out of keys
+func benchDelete[K cmp.Ordered](b *testing.B, impl benchImpl[K], keys []K) {
+	m := filled(impl, keys)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := (i * 7919) % len(keys)
+		if i%len(keys) == 0 && i > 0 {
+			b.StopTimer()
+			m = filled(impl, keys)
+			b.StartTimer()
+		}
+		m.Delete(keys[j])
+	}
+}
+
+// BenchmarkMixed keeps half of the keys in the map and runs reads among
+// writes, a write either puts or deletes a random key
+func BenchmarkMixed(b *testing.B) {
+	for _, reads := range []int{50, 90, 99} {
+		b.Run(fmt.Sprintf("reads=%d%%", reads), func(b *testing.B) {
+			runKeyTypes(b, benchKeys(), func(b *testing.B, ints []int, strs []string) {
+				if ints != nil {
+					eachImpl(b, ints, mixed[int](reads))
+				} else {
+					eachImpl(b, strs, mixed[string](reads))
+				}
+			})
+		})
+	}
+}
+
+func mixed[K cmp.Ordered](reads int) func(b *testing.B, impl benchImpl[K], keys []K) {
+	return func(b *testing.B, impl benchImpl[K], keys []K) {
+		// roll the dice before the timer starts
+		rng := rand.New(rand.NewSource(1))
+		ops := make([]int, 4096)
+		for i := range ops {
+			ops[i] = rng.Intn(100)
+		}
+		m := filled(impl, keys[:len(keys)/2])
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			key := keys[(i*7919)%len(keys)]
+			switch op := ops[i%len(ops)]; {
+			case op < reads:
+				m.Get(key)
+			case op%2 == 0:
+				m.Put(key, i)
+			default:
+				m.Delete(key)
+			}
+		}
+	}
+}
+
+// BenchmarkScan reads scanLength entries in order from a random key, after
+// every scan one key is overwritten or, with writes, inserted again so
+// map+sort pays for sorting as it would in a real mixed workload
+func BenchmarkScan(b *testing.B) {
+	for _, writes := range []bool{false, true} {
+		b.Run(fmt.Sprintf("writes=%t", writes), func(b *testing.B) {
+			runKeyTypes(b, benchKeys(), func(b *testing.B, ints []int, strs []string) {
+				if ints != nil {
+					eachImpl(b, ints, scan[int](writes))
+				} else {
+					eachImpl(b, strs, scan[string](writes))
+				}
+			})
+		})
+	}
+}
+
+func scan[K cmp.Ordered](writes bool) func(b *testing.B, impl benchImpl[K], keys []K) {
+	return func(b *testing.B, impl benchImpl[K], keys []K) {
+		m := filled(impl, keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			key := keys[(i*7919)%len(keys)]
+			m.Scan(key, scanLength)
+			if writes {
+				m.Delete(key)
+				m.Put(key, i)
+			}
+		}
+	}
+}
+
+// BenchmarkSearch looks up every key of the map with each in-node search,
+// it's what DefaultLinearMax was picked from
+func BenchmarkSearch(b *testing.B) {
+	keys := benchKeys()
+	searches := []struct {
+		name   string
+		search Search[int]
+	}{
+		{"binary", BinarySearch[int]},
+		{"linear", LinearSearch[int]},
+		{"interpolation", InterpolationSearch[int]},
+		{"auto", AutoSearch[int](DefaultLinearMax)},
+	}
+	for _, order := range benchOrders {
+		tree := NewBTree[int, int](order, cmpInt)
+		for _, k := range keys {
+			tree.Put(k, k)
+		}
+		for _, s := range searches {
+			b.Run(fmt.Sprintf("order=%03d/%s", order, s.name), func(b *testing.B) {
+				tree.SetSearch(s.search)
+				for i := 0; i < b.N; i++ {
+					tree.Get(keys[(i*7919)%len(keys)])
+				}
+			})
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package btree
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"slices"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+)
 
 // Why B-Tree
 // 1. keeps keys in sorted order for sequential traversing
@@ -8,11 +15,16 @@ import "fmt"
 // 4. uses partially full blocks to speed up insertions and deletions
 // 5. keeps the index balanced with a recursive algorithm
 
-// Node is a single element within the tree
+// Node is a single element within the tree. Keys and values live in two
+// parallel slices, searching a node only touches the keys and they sit next
+// to each other in memory.
 type Node[K comparable, V any] struct {
 	parent   *Node[K, V]   // this will be helpfull
-	entries  []*Item[K, V] // Sorted array of keys
+	keys     []K           // Sorted array of keys
+	values   []V           // values[i] is the value of keys[i]
 	children []*Node[K, V] // Array of child pointers
+	count    int           // number of entries in the whole subtree
+	prefix   K             // shared by every key, which only keeps the rest, see prefix.go
 }
 
 // Entry represents the key-value pair contained within nodes
@@ -21,37 +33,156 @@ type Item[K comparable, V any] struct {
 	Value V
 }
 
+// helpers to move entries around keeping keys and values in step. When the
+// tree compresses keys they also keep the prefix of the node, see prefix.go
+
+// key returns the whole key i of the node
+func (t *BTree[K, V]) key(n *Node[K, V], i int) K {
+	if t.prefixes == nil {
+		return n.keys[i]
+	}
+	return t.prefixes.concat(n.prefix, n.keys[i])
+}
+
+func (t *BTree[K, V]) item(n *Node[K, V], i int) Item[K, V] {
+	return Item[K, V]{Key: t.key(n, i), Value: n.values[i]}
+}
+
+func (t *BTree[K, V]) setItem(n *Node[K, V], i int, item Item[K, V]) {
+	if t.prefixes == nil {
+		n.keys[i], n.values[i] = item.Key, item.Value
+		return
+	}
+	n.keys[i], n.values[i] = t.suffix(n, item.Key), item.Value
+	if i == 0 || i == len(n.keys)-1 {
+		t.growPrefix(n)
+	}
+}
+
+func (t *BTree[K, V]) insertItem(n *Node[K, V], i int, item Item[K, V]) {
+	key := item.Key
+	if t.prefixes != nil {
+		key = t.suffix(n, key)
+	}
+	n.keys = slices.Insert(n.keys, i, key)
+	n.values = slices.Insert(n.values, i, item.Value)
+}
+
+func (t *BTree[K, V]) appendItem(n *Node[K, V], item Item[K, V]) {
+	t.insertItem(n, len(n.keys), item)
+}
+
+// appendRange appends the entries from i to j of src
+func (t *BTree[K, V]) appendRange(n, src *Node[K, V], i, j int) {
+	if t.prefixes == nil {
+		n.keys = append(n.keys, src.keys[i:j]...)
+		n.values = append(n.values, src.values[i:j]...)
+		return
+	}
+	for ; i < j; i++ {
+		t.appendItem(n, t.item(src, i))
+	}
+}
+
+func (t *BTree[K, V]) deleteItems(n *Node[K, V], i, j int) {
+	last := len(n.keys)
+	n.keys = slices.Delete(n.keys, i, j)
+	n.values = slices.Delete(n.values, i, j)
+	if t.prefixes != nil && (i == 0 || j == last) {
+		t.growPrefix(n)
+	}
+}
+
+// truncate drops the entries from i on, clearing them so they can be freed
+func (t *BTree[K, V]) truncate(n *Node[K, V], i int) {
+	clear(n.keys[i:])
+	clear(n.values[i:])
+	n.keys, n.values = n.keys[:i], n.values[:i]
+	if t.prefixes != nil {
+		t.growPrefix(n)
+	}
+}
+
 // definition of Btree structure
 type BTree[K comparable, V any] struct {
 	root  *Node[K, V] // root node of the B-Tree
 	order int         // Minimum degree (minimum number of keys) of the B-tree
-	less  funcCmp[K]
+	less  Comparator[K]
 	size  int
+
+	// search finds a key among the keys of a node, see SetSearch
+	search Search[K]
+
+	// callbacks registered by OnInsert, OnUpdate, OnDelete and Watch
+	hooks *hooks[K, V]
+
+	// codecs used by WriteTo and ReadFrom, see SetCodecs
+	keyCodec   codec.Codec[K]
+	valueCodec codec.Codec[V]
+
+	// keeps the aggregate of every node, nil unless the tree is augmented
+	aug augmenter[K, V]
+
+	// strips the prefix shared by the keys of every node, nil unless the tree
+	// was created by NewPrefixCompressed
+	prefixes prefixer[K]
+
+	counters Counters
+
+	// nodes released by merges, reused before allocating new ones
+	free []*Node[K, V]
 }
 
 // NewBTree creates a new B-tree with the given degree
-func NewBTree[K comparable, V any](order int, less funcCmp[K]) *BTree[K, V] {
-	if order < 2 {
+func NewBTree[K comparable, V any](order int, less Comparator[K]) *BTree[K, V] {
+	if order < 3 {
 		panic("Invalid degree, should be at least 3")
 	}
 	tree := new(BTree[K, V])
 	tree.less = less
 	tree.order = order
+	tree.search = AutoSearch[K](DefaultLinearMax)
 	return tree
 }
 
+// NewOrdered creates a B-tree over keys with a natural order, such as numbers
+// and strings, compared with cmp.Compare
+func NewOrdered[K cmp.Ordered, V any](order int) *BTree[K, V] {
+	return NewBTree[K, V](order, cmp.Compare[K])
+}
+
+// NewBTreeLess creates a B-tree ordered by a less function, see FromLess
+func NewBTreeLess[K comparable, V any](order int, less func(a, b K) bool) *BTree[K, V] {
+	return NewBTree[K, V](order, FromLess(less))
+}
+
 // SET OF HELPER FUNCITONS
 
-// funcCmp determines how to order a type K
-// Comparability: The keys must support comparison operations (e.g., <, <=, =, >, >=).
-type funcCmp[K comparable] func(K, K) int
+// Comparator determines how to order a type K, it returns a negative number
+// when a sorts before b, a positive one when it sorts after and 0 for equal
+// keys, like cmp.Compare
+type Comparator[K any] func(a, b K) int
+
+// FromLess turns a less function, as used by sort.Slice, into a Comparator.
+// It takes up to two calls to less per comparison.
+func FromLess[K any](less func(a, b K) bool) Comparator[K] {
+	return func(a, b K) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	}
+}
 
 func (t *BTree[K, V]) isLeaf(node *Node[K, V]) bool {
 	return len(node.children) == 0
 }
 
 func (t *BTree[K, V]) shouldSplit(node *Node[K, V]) bool {
-	return len(node.entries) > t.maxEntries()
+	return len(node.keys) > t.maxEntries()
 }
 
 func (t *BTree[K, V]) maxChildren() int {
@@ -78,41 +209,49 @@ func (t *BTree[K, V]) isEmpty() bool {
 	return t.size == 0
 }
 
+// Len returns the number of entries stored in the tree
+func (t *BTree[K, V]) Len() int {
+	return t.size
+}
+
 // Less is a convinience function that perfomrs comparsion between two items
 // using hte same "less" function provided to New
 func (t *BTree[K, V]) Less(a, b K) int {
 	return t.less(a, b)
 }
 
-// helper function to avoid repetive code, the goal is search the index where the key is stored, also use a binary search to perform o(log n) searches
+// helper function to avoid repetive code, the goal is search the index where the key is stored, using the search strategy of the tree (see SetSearch)
 // and return the correct index and a boolean to indicate that it was found
 // in case that the key is not there we return that is not found and the right place where it should be placed
 func (t *BTree[K, V]) searchKeyIndex(node *Node[K, V], key K) (index int, found bool) {
-	low, high := 0, len(node.entries)-1
-	var mid int
-	for low <= high {
-		mid = (high + low) / 2
-		if t.Less(key, node.entries[mid].Key) == 0 {
-			return mid, true
-		} else if t.Less(key, node.entries[mid].Key) > 0 {
-			low = mid + 1
-		} else {
-			high = mid - 1
-		}
+	if t.prefixes != nil {
+		return t.searchSuffix(node, key)
 	}
-	return low, false
+	return t.search(node.keys, key, t.less)
 }
 
-func (t *BTree[K, V]) Put(key K, value V) {
-	entry := &Item[K, V]{Key: key, Value: value}
+// Put inserts the key or replaces its value if it is already in the tree
+func (t *BTree[K, V]) Put(key K, value V) error {
+	entry := Item[K, V]{Key: key, Value: value}
 	if t.root == nil { // empty tree
-		t.root = &Node[K, V]{entries: []*Item[K, V]{entry}, children: []*Node[K, V]{}}
+		t.root = t.newNode(true)
+		t.appendItem(t.root, entry)
+		t.fixUp(t.root)
 		t.size++
-		return
+		t.hooks.inserted(key, value)
+		return nil
+	}
+	old, replaced, err := t.insert(t.root, entry)
+	if err != nil {
+		return err
 	}
-	if t.insert(t.root, entry) {
+	if replaced {
+		t.hooks.updated(key, old, value)
+	} else {
 		t.size++
+		t.hooks.inserted(key, value)
 	}
+	return nil
 }
 
 //	1.When inserting into a leaf node,
@@ -120,52 +259,55 @@ func (t *BTree[K, V]) Put(key K, value V) {
 //	2.When inserting into an internal node,
 //	  we need to traverse down to a leaf node where the actual insertion will occur.
 
-// TODO
-// 1. insertLeaf method
-// 2. insertInternal method
-func (t *BTree[K, V]) insert(node *Node[K, V], entry *Item[K, V]) bool {
+// insert returns the previous value when the key was already there
+func (t *BTree[K, V]) insert(node *Node[K, V], entry Item[K, V]) (old V, replaced bool, err error) {
 	if t.isLeaf(node) {
-		return t.insertLeaf(node, entry)
+		old, replaced = t.insertLeaf(node, entry)
+		return old, replaced, nil
 	}
 	return t.insertInternal(node, entry)
 }
 
-func (t *BTree[K, V]) insertInternal(node *Node[K, V], entry *Item[K, V]) bool {
+func (t *BTree[K, V]) insertInternal(node *Node[K, V], entry Item[K, V]) (old V, replaced bool, err error) {
 	insertIndex, found := t.searchKeyIndex(node, entry.Key)
 	if found {
-		node.entries[insertIndex] = entry
-		return false
+		old = node.values[insertIndex]
+		t.setItem(node, insertIndex, entry)
+		t.fixUp(node)
+		return old, true, nil
 	}
 	if insertIndex >= len(node.children) {
-		fmt.Printf(
-			"insert index:%d,len of node children slice = %d\n",
+		return old, false, fmt.Errorf(
+			"%w: insert index %d but node has %d children",
+			ErrInvariant,
 			insertIndex,
 			len(node.children),
 		)
-		panic("insertIndex equals len of node children slice")
 	}
 	return t.insert(node.children[insertIndex], entry)
 }
 
-func (t *BTree[K, V]) insertLeaf(node *Node[K, V], entry *Item[K, V]) bool {
+func (t *BTree[K, V]) insertLeaf(node *Node[K, V], entry Item[K, V]) (old V, replaced bool) {
 	insertIndex, found := t.searchKeyIndex(node, entry.Key)
 	if found { // this is for the case when we change the value for an exisiting key
-		node.entries[insertIndex] = entry
-		return false
+		old = node.values[insertIndex]
+		t.setItem(node, insertIndex, entry)
+		t.fixUp(node)
+		return old, true
 	}
-	// Expand the slice to make space for the new entry
-	node.entries = append(node.entries, nil)
-	copy(node.entries[insertIndex+1:], node.entries[insertIndex:])
-	node.entries[insertIndex] = entry
+	// nodes are allocated with room for one entry over the maximum, so this
+	// never reallocates, the split below brings the node back in bounds
+	t.insertItem(node, insertIndex, entry)
 
 	// we need to check if after insertion is split and rebalacing needed
 	t.split(node)
 
-	return true
+	return old, false
 }
 
 func (t *BTree[K, V]) split(node *Node[K, V]) {
 	if !t.shouldSplit(node) {
+		t.fixUp(node)
 		return
 	}
 	if node == t.root {
@@ -175,68 +317,79 @@ func (t *BTree[K, V]) split(node *Node[K, V]) {
 	}
 }
 
-func (t *BTree[K, V]) splitNonRoot(node *Node[K, V]) {
+// splitOff keeps the left half of an overflowing node in place and moves the
+// right half to a new node, it returns the middle entry that has to go up
+func (t *BTree[K, V]) splitOff(node *Node[K, V]) (Item[K, V], *Node[K, V]) {
+	t.counters.Splits++
 	middle := t.middle()
-	parent := node.parent
+	median := t.item(node, middle)
 
-	left := &Node[K, V]{
-		entries: append([]*Item[K, V](nil), node.entries[:middle]...),
-		parent:  parent,
-	}
-	right := &Node[K, V]{
-		entries: append([]*Item[K, V](nil), node.entries[middle+1:]...),
-		parent:  parent,
-	}
+	right := t.newNode(t.isLeaf(node))
+	t.appendRange(right, node, middle+1, len(node.keys))
+	t.truncate(node, middle)
 
-	// Move children from the node to be split into left and right nodes
+	// Move children from the node to be split into the right node
 	if !t.isLeaf(node) {
-		left.children = append([]*Node[K, V](nil), node.children[:middle+1]...)
-		right.children = append([]*Node[K, V](nil), node.children[middle+1:]...)
-		setParent(left.children, left)
+		right.children = append(right.children, node.children[middle+1:]...)
+		clear(node.children[middle+1:])
+		node.children = node.children[:middle+1]
 		setParent(right.children, right)
 	}
+	return median, right
+}
 
-	insertPosition, _ := t.searchKeyIndex(parent, node.entries[middle].Key)
-
-	// Insert middle key into parent
-	parent.entries = append(parent.entries, nil)
-	copy(parent.entries[insertPosition+1:], parent.entries[insertPosition:])
-	parent.entries[insertPosition] = node.entries[middle]
-
-	// Set child left of inserted key in parent to the created left node
-	parent.children[insertPosition] = left
+func (t *BTree[K, V]) splitNonRoot(node *Node[K, V]) {
+	parent := node.parent
+	median, right := t.splitOff(node)
+	right.parent = parent
 
-	// Set child right of inserted key in parent to the created right node
-	parent.children = append(parent.children, nil)
-	copy(parent.children[insertPosition+2:], parent.children[insertPosition+1:])
-	parent.children[insertPosition+1] = right
+	// Insert middle key into parent, node stays as the child left of it and
+	// right goes next to it
+	insertPosition, _ := t.searchKeyIndex(parent, median.Key)
+	t.insertItem(parent, insertPosition, median)
+	parent.children = slices.Insert(parent.children, insertPosition+1, right)
 
+	t.refreshNode(node)
+	t.refreshNode(right)
 	t.split(parent)
 }
 
 func (t *BTree[K, V]) splitRoot() {
-	middle := t.middle()
-
-	left := &Node[K, V]{entries: append([]*Item[K, V](nil), t.root.entries[:middle]...)}
-	right := &Node[K, V]{entries: append([]*Item[K, V](nil), t.root.entries[middle+1:]...)}
-
-	// Move children from the node to be split into left and right nodes
-	if !t.isLeaf(t.root) {
-		left.children = append([]*Node[K, V](nil), t.root.children[:middle+1]...)
-		right.children = append([]*Node[K, V](nil), t.root.children[middle+1:]...)
-		setParent(left.children, left)
-		setParent(right.children, right)
-	}
+	left := t.root
+	median, right := t.splitOff(left)
 
 	// Root is a node with one entry and two children (left and right)
-	newRoot := &Node[K, V]{
-		entries:  []*Item[K, V]{t.root.entries[middle]},
-		children: []*Node[K, V]{left, right},
-	}
+	newRoot := t.newNode(false)
+	t.appendItem(newRoot, median)
+	newRoot.children = append(newRoot.children, left, right)
 
 	left.parent = newRoot
 	right.parent = newRoot
 	t.root = newRoot
+
+	t.refreshNode(left)
+	t.refreshNode(right)
+	t.refreshNode(newRoot)
+}
+
+// refreshNode recomputes the cached data (subtree count and aggregate) of a
+// single node from its entries and children
+func (t *BTree[K, V]) refreshNode(node *Node[K, V]) {
+	node.count = len(node.keys)
+	for _, child := range node.children {
+		node.count += child.count
+	}
+	if t.aug != nil {
+		t.aug.refresh(node)
+	}
+}
+
+// fixUp recomputes the cached data of node and all of its ancestors, it is
+// called once the structure below node is settled
+func (t *BTree[K, V]) fixUp(node *Node[K, V]) {
+	for ; node != nil; node = node.parent {
+		t.refreshNode(node)
+	}
 }
 
 func setParent[K comparable, V any](nodes []*Node[K, V], parent *Node[K, V]) {
@@ -270,7 +423,7 @@ func (t *BTree[K, V]) searchRecursively(
 func (t *BTree[K, V]) Get(key K) (value V, found bool) {
 	node, index, found := t.searchRecursively(t.root, key)
 	if found {
-		return node.entries[index].Value, true
+		return node.values[index], true
 	}
 	return value, false
 }
@@ -288,98 +441,87 @@ func (t *BTree[K, V]) Get(key K) (value V, found bool) {
 //	return fmt.Errorf("Key is not in the tree")
 //}
 
+// Delete removes the key, it returns ErrEmpty or ErrNotFound when there is
+// nothing to remove
 func (t *BTree[K, V]) Delete(key K) error {
-	if t.root == nil {
-		return fmt.Errorf("Tree is empty")
+	if t.root == nil || t.isEmpty() {
+		return ErrEmpty
 	}
 	node, index, found := t.searchRecursively(t.root, key)
 	if !found {
-		return fmt.Errorf("Key is not in the tree")
+		return ErrNotFound
 	}
+	old := t.removeAt(node, index)
+	t.hooks.deleted(old.Key, old.Value)
+	return nil
+}
+
+// removeAt removes the entry at index of node and returns it, without
+// telling the hooks
+func (t *BTree[K, V]) removeAt(node *Node[K, V], index int) Item[K, V] {
+	old := t.item(node, index)
 	t.remove(node, index)
 	t.size--
 
 	// If the root node is empty after removal, make its only child the new root
-	if len(t.root.entries) == 0 && len(t.root.children) > 0 {
+	if len(t.root.keys) == 0 && len(t.root.children) > 0 {
+		root := t.root
 		t.root = t.root.children[0]
 		t.root.parent = nil
+		t.counters.RootCollapses++
+		t.freeNode(root)
 	}
-
-	return nil
+	return old
 }
 
 func (t *BTree[K, V]) remove(node *Node[K, V], index int) {
-	if t.isLeaf(node) {
-		t.removeFromLeaf(node, index)
-	} else {
-		t.removeFromNonLeaf(node, index)
-	}
+	if !t.isLeaf(node) {
+		// swap the entry with its predecessor, which always lives in a leaf,
+		// so the actual removal (and any underflow) starts from the bottom
+		leaf := t.rightmostLeaf(node.children[index])
+		last := len(leaf.keys) - 1
+		t.setItem(node, index, t.item(leaf, last))
+		node, index = leaf, last
+	}
+	t.removeFromLeaf(node, index)
 	t.rebalance(node) // reblance if necessary
 }
 
 func (t *BTree[K, V]) removeFromLeaf(node *Node[K, V], index int) {
 	// Remove the entry at the given index
-	copy(node.entries[index:], node.entries[index+1:])
-	node.entries = node.entries[:len(node.entries)-1]
-}
-
-func (t *BTree[K, V]) removeFromNonLeaf(node *Node[K, V], index int) {
-	if len(node.children[index].entries) >= t.minEntries() { // LST
-		predecessor := t.predecessor(node, index)
-		node.entries[index] = predecessor
-		t.remove(node.children[index], len(node.entries)-1)
-	} else if len(node.children[index+1].entries) >= t.minEntries() { // RST
-		succesor := t.successor(node, index)
-		node.entries[index] = succesor
-		t.remove(node.children[index+1], 0)
-	} else {
-		t.mergeChildren(node, index)
-		key, _ := t.searchKeyIndex(node, node.entries[index].Key)
-		t.remove(node.children[index], key)
-	}
-}
-
-func (t *BTree[K, V]) predecessor(node *Node[K, V], index int) *Item[K, V] {
-	current := node.children[index]
-	for !t.isLeaf(current) {
-		current = current.children[len(current.children)-1]
-	}
-	return current.entries[len(current.entries)-1]
+	t.deleteItems(node, index, index+1)
 }
 
-func (t *BTree[K, V]) successor(node *Node[K, V], index int) *Item[K, V] {
-	current := node.children[index+1]
-	for !t.isLeaf(current) {
-		current = current.children[0]
+func (t *BTree[K, V]) rightmostLeaf(node *Node[K, V]) *Node[K, V] {
+	for !t.isLeaf(node) {
+		node = node.children[len(node.children)-1]
 	}
-	return current.entries[0]
+	return node
 }
 
 func (t *BTree[K, V]) mergeChildren(parent *Node[K, V], index int) {
 	// primero borro del parent node y acomodo
 	// despues hago el merge entre los nodos izq y derechos
 	// actualizo punteros
-
+	t.counters.Merges++
 	leftChild, rightChild := parent.children[index], parent.children[index+1]
 
-	leftChild.entries = append(leftChild.entries, parent.entries[index])
-	leftChild.entries = append(leftChild.entries, rightChild.entries...)
+	t.appendItem(leftChild, t.item(parent, index))
+	t.appendRange(leftChild, rightChild, 0, len(rightChild.keys))
 	leftChild.children = append(leftChild.children, rightChild.children...)
 
 	setParent(rightChild.children, leftChild)
 
-	copy(parent.entries[index:], parent.entries[index+1:])
-	copy(parent.children[index+1:], parent.children[index+2:])
-	parent.entries = parent.entries[:len(parent.entries)-1]
-	parent.children = parent.children[:len(parent.children)-1]
+	t.deleteItems(parent, index, index+1)
+	parent.children = slices.Delete(parent.children, index+1, index+2)
+
+	t.refreshNode(leftChild)
+	t.freeNode(rightChild)
 }
 
 func (t *BTree[K, V]) rebalance(node *Node[K, V]) {
-	if len(node.entries) >= t.minEntries() {
-		return
-	}
-
-	if node == t.root {
+	if len(node.keys) >= t.minEntries() || node == t.root {
+		t.fixUp(node)
 		return
 	}
 
@@ -387,9 +529,9 @@ func (t *BTree[K, V]) rebalance(node *Node[K, V]) {
 	index := t.getChildIndex(parent, node)
 
 	// Try to borrow from left sibling
-	if index > 0 && len(parent.children[index-1].entries) > t.minEntries() {
+	if index > 0 && len(parent.children[index-1].keys) > t.minEntries() {
 		t.borrowFromLeft(node, index)
-	} else if index < len(parent.children)-1 && len(parent.children[index+1].entries) > t.minEntries() {
+	} else if index < len(parent.children)-1 && len(parent.children[index+1].keys) > t.minEntries() {
 		// Try to borrow from right sibling
 		t.borrowFromRight(node, index)
 	} else if index > 0 {
@@ -404,43 +546,51 @@ func (t *BTree[K, V]) rebalance(node *Node[K, V]) {
 }
 
 func (t *BTree[K, V]) borrowFromLeft(node *Node[K, V], index int) {
+	t.counters.Borrows++
 	parent := node.parent
 	leftSibling := parent.children[index-1]
 
 	// Move the separating key from the parent to the beginning of the node
-	node.entries = append([]*Item[K, V]{parent.entries[index-1]}, node.entries...)
+	t.insertItem(node, 0, t.item(parent, index-1))
 
 	// Move the last key from the left sibling to the parent
-	parent.entries[index-1] = leftSibling.entries[len(leftSibling.entries)-1]
-	leftSibling.entries = leftSibling.entries[:len(leftSibling.entries)-1]
+	last := len(leftSibling.keys) - 1
+	t.setItem(parent, index-1, t.item(leftSibling, last))
+	t.deleteItems(leftSibling, last, last+1)
 
 	if !t.isLeaf(node) {
 		// Move the last child pointer from the left sibling to the beginning of the node
-		node.children = append(
-			[]*Node[K, V]{leftSibling.children[len(leftSibling.children)-1]},
-			node.children...)
-		leftSibling.children = leftSibling.children[:len(leftSibling.children)-1]
+		last := len(leftSibling.children) - 1
+		node.children = slices.Insert(node.children, 0, leftSibling.children[last])
+		leftSibling.children = slices.Delete(leftSibling.children, last, last+1)
 		node.children[0].parent = node
 	}
+
+	t.refreshNode(leftSibling)
+	t.refreshNode(node)
 }
 
 func (t *BTree[K, V]) borrowFromRight(node *Node[K, V], index int) {
+	t.counters.Borrows++
 	parent := node.parent
 	rightSibling := parent.children[index+1]
 
 	// Move the separating key from the parent to the end of the node
-	node.entries = append(node.entries, parent.entries[index])
+	t.appendItem(node, t.item(parent, index))
 
 	// Move the first key from the right sibling to the parent
-	parent.entries[index] = rightSibling.entries[0]
-	rightSibling.entries = rightSibling.entries[1:]
+	t.setItem(parent, index, t.item(rightSibling, 0))
+	t.deleteItems(rightSibling, 0, 1)
 
 	if !t.isLeaf(node) {
 		// Move the first child pointer from the right sibling to the end of the node
 		node.children = append(node.children, rightSibling.children[0])
-		rightSibling.children = rightSibling.children[1:]
+		rightSibling.children = slices.Delete(rightSibling.children, 0, 1)
 		node.children[len(node.children)-1].parent = node
 	}
+
+	t.refreshNode(rightSibling)
+	t.refreshNode(node)
 }
 
 func (t *BTree[K, V]) getChildIndex(parent *Node[K, V], child *Node[K, V]) int {
@@ -451,3 +601,47 @@ func (t *BTree[K, V]) getChildIndex(parent *Node[K, V], child *Node[K, V]) int {
 	}
 	return -1
 }
+
+// All returns an iterator over every key-value pair of the tree in key order
+func (t *BTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if t.root != nil {
+			t.walk(t.root, yield)
+		}
+	}
+}
+
+// walk does an in-order traversal of the subtree rooted at node, it returns
+// false as soon as yield asks to stop so callers can unwind the recursion
+func (t *BTree[K, V]) walk(node *Node[K, V], yield func(K, V) bool) bool {
+	for i := range node.keys {
+		if !t.isLeaf(node) && !t.walk(node.children[i], yield) {
+			return false
+		}
+		if !yield(t.key(node, i), node.values[i]) {
+			return false
+		}
+	}
+	if !t.isLeaf(node) {
+		return t.walk(node.children[len(node.children)-1], yield)
+	}
+	return true
+}
+
+// walkFrom is walk skipping the entries lower than lo, only the path down to
+// lo is searched and everything to the right of it is walked whole
+func (t *BTree[K, V]) walkFrom(node *Node[K, V], lo K, yield func(K, V) bool) bool {
+	index, found := t.searchKeyIndex(node, lo)
+	if !found && !t.isLeaf(node) && !t.walkFrom(node.children[index], lo, yield) {
+		return false
+	}
+	for i := index; i < len(node.keys); i++ {
+		if !yield(t.key(node, i), node.values[i]) {
+			return false
+		}
+		if !t.isLeaf(node) && !t.walk(node.children[i+1], yield) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,10 @@
 package btree
 
 import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,23 +15,10 @@ const (
 	benchItems = 16
 )
 
-func cmpString(s1, s2 string) int {
-	if s1 == s2 {
-		return 0
-	} else if s1 < s2 {
-		return -1
-	}
-	return 1
-}
-
-func cmpInt(i1, i2 int) int {
-	if i1 == i2 {
-		return 0
-	} else if i1 < i2 {
-		return -1
-	}
-	return 1
-}
+var (
+	cmpString = cmp.Compare[string]
+	cmpInt    = cmp.Compare[int]
+)
 
 func TestBtreeEmpty(t *testing.T) {
 	tree := NewBTree[int, string](3, cmpInt)
@@ -35,9 +26,9 @@ func TestBtreeEmpty(t *testing.T) {
 
 	tree.Put(1, "uno")
 	assert.False(t, tree.isEmpty())
-	entrie := &Item[int, string]{1, "uno"}
+	entrie := Item[int, string]{1, "uno"}
 	// assert that the unique entrie is matched
-	assert.EqualValues(t, tree.root.entries[0], entrie)
+	assert.EqualValues(t, tree.item(tree.root, 0), entrie)
 }
 
 func TestBTreePut1(t *testing.T) {
@@ -263,9 +254,65 @@ func TestBTreeRemove7(t *testing.T) {
 	assertValidTreeNode(t, tree.root.children[2], 1, 0, []int{7}, true)
 }
 
+func TestBTreeRandomOps(t *testing.T) {
+	t.Log("Test random puts and deletes against a map")
+	for order := 3; order <= 8; order++ {
+		tree := NewBTree[int, int](order, cmpInt)
+		expected := map[int]int{}
+		r := rand.New(rand.NewSource(int64(order)))
+
+		for i := 0; i < 5000; i++ {
+			key := r.Intn(300)
+			if r.Intn(2) == 0 {
+				tree.Put(key, i)
+				expected[key] = i
+				continue
+			}
+			_, ok := expected[key]
+			err := tree.Delete(key)
+			assert.Equal(t, ok, err == nil, "order %d delete %d", order, key)
+			delete(expected, key)
+		}
+
+		assertValidTree(t, tree, len(expected))
+		assertValidStructure(t, tree, tree.root)
+		for key, value := range expected {
+			got, found := tree.Get(key)
+			assert.True(t, found)
+			assert.Equal(t, value, got)
+		}
+	}
+}
+
+func TestBTreeAll(t *testing.T) {
+	tree := NewBTree[int, int](3, cmpInt)
+	keys := rand.New(rand.NewSource(1)).Perm(100)
+	for _, k := range keys {
+		tree.Put(k, k*10)
+	}
+	sort.Ints(keys)
+
+	var got []int
+	for k, v := range tree.All() {
+		assert.Equal(t, k*10, v)
+		got = append(got, k)
+	}
+	assert.Equal(t, keys, got)
+
+	// stopping early must not keep yielding
+	count := 0
+	for range tree.All() {
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count)
+}
+
 func assertValidTree[K comparable, V any](t *testing.T, tree *BTree[K, V], expectedSize int) {
 	if actualValue, expectedValue := tree.size, expectedSize; actualValue != expectedValue {
-		t.Errorf("Got %v expected %v for tree size", actualValue, expectedValue)
+		t.Errorf("Got %v expected %v for tree size\n%s", actualValue, expectedValue, tree)
 	}
 }
 
@@ -280,15 +327,66 @@ func assertValidTreeNode[K comparable, V any](
 	if actualValue, expectedValue := node.parent != nil, hasParent; actualValue != expectedValue {
 		t.Errorf("Got %v expected %v for hasParent", actualValue, expectedValue)
 	}
-	if actualValue, expectedValue := len(node.entries), expectedEntries; actualValue != expectedValue {
+	if actualValue, expectedValue := len(node.keys), expectedEntries; actualValue != expectedValue {
 		t.Errorf("Got %v expected %v for entries size", actualValue, expectedValue)
 	}
 	if actualValue, expectedValue := len(node.children), expectedChildren; actualValue != expectedValue {
 		t.Errorf("Got %v expected %v for children size", actualValue, expectedValue)
 	}
 	for i, key := range keys {
-		if actualValue, expectedValue := node.entries[i].Key, key; actualValue != expectedValue {
+		if actualValue, expectedValue := node.keys[i], key; actualValue != expectedValue {
 			t.Errorf("Got %v expected %v for key", actualValue, expectedValue)
 		}
 	}
 }
+
+func TestWalkFrom(t *testing.T) {
+	for _, order := range []int{3, 4, 5} {
+		tree := NewBTree[int, int](order, cmpInt)
+		for i := 0; i < 100; i += 2 {
+			tree.Put(i, i)
+		}
+		for lo := -1; lo <= 100; lo++ {
+			var got []int
+			tree.walkFrom(tree.root, lo, func(k, _ int) bool {
+				got = append(got, k)
+				return len(got) < 5
+			})
+			var want []int
+			for k := lo + lo&1; k < 100 && len(want) < 5; k += 2 {
+				want = append(want, k)
+			}
+			assert.Equal(t, want, got, "order %d from %d", order, lo)
+		}
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	assert.PanicsWithValue(t, "Invalid degree, should be at least 3", func() { NewBTree[int, int](2, cmpInt) })
+	assert.Panics(t, func() { NewOrdered[int, int](1) })
+
+	ordered := NewOrdered[string, int](3)
+	byLess := NewBTreeLess[string, int](3, func(a, b string) bool { return a < b })
+	reverse := NewBTreeLess[string, int](3, func(a, b string) bool { return a > b })
+	words := []string{"pear", "apple", "fig", "kiwi", "banana", "plum", "apple"}
+	for i, w := range words {
+		ordered.Put(w, i)
+		byLess.Put(w, i)
+		reverse.Put(w, i)
+	}
+
+	want := []string{"apple", "banana", "fig", "kiwi", "pear", "plum"}
+	assert.Equal(t, want, collectKeys(ordered.All()))
+	assert.Equal(t, want, collectKeys(byLess.All()))
+	slices.Reverse(want)
+	assert.Equal(t, want, collectKeys(reverse.All()))
+
+	for _, tree := range []*BTree[string, int]{ordered, byLess, reverse} {
+		v, found := tree.Get("apple")
+		assert.True(t, found)
+		assert.Equal(t, 6, v, "the second put replaced the value")
+		assert.NoError(t, tree.Delete("fig"))
+		assert.ErrorIs(t, tree.Delete("fig"), ErrNotFound)
+		assert.Equal(t, 5, tree.Len())
+	}
+}
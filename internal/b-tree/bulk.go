@@ -0,0 +1,83 @@
+package btree
+
+// bulk building: instead of calling Put for every item, which splits nodes
+// over and over, a tree over already sorted items is assembled bottom up in
+// O(n). Leaves are cut first, the items left between them become the entries
+// of the level above, and so on until a single root remains.
+
+// groupSizes splits n sorted entries into nodes separated by one entry each,
+// so that sum(sizes) + len(sizes) - 1 == n. It uses as few nodes as possible
+// and spreads the entries evenly so no node is below minEntries.
+func (t *BTree[K, V]) groupSizes(n int) []int {
+	groups := (n + t.maxEntries() + 1) / (t.maxEntries() + 1) // ceil((n+1) / (maxEntries+1))
+	if groups <= 1 {
+		return []int{n}
+	}
+	entries := n - (groups - 1)
+	sizes := make([]int, groups)
+	for i := range sizes {
+		sizes[i] = entries / groups
+		if i < entries%groups {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// buildSorted replaces the contents of the tree with items, which must be
+// sorted by key without duplicates
+func (t *BTree[K, V]) buildSorted(items []Item[K, V]) {
+	if t.aug != nil && t.root != nil {
+		t.forgetAll(t.root)
+	}
+	t.size = len(items)
+	if len(items) == 0 {
+		t.root = nil
+		return
+	}
+
+	// leaves
+	var nodes []*Node[K, V]
+	var separators []Item[K, V]
+	pos := 0
+	for _, size := range t.groupSizes(len(items)) {
+		leaf := t.newNode(true)
+		for _, item := range items[pos : pos+size] {
+			t.appendItem(leaf, item)
+		}
+		t.refreshNode(leaf)
+		nodes = append(nodes, leaf)
+		pos += size
+		if pos < len(items) {
+			separators = append(separators, items[pos])
+			pos++
+		}
+	}
+
+	// internal levels, each one has one node less than the separators + 1
+	for len(nodes) > 1 {
+		var parents []*Node[K, V]
+		var next []Item[K, V]
+		pos, child := 0, 0
+		for _, size := range t.groupSizes(len(separators)) {
+			parent := t.newNode(false)
+			for _, item := range separators[pos : pos+size] {
+				t.appendItem(parent, item)
+			}
+			parent.children = append(parent.children, nodes[child:child+size+1]...)
+			setParent(parent.children, parent)
+			t.refreshNode(parent)
+			parents = append(parents, parent)
+			pos += size
+			child += size + 1
+			if pos < len(separators) {
+				next = append(next, separators[pos])
+				pos++
+			}
+		}
+		nodes, separators = parents, next
+	}
+
+	t.root = nodes[0]
+	t.root.parent = nil
+}
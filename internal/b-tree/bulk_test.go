@@ -0,0 +1,83 @@
+package btree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertValidStructure checks occupancy, parent pointers, key order and that
+// every leaf is at the same depth, returning that depth
+func assertValidStructure[K comparable, V any](t *testing.T, tree *BTree[K, V], node *Node[K, V]) int {
+	if node != tree.root {
+		assert.GreaterOrEqual(t, len(node.keys), tree.minEntries())
+	}
+	assert.LessOrEqual(t, len(node.keys), tree.maxEntries())
+	for i := 1; i < len(node.keys); i++ {
+		assert.Negative(t, tree.Less(node.keys[i-1], node.keys[i]))
+	}
+	count := len(node.keys)
+	for _, child := range node.children {
+		count += child.count
+	}
+	assert.Equal(t, count, node.count)
+	if tree.isLeaf(node) {
+		return 1
+	}
+	assert.Equal(t, len(node.keys)+1, len(node.children))
+	depth := -1
+	for _, child := range node.children {
+		assert.Same(t, node, child.parent)
+		d := assertValidStructure(t, tree, child)
+		if depth == -1 {
+			depth = d
+		}
+		assert.Equal(t, depth, d)
+	}
+	return depth + 1
+}
+
+func TestBuildSorted(t *testing.T) {
+	for order := 3; order <= 9; order++ {
+		for n := 0; n <= 300; n++ {
+			items := make([]Item[int, int], n)
+			for i := range items {
+				items[i] = Item[int, int]{Key: i, Value: i * 2}
+			}
+			tree := NewBTree[int, int](order, cmpInt)
+			tree.buildSorted(items)
+			assertValidTree(t, tree, n)
+			if n == 0 {
+				continue
+			}
+			assertValidStructure(t, tree, tree.root)
+
+			i := 0
+			for k, v := range tree.All() {
+				assert.Equal(t, i, k)
+				assert.Equal(t, i*2, v)
+				i++
+			}
+			assert.Equal(t, n, i)
+		}
+	}
+}
+
+func TestBuildSortedKeepsWorking(t *testing.T) {
+	items := make([]Item[int, int], 100)
+	for i := range items {
+		items[i] = Item[int, int]{Key: i * 2}
+	}
+	tree := NewAugmented[int, int](4, cmpInt, Count[int, int]())
+	tree.buildSorted(items)
+	assert.Equal(t, 100, tree.Total())
+
+	for i := 0; i < 200; i += 3 {
+		tree.Put(i, 0)
+	}
+	for i := 0; i < 200; i += 4 {
+		tree.Delete(i)
+	}
+	assertValidStructure(t, tree.BTree, tree.root)
+	assert.Equal(t, tree.Len(), tree.Total())
+}
@@ -0,0 +1,97 @@
+package btree
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// CSVFormat says how a CSV row maps to an entry. One column holds the key,
+// the value is built from the whole row so it can span several columns.
+type CSVFormat[K comparable, V any] struct {
+	KeyColumn int
+
+	// Header is written as the first row by WriteCSV. ReadCSV expects the
+	// first row to be exactly this header and skips it.
+	Header []string
+
+	// used by ReadCSV
+	ParseKey   func(field string) (K, error)
+	ParseValue func(row []string) (V, error)
+
+	// used by WriteCSV, FormatValue returns the columns other than the key,
+	// the key is inserted among them at KeyColumn
+	FormatKey   func(key K) string
+	FormatValue func(value V) []string
+}
+
+// ReadCSV puts every row of r into the tree. It stops at the first row that
+// fails to parse, returning an error with its line, rows before it are
+// already in the tree.
+func (t *BTree[K, V]) ReadCSV(r io.Reader, format CSVFormat[K, V]) error {
+	if format.ParseKey == nil || format.ParseValue == nil {
+		return errors.New("btree: ReadCSV needs ParseKey and ParseValue")
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // values may be optional columns
+	if format.Header != nil {
+		header, err := cr.Read()
+		if err != nil {
+			return fmt.Errorf("btree: csv header: %w", err)
+		}
+		if !slices.Equal(header, format.Header) {
+			return fmt.Errorf("btree: csv header is %q, expected %q", header, format.Header)
+		}
+	}
+
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("btree: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if format.KeyColumn < 0 || format.KeyColumn >= len(row) {
+			return fmt.Errorf("btree: csv line %d: no key column %d", line, format.KeyColumn)
+		}
+		key, err := format.ParseKey(row[format.KeyColumn])
+		if err != nil {
+			return fmt.Errorf("btree: csv line %d: key: %w", line, err)
+		}
+		value, err := format.ParseValue(row)
+		if err != nil {
+			return fmt.Errorf("btree: csv line %d: value: %w", line, err)
+		}
+		if err := t.Put(key, value); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteCSV writes the header, if any, and then one row per entry in key order
+func (t *BTree[K, V]) WriteCSV(w io.Writer, format CSVFormat[K, V]) error {
+	if format.FormatKey == nil || format.FormatValue == nil {
+		return errors.New("btree: WriteCSV needs FormatKey and FormatValue")
+	}
+	cw := csv.NewWriter(w)
+	if format.Header != nil {
+		if err := cw.Write(format.Header); err != nil {
+			return err
+		}
+	}
+	for k, v := range t.All() {
+		row := format.FormatValue(v)
+		if format.KeyColumn < 0 || format.KeyColumn > len(row) {
+			return fmt.Errorf("btree: key column %d but the value has %d columns", format.KeyColumn, len(row))
+		}
+		if err := cw.Write(slices.Insert(row, format.KeyColumn, format.FormatKey(k))); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,87 @@
+package btree
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+// users are stored as name,id,age with the id as key
+func userFormat() CSVFormat[int, user] {
+	return CSVFormat[int, user]{
+		KeyColumn: 1,
+		Header:    []string{"name", "id", "age"},
+		ParseKey:  strconv.Atoi,
+		ParseValue: func(row []string) (user, error) {
+			if len(row) != 3 {
+				return user{}, strconv.ErrSyntax
+			}
+			age, err := strconv.Atoi(row[2])
+			return user{Name: row[0], Age: age}, err
+		},
+		FormatKey: strconv.Itoa,
+		FormatValue: func(u user) []string {
+			return []string{u.Name, strconv.Itoa(u.Age)}
+		},
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	input := "name,id,age\n" +
+		"carol,3,41\n" +
+		"alice,1,30\n" +
+		"\"bob, jr\",2,25\n"
+	tree := NewBTree[int, user](3, cmpInt)
+	assert.NoError(t, tree.ReadCSV(strings.NewReader(input), userFormat()))
+	assertValidTree(t, tree, 3)
+	u, _ := tree.Get(2)
+	assert.Equal(t, user{"bob, jr", 25}, u)
+
+	var out strings.Builder
+	assert.NoError(t, tree.WriteCSV(&out, userFormat()))
+	assert.Equal(t, "name,id,age\n"+
+		"alice,1,30\n"+
+		"\"bob, jr\",2,25\n"+
+		"carol,3,41\n", out.String())
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	read := func(input string) error {
+		return NewBTree[int, user](3, cmpInt).ReadCSV(strings.NewReader(input), userFormat())
+	}
+	assert.ErrorContains(t, read("id,name,age\n"), "header")
+	assert.ErrorContains(t, read(""), "header")
+	assert.ErrorContains(t, read("name,id,age\nalice,x,30\n"), "line 2: key")
+	assert.ErrorContains(t, read("name,id,age\nalice,1,30\nbob,2\n"), "line 3: value")
+	assert.ErrorContains(t, read("name,id,age\nalice\n"), "line 2: no key column")
+
+	noParse := CSVFormat[int, user]{}
+	assert.Error(t, NewBTree[int, user](3, cmpInt).ReadCSV(strings.NewReader(""), noParse))
+
+	// rows before the bad one are kept
+	tree := NewBTree[int, user](3, cmpInt)
+	assert.Error(t, tree.ReadCSV(strings.NewReader("name,id,age\na,1,1\nb,x,2\n"), userFormat()))
+	assert.Equal(t, 1, tree.Len())
+}
+
+func TestWriteCSVKeyColumn(t *testing.T) {
+	tree := NewBTree[int, user](3, cmpInt)
+	tree.Put(7, user{"dan", 50})
+
+	format := userFormat()
+	format.Header = nil
+	format.KeyColumn = 2
+	var out strings.Builder
+	assert.NoError(t, tree.WriteCSV(&out, format))
+	assert.Equal(t, "dan,50,7\n", out.String())
+
+	format.KeyColumn = 3
+	assert.Error(t, tree.WriteCSV(&out, format))
+}
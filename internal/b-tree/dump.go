@@ -0,0 +1,206 @@
+package btree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpOption tweaks what Dump and WriteDOT show
+type DumpOption func(*dumpConfig)
+
+type dumpConfig struct {
+	parents    bool
+	violations bool
+}
+
+// WithParents shows the parent pointer of every node, a pointer that doesn't
+// match the node the child actually hangs from is flagged
+func WithParents() DumpOption {
+	return func(c *dumpConfig) { c.parents = true }
+}
+
+// WithViolations flags the nodes with fewer than minEntries (the root is
+// exempt) or more than maxEntries entries
+func WithViolations() DumpOption {
+	return func(c *dumpConfig) { c.violations = true }
+}
+
+// dumpNode is a node together with what is needed to print it
+type dumpNode[K comparable, V any] struct {
+	node   *Node[K, V]
+	id     int
+	parent int // id of the node it hangs from, -1 for the root
+}
+
+// levels lists the nodes breadth first, giving each one an id
+func (t *BTree[K, V]) levels() [][]dumpNode[K, V] {
+	if t.root == nil {
+		return nil
+	}
+	ids := map[*Node[K, V]]int{}
+	var levels [][]dumpNode[K, V]
+	current := []dumpNode[K, V]{{node: t.root, id: 0, parent: -1}}
+	ids[t.root] = 0
+	for len(current) > 0 {
+		levels = append(levels, current)
+		var next []dumpNode[K, V]
+		for _, d := range current {
+			for _, child := range d.node.children {
+				ids[child] = len(ids)
+				next = append(next, dumpNode[K, V]{node: child, id: ids[child], parent: d.id})
+			}
+		}
+		current = next
+	}
+	return levels
+}
+
+// violation describes what is wrong with a node, or returns ""
+func (t *BTree[K, V]) violation(d dumpNode[K, V]) string {
+	n := len(d.node.keys)
+	switch {
+	case n > t.maxEntries():
+		return fmt.Sprintf("overflow %d>%d", n, t.maxEntries())
+	case d.node != t.root && n < t.minEntries():
+		return fmt.Sprintf("underflow %d<%d", n, t.minEntries())
+	case !t.isLeaf(d.node) && len(d.node.children) != n+1:
+		return fmt.Sprintf("%d entries but %d children", n, len(d.node.children))
+	}
+	return ""
+}
+
+// parentMismatch tells whether the parent pointer doesn't point to the node
+// the child hangs from
+func parentMismatch[K comparable, V any](d dumpNode[K, V], byID map[int]*Node[K, V]) bool {
+	if d.parent == -1 {
+		return d.node.parent != nil
+	}
+	return d.node.parent != byID[d.parent]
+}
+
+// nodeIDs maps ids to nodes and back
+func nodeIDs[K comparable, V any](levels [][]dumpNode[K, V]) (map[int]*Node[K, V], map[*Node[K, V]]int) {
+	byID := map[int]*Node[K, V]{}
+	idOf := map[*Node[K, V]]int{}
+	for _, level := range levels {
+		for _, d := range level {
+			byID[d.id] = d.node
+			idOf[d.node] = d.id
+		}
+	}
+	return byID, idOf
+}
+
+func (t *BTree[K, V]) keyLabels(node *Node[K, V]) []string {
+	keys := make([]string, len(node.keys))
+	for i, key := range t.keysOf(node) {
+		keys[i] = fmt.Sprint(key)
+	}
+	return keys
+}
+
+// Dump writes the tree level by level, one line per level:
+//
+//	0: [4]
+//	1: [2] [6]
+//	2: [1] [3] [5] [7]
+func (t *BTree[K, V]) Dump(w io.Writer, opts ...DumpOption) error {
+	var cfg dumpConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	bw := bufio.NewWriter(w)
+	levels := t.levels()
+	if len(levels) == 0 {
+		fmt.Fprintln(bw, "(empty)")
+	}
+	byID, _ := nodeIDs(levels)
+	for depth, level := range levels {
+		fmt.Fprintf(bw, "%d:", depth)
+		for _, d := range level {
+			bw.WriteByte(' ')
+			if cfg.parents {
+				fmt.Fprintf(bw, "n%d", d.id)
+			}
+			fmt.Fprintf(bw, "[%s]", strings.Join(t.keyLabels(d.node), " "))
+			if cfg.parents && d.parent >= 0 {
+				fmt.Fprintf(bw, "^n%d", d.parent)
+			}
+			if cfg.parents && parentMismatch(d, byID) {
+				bw.WriteString("(bad parent)")
+			}
+			if v := t.violation(d); cfg.violations && v != "" {
+				fmt.Fprintf(bw, "(%s)", v)
+			}
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// String renders the tree like Dump with every option turned on
+func (t *BTree[K, V]) String() string {
+	var sb strings.Builder
+	t.Dump(&sb, WithParents(), WithViolations())
+	return sb.String()
+}
+
+// WriteDOT writes the tree in the Graphviz DOT language, render it with
+// `dot -Tsvg tree.dot > tree.svg`. Parent pointers are drawn as dashed edges
+// and nodes breaking an invariant are filled in red.
+func (t *BTree[K, V]) WriteDOT(w io.Writer, opts ...DumpOption) error {
+	var cfg dumpConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph btree {")
+	fmt.Fprintln(bw, "\tnode [shape=record];")
+	levels := t.levels()
+	byID, idOf := nodeIDs(levels)
+	for _, level := range levels {
+		for _, d := range level {
+			// a record label alternates child ports and keys: <c0>|k0|<c1>|k1|<c2>
+			var label strings.Builder
+			for i, key := range t.keyLabels(d.node) {
+				fmt.Fprintf(&label, "<c%d>|%s|", i, escapeDOT(key))
+			}
+			fmt.Fprintf(&label, "<c%d>", len(d.node.keys))
+
+			attrs := ""
+			if v := t.violation(d); cfg.violations && v != "" {
+				attrs = fmt.Sprintf(", style=filled, fillcolor=red, tooltip=\"%s\"", v)
+			}
+			fmt.Fprintf(bw, "\tn%d [label=\"%s\"%s];\n", d.id, label.String(), attrs)
+			if d.parent >= 0 {
+				index := t.getChildIndex(byID[d.parent], d.node)
+				fmt.Fprintf(bw, "\tn%d:c%d -> n%d;\n", d.parent, index, d.id)
+			}
+			if cfg.parents && d.node.parent != nil {
+				color := "gray"
+				if parentMismatch(d, byID) {
+					color = "red"
+				}
+				if id, ok := idOf[d.node.parent]; ok {
+					fmt.Fprintf(bw, "\tn%d -> n%d [style=dashed, color=%s];\n", d.id, id, color)
+				}
+			}
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// escapeDOT escapes the characters with a meaning inside record labels
+func escapeDOT(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`{}|<>"\ `, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
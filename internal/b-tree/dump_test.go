@@ -0,0 +1,56 @@
+package btree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDump(t *testing.T) {
+	tree := sequentialTree(3, 1, 8)
+	var sb strings.Builder
+	assert.NoError(t, tree.Dump(&sb))
+	assert.Equal(t, "0: [4]\n1: [2] [6]\n2: [1] [3] [5] [7]\n", sb.String())
+
+	sb.Reset()
+	assert.NoError(t, tree.Dump(&sb, WithParents()))
+	assert.Equal(t, "0: n0[4]\n1: n1[2]^n0 n2[6]^n0\n2: n3[1]^n1 n4[3]^n1 n5[5]^n2 n6[7]^n2\n", sb.String())
+
+	sb.Reset()
+	assert.NoError(t, NewBTree[int, int](3, cmpInt).Dump(&sb))
+	assert.Equal(t, "(empty)\n", sb.String())
+}
+
+func TestDumpFlagsBrokenNodes(t *testing.T) {
+	tree := sequentialTree(3, 1, 8)
+	// break the tree on purpose: an empty leaf and a stale parent pointer
+	tree.truncate(tree.root.children[0].children[0], 0)
+	tree.root.children[1].children[1].parent = tree.root
+
+	out := tree.String()
+	assert.Contains(t, out, "n3[]^n1(underflow 0<1)")
+	assert.Contains(t, out, "n6[7]^n2(bad parent)")
+
+	var sb strings.Builder
+	assert.NoError(t, tree.Dump(&sb))
+	assert.NotContains(t, sb.String(), "underflow", "violations are only shown on request")
+}
+
+func TestWriteDOT(t *testing.T) {
+	tree := NewBTree[string, int](3, cmpString)
+	for _, k := range []string{"a", "b|c", "d e"} {
+		tree.Put(k, 0)
+	}
+	tree.truncate(tree.root.children[0], 0)
+
+	var sb strings.Builder
+	assert.NoError(t, tree.WriteDOT(&sb, WithParents(), WithViolations()))
+	dot := sb.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph btree {\n"))
+	assert.Contains(t, dot, `n0 [label="<c0>|b\|c|<c1>"];`)
+	assert.Contains(t, dot, `n2 [label="<c0>|d\ e|<c1>"];`)
+	assert.Contains(t, dot, "n0:c1 -> n2;")
+	assert.Contains(t, dot, "n2 -> n0 [style=dashed, color=gray];")
+	assert.Contains(t, dot, `n1 [label="<c0>", style=filled, fillcolor=red, tooltip="underflow 0<1"];`)
+}
@@ -0,0 +1,25 @@
+package btree
+
+import "errors"
+
+// Errors returned by the tree, compare them with errors.Is since some are
+// wrapped with more details
+var (
+	ErrEmpty    = errors.New("btree: tree is empty")
+	ErrNotFound = errors.New("btree: key is not in the tree")
+
+	// ErrInvariant means the tree structure is broken, it should never happen
+	// and the tree must not be used anymore after it shows up
+	ErrInvariant = errors.New("btree: invariant violated")
+
+	ErrOverlap         = errors.New("btree: key ranges overlap")
+	ErrDegreeMismatch  = errors.New("btree: trees have different degrees")
+	ErrIncompatible    = errors.New("btree: trees are configured differently")
+	ErrInvalidInterval = errors.New("btree: interval start is after its end")
+
+	// ErrCorruptSnapshot is returned by ReadFrom for a snapshot that fails
+	// its checksum or doesn't parse, ErrSnapshotVersion for one written by an
+	// unknown version of the format
+	ErrCorruptSnapshot = errors.New("btree: corrupt snapshot")
+	ErrSnapshotVersion = errors.New("btree: unsupported snapshot version")
+)
@@ -0,0 +1,39 @@
+package btree
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteErrors(t *testing.T) {
+	tree := NewBTree[int, int](3, cmpInt)
+	assert.ErrorIs(t, tree.Delete(1), ErrEmpty)
+
+	tree.Put(1, 1)
+	assert.ErrorIs(t, tree.Delete(2), ErrNotFound)
+	assert.NoError(t, tree.Delete(1))
+	assert.ErrorIs(t, tree.Delete(1), ErrEmpty, "emptied trees report ErrEmpty too")
+
+	p := NewPersistentBTree[int, int](3, cmpInt)
+	_, err := p.Delete(1)
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = p.Put(1, 1).Delete(2)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestPutReportsBrokenInvariant(t *testing.T) {
+	tree := sequentialTree(3, 1, 8)
+	// drop the last child of a node, as if a split had gone wrong
+	broken := tree.root.children[1]
+	broken.children = broken.children[:1]
+
+	err := tree.Put(8, 0)
+	assert.ErrorIs(t, err, ErrInvariant)
+	assert.False(t, errors.Is(err, ErrNotFound))
+	assertValidTree(t, tree, 7)
+
+	assert.NoError(t, tree.Put(0, 0), "keys going to healthy nodes still work")
+	assertValidTree(t, tree, 8)
+}
@@ -0,0 +1,160 @@
+package btree
+
+import "fmt"
+
+// Hooks are called synchronously right after Put or Delete changed the tree,
+// once the tree is consistent again, so they may read it (but not modify
+// it). Like every other method they must be registered and cancelled from
+// the goroutine that uses the tree.
+//
+// Only Put and Delete report changes. Bulk operations that build trees
+// directly (ReadFrom, UnmarshalJSON, SplitAt, Join, the set operations) don't,
+// and the trees they return start without hooks.
+
+type hook[F any] struct {
+	id int
+	fn F
+}
+
+type hooks[K comparable, V any] struct {
+	nextID  int
+	inserts []hook[func(K, V)]
+	updates []hook[func(K, V, V)]
+	deletes []hook[func(K, V)]
+}
+
+// the notify methods are safe on a nil *hooks, a tree without hooks pays a
+// nil check per change
+
+func (h *hooks[K, V]) inserted(key K, value V) {
+	if h == nil {
+		return
+	}
+	for _, hk := range h.inserts {
+		hk.fn(key, value)
+	}
+}
+
+func (h *hooks[K, V]) updated(key K, old, value V) {
+	if h == nil {
+		return
+	}
+	for _, hk := range h.updates {
+		hk.fn(key, old, value)
+	}
+}
+
+func (h *hooks[K, V]) deleted(key K, old V) {
+	if h == nil {
+		return
+	}
+	for _, hk := range h.deletes {
+		hk.fn(key, old)
+	}
+}
+
+// register adds fn to list and returns the func that takes it out again
+func register[K comparable, V any, F any](t *BTree[K, V], list func(*hooks[K, V]) *[]hook[F], fn F) (cancel func()) {
+	if t.hooks == nil {
+		t.hooks = &hooks[K, V]{}
+	}
+	h := t.hooks
+	h.nextID++
+	id := h.nextID
+	*list(h) = append(*list(h), hook[F]{id: id, fn: fn})
+	return func() {
+		l := list(h)
+		for i, hk := range *l {
+			if hk.id == id {
+				// copy so a notification in progress keeps its own slice
+				*l = append((*l)[:i:i], (*l)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// OnInsert registers fn to be called for every new key, calling cancel stops it
+func (t *BTree[K, V]) OnInsert(fn func(key K, value V)) (cancel func()) {
+	return register(t, func(h *hooks[K, V]) *[]hook[func(K, V)] { return &h.inserts }, fn)
+}
+
+// OnUpdate registers fn to be called when Put replaces the value of a key
+// already in the tree
+func (t *BTree[K, V]) OnUpdate(fn func(key K, old, value V)) (cancel func()) {
+	return register(t, func(h *hooks[K, V]) *[]hook[func(K, V, V)] { return &h.updates }, fn)
+}
+
+// OnDelete registers fn to be called with every key removed and its last value
+func (t *BTree[K, V]) OnDelete(fn func(key K, old V)) (cancel func()) {
+	return register(t, func(h *hooks[K, V]) *[]hook[func(K, V)] { return &h.deletes }, fn)
+}
+
+// EventKind tells what happened to a key
+type EventKind int
+
+const (
+	Inserted EventKind = iota
+	Updated
+	Deleted
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Inserted:
+		return "insert"
+	case Updated:
+		return "update"
+	case Deleted:
+		return "delete"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a change to one key delivered by Watch. Old is the value before
+// an update or a delete, New the value after an insert or an update.
+type Event[K comparable, V any] struct {
+	Kind EventKind
+	Key  K
+	Old  V
+	New  V
+}
+
+// Watch returns a channel with the changes to the keys in [lo, hi], in the
+// order they happen. The channel has room for buffer events, once it is full
+// Put and Delete block until the receiver catches up, so a watcher must keep
+// reading until it calls cancel, which closes the channel.
+func (t *BTree[K, V]) Watch(lo, hi K, buffer int) (events <-chan Event[K, V], cancel func()) {
+	ch := make(chan Event[K, V], buffer)
+	in := func(key K) bool {
+		return t.Less(key, lo) >= 0 && t.Less(key, hi) <= 0
+	}
+	cancels := []func(){
+		t.OnInsert(func(key K, value V) {
+			if in(key) {
+				ch <- Event[K, V]{Kind: Inserted, Key: key, New: value}
+			}
+		}),
+		t.OnUpdate(func(key K, old, value V) {
+			if in(key) {
+				ch <- Event[K, V]{Kind: Updated, Key: key, Old: old, New: value}
+			}
+		}),
+		t.OnDelete(func(key K, old V) {
+			if in(key) {
+				ch <- Event[K, V]{Kind: Deleted, Key: key, Old: old}
+			}
+		}),
+	}
+	var done bool
+	return ch, func() {
+		if done {
+			return
+		}
+		done = true
+		for _, c := range cancels {
+			c()
+		}
+		close(ch)
+	}
+}
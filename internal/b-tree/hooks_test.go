@@ -0,0 +1,120 @@
+package btree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	tree := NewBTree[int, string](3, cmpInt)
+	var log []string
+	tree.OnInsert(func(k int, v string) { log = append(log, "insert", v) })
+	tree.OnUpdate(func(k int, old, v string) { log = append(log, "update", old, v) })
+	tree.OnDelete(func(k int, old string) { log = append(log, "delete", old) })
+
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		tree.Put(i, v)
+	}
+	assert.Equal(t, []string{"insert", "a", "insert", "b", "insert", "c", "insert", "d", "insert", "e"}, log)
+
+	// 1 lives in an internal node, 4 in a leaf
+	log = nil
+	assert.False(t, tree.isLeaf(tree.root))
+	tree.Put(1, "B")
+	tree.Put(4, "E")
+	assert.Equal(t, []string{"update", "b", "B", "update", "e", "E"}, log)
+
+	log = nil
+	assert.NoError(t, tree.Delete(1))
+	assert.ErrorIs(t, tree.Delete(1), ErrNotFound)
+	assert.Equal(t, []string{"delete", "B"}, log)
+}
+
+func TestHooksSeeTheChangedTree(t *testing.T) {
+	tree := NewBTree[int, int](3, cmpInt)
+	tree.OnInsert(func(k, v int) {
+		got, ok := tree.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, v, got)
+		assertValidStructure(t, tree, tree.root)
+	})
+	tree.OnDelete(func(k, _ int) {
+		_, ok := tree.Get(k)
+		assert.False(t, ok)
+	})
+	for i := range 20 {
+		tree.Put(i, i)
+	}
+	for i := range 20 {
+		tree.Delete(i)
+	}
+}
+
+func TestCancelHook(t *testing.T) {
+	tree := NewBTree[int, int](3, cmpInt)
+	var first, second, once int
+	cancelFirst := tree.OnInsert(func(int, int) { first++ })
+	tree.OnInsert(func(int, int) { second++ })
+	var cancelOnce func()
+	cancelOnce = tree.OnInsert(func(int, int) {
+		once++
+		cancelOnce() // cancelling from inside a hook is fine
+	})
+
+	tree.Put(1, 1)
+	cancelFirst()
+	cancelFirst() // twice is a no-op
+	tree.Put(2, 2)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+	assert.Equal(t, 1, once)
+}
+
+func TestWatch(t *testing.T) {
+	tree := NewBTree[int, string](4, cmpInt)
+	events, cancel := tree.Watch(10, 20, 16)
+
+	tree.Put(5, "out")
+	tree.Put(10, "a")
+	tree.Put(20, "b")
+	tree.Put(21, "out")
+	tree.Put(10, "A")
+	tree.Delete(20)
+	tree.Delete(5)
+	cancel()
+	tree.Put(15, "after cancel")
+	cancel()
+
+	var got []Event[int, string]
+	for e := range events {
+		got = append(got, e)
+	}
+	assert.Equal(t, []Event[int, string]{
+		{Kind: Inserted, Key: 10, New: "a"},
+		{Kind: Inserted, Key: 20, New: "b"},
+		{Kind: Updated, Key: 10, Old: "a", New: "A"},
+		{Kind: Deleted, Key: 20, Old: "b"},
+	}, got)
+	assert.Equal(t, "update", Updated.String())
+}
+
+func TestWatchUnbuffered(t *testing.T) {
+	tree := NewBTree[int, int](3, cmpInt)
+	events, cancel := tree.Watch(0, 99, 0)
+	done := make(chan []int)
+	go func() {
+		var keys []int
+		for e := range events {
+			keys = append(keys, e.Key)
+		}
+		done <- keys
+	}()
+	for i := range 100 {
+		tree.Put(i*2, i) // only the first 50 are in range
+	}
+	cancel()
+	keys := <-done
+	assert.Len(t, keys, 50)
+	assert.Equal(t, 98, keys[49])
+}
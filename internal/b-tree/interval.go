@@ -0,0 +1,129 @@
+package btree
+
+import (
+	"cmp"
+	"iter"
+)
+
+// Interval is the closed range [Start, End]
+type Interval[T cmp.Ordered] struct {
+	Start T
+	End   T
+}
+
+// Overlaps reports whether both intervals share at least one point
+func (iv Interval[T]) Overlaps(other Interval[T]) bool {
+	return iv.Start <= other.End && other.Start <= iv.End
+}
+
+func compareIntervals[T cmp.Ordered](a, b Interval[T]) int {
+	if c := cmp.Compare(a.Start, b.Start); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.End, b.End)
+}
+
+// maxEnd is the aggregate kept by the interval tree, empty subtrees have no
+// end at all since T has no natural minimum value
+type maxEnd[T cmp.Ordered] struct {
+	end   T
+	valid bool
+}
+
+func maxEndMonoid[T cmp.Ordered, V any]() Monoid[Interval[T], V, maxEnd[T]] {
+	return Monoid[Interval[T], V, maxEnd[T]]{
+		Identity: maxEnd[T]{},
+		Combine: func(a, b maxEnd[T]) maxEnd[T] {
+			if !a.valid || (b.valid && b.end > a.end) {
+				return b
+			}
+			return a
+		},
+		Measure: func(iv Interval[T], _ V) maxEnd[T] {
+			return maxEnd[T]{end: iv.End, valid: true}
+		},
+	}
+}
+
+// IntervalTree stores intervals ordered by start (ties broken by end) in a
+// B-tree where every node caches the greatest end of its subtree. That is
+// enough to skip whole subtrees that end before the query starts, while the
+// ordering by start cuts the search once intervals begin after the query.
+//
+// The same interval inserted twice keeps only the last value, like Put does.
+type IntervalTree[T cmp.Ordered, V any] struct {
+	tree *Augmented[Interval[T], V, maxEnd[T]]
+}
+
+// NewIntervalTree creates an interval tree backed by a B-tree of the given degree
+func NewIntervalTree[T cmp.Ordered, V any](order int) *IntervalTree[T, V] {
+	return &IntervalTree[T, V]{
+		tree: NewAugmented[Interval[T], V](order, compareIntervals[T], maxEndMonoid[T, V]()),
+	}
+}
+
+// Insert adds the interval, it fails with ErrInvalidInterval when Start is
+// after End
+func (it *IntervalTree[T, V]) Insert(iv Interval[T], value V) error {
+	if iv.Start > iv.End {
+		return ErrInvalidInterval
+	}
+	return it.tree.Put(iv, value)
+}
+
+// Delete removes exactly the given interval
+func (it *IntervalTree[T, V]) Delete(iv Interval[T]) error {
+	return it.tree.Delete(iv)
+}
+
+func (it *IntervalTree[T, V]) Get(iv Interval[T]) (V, bool) {
+	return it.tree.Get(iv)
+}
+
+func (it *IntervalTree[T, V]) Len() int {
+	return it.tree.Len()
+}
+
+// Overlapping iterates, ordered by start, over the intervals sharing at least
+// one point with [a, b]
+func (it *IntervalTree[T, V]) Overlapping(a, b T) iter.Seq2[Interval[T], V] {
+	return func(yield func(Interval[T], V) bool) {
+		if it.tree.root == nil || a > b {
+			return
+		}
+		it.overlapping(it.tree.root, Interval[T]{Start: a, End: b}, yield)
+	}
+}
+
+// Stabbing iterates, ordered by start, over the intervals containing p
+func (it *IntervalTree[T, V]) Stabbing(p T) iter.Seq2[Interval[T], V] {
+	return it.Overlapping(p, p)
+}
+
+// overlapping returns false once the traversal must stop, either because
+// yield asked for it or because every remaining interval starts after q
+func (it *IntervalTree[T, V]) overlapping(
+	node *Node[Interval[T], V],
+	q Interval[T],
+	yield func(Interval[T], V) bool,
+) bool {
+	if agg := it.tree.aggOf(node); !agg.valid || agg.end < q.Start {
+		return true // nothing in this subtree reaches the query
+	}
+	leaf := it.tree.isLeaf(node)
+	for i, key := range node.keys {
+		if !leaf && !it.overlapping(node.children[i], q, yield) {
+			return false
+		}
+		if key.Start > q.End {
+			return false
+		}
+		if key.Overlaps(q) && !yield(key, node.values[i]) {
+			return false
+		}
+	}
+	if !leaf {
+		return it.overlapping(node.children[len(node.children)-1], q, yield)
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package btree
+
+import (
+	"iter"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectIntervals[V any](seq iter.Seq2[Interval[int], V]) []Interval[int] {
+	var got []Interval[int]
+	for iv := range seq {
+		got = append(got, iv)
+	}
+	return got
+}
+
+func bruteOverlapping(ref map[Interval[int]]int, a, b int) []Interval[int] {
+	var want []Interval[int]
+	for iv := range ref {
+		if iv.Overlaps(Interval[int]{a, b}) {
+			want = append(want, iv)
+		}
+	}
+	slices.SortFunc(want, compareIntervals[int])
+	return want
+}
+
+func TestIntervalTreeAgainstBruteForce(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		tree := NewIntervalTree[int, int](order)
+		ref := map[Interval[int]]int{}
+		r := rand.New(rand.NewSource(int64(order)))
+
+		for i := 0; i < 2000; i++ {
+			start := r.Intn(500)
+			iv := Interval[int]{start, start + r.Intn(60)}
+			if r.Intn(4) == 0 && len(ref) > 0 {
+				// delete an existing interval
+				for existing := range ref {
+					iv = existing
+					break
+				}
+				assert.NoError(t, tree.Delete(iv))
+				delete(ref, iv)
+			} else {
+				tree.Insert(iv, i)
+				ref[iv] = i
+			}
+			assert.Equal(t, len(ref), tree.Len())
+
+			if i%50 != 0 {
+				continue
+			}
+			for q := 0; q < 10; q++ {
+				a := r.Intn(600) - 50
+				b := a + r.Intn(40)
+				assert.Equal(t, bruteOverlapping(ref, a, b), collectIntervals(tree.Overlapping(a, b)), "[%d, %d]", a, b)
+				assert.Equal(t, bruteOverlapping(ref, a, a), collectIntervals(tree.Stabbing(a)), "point %d", a)
+			}
+		}
+	}
+}
+
+func TestIntervalTreeQueries(t *testing.T) {
+	tree := NewIntervalTree[int, string](3)
+	tree.Insert(Interval[int]{1, 5}, "a")
+	tree.Insert(Interval[int]{3, 3}, "b")
+	tree.Insert(Interval[int]{4, 10}, "c")
+	tree.Insert(Interval[int]{11, 12}, "d")
+	tree.Insert(Interval[int]{1, 5}, "a2") // same interval, value replaced
+
+	assert.Equal(t, 4, tree.Len())
+	assert.Equal(t, []Interval[int]{{1, 5}, {3, 3}}, collectIntervals(tree.Stabbing(3)))
+	assert.Equal(t, []Interval[int]{{4, 10}, {11, 12}}, collectIntervals(tree.Overlapping(6, 11)))
+	assert.Empty(t, collectIntervals(tree.Overlapping(13, 20)))
+	assert.Empty(t, collectIntervals(tree.Overlapping(5, 4)))
+
+	v, found := tree.Get(Interval[int]{1, 5})
+	assert.True(t, found)
+	assert.Equal(t, "a2", v)
+
+	for iv, v := range tree.Stabbing(4) {
+		assert.Equal(t, Interval[int]{1, 5}, iv, "stops after the first yield")
+		assert.Equal(t, "a2", v)
+		break
+	}
+	assert.ErrorIs(t, tree.Insert(Interval[int]{2, 1}, ""), ErrInvalidInterval)
+}
@@ -0,0 +1,54 @@
+package btree
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// jsonItem is how an entry looks in JSON, {"key": ..., "value": ...}
+type jsonItem[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// MarshalJSON encodes the tree as an array of {"key", "value"} objects in key
+// order, which a JSON object (or a Go map) would lose
+func (t *BTree[K, V]) MarshalJSON() ([]byte, error) {
+	items := make([]jsonItem[K, V], 0, t.size)
+	for k, v := range t.All() {
+		items = append(items, jsonItem[K, V]{Key: k, Value: v})
+	}
+	return json.Marshal(items)
+}
+
+// UnmarshalJSON replaces the contents of the tree with the entries of an
+// array written by MarshalJSON. The entries don't have to be sorted, when a
+// key shows up more than once the last value wins, like with Put. The tree
+// must come from NewBTree since JSON carries no comparator.
+func (t *BTree[K, V]) UnmarshalJSON(data []byte) error {
+	if t.less == nil {
+		return errors.New("btree: UnmarshalJSON needs a tree created with NewBTree")
+	}
+	var decoded []jsonItem[K, V]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	items := make([]Item[K, V], len(decoded))
+	for i, d := range decoded {
+		items[i] = Item[K, V]{Key: d.Key, Value: d.Value}
+	}
+	// stable, so among equal keys the last one is still the last one
+	slices.SortStableFunc(items, func(a, b Item[K, V]) int { return t.Less(a.Key, b.Key) })
+	unique := items[:0]
+	for _, item := range items {
+		if n := len(unique); n > 0 && t.Less(unique[n-1].Key, item.Key) == 0 {
+			unique[n-1] = item
+			continue
+		}
+		unique = append(unique, item)
+	}
+	t.buildSorted(unique)
+	return nil
+}
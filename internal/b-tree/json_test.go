@@ -0,0 +1,58 @@
+package btree
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	tree := NewBTree[string, int](3, strings.Compare)
+	for i, k := range []string{"b", "c", "a"} {
+		tree.Put(k, i)
+	}
+	data, err := json.Marshal(tree)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"key":"a","value":2},{"key":"b","value":0},{"key":"c","value":1}]`, string(data))
+
+	data, err = json.Marshal(NewBTree[string, int](3, strings.Compare))
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", string(data))
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tree := NewBTree[int, string](3, cmpInt)
+	tree.Put(100, "replaced")
+	err := json.Unmarshal([]byte(`[
+		{"key": 3, "value": "c"},
+		{"key": 1, "value": "a"},
+		{"key": 2, "value": "old"},
+		{"key": 2, "value": "b"}
+	]`), tree)
+	assert.NoError(t, err)
+	assertValidTree(t, tree, 3)
+	data, err := json.Marshal(tree)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"key":1,"value":"a"},{"key":2,"value":"b"},{"key":3,"value":"c"}]`, string(data))
+
+	// round trip of a bigger tree
+	big := sequentialTree(4, 0, 500)
+	data, err = json.Marshal(big)
+	assert.NoError(t, err)
+	restored := NewBTree[int, int](6, cmpInt)
+	assert.NoError(t, json.Unmarshal(data, restored))
+	assertValidTree(t, restored, 500)
+	assertSameContents(t, big.All(), restored.All())
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	var zero BTree[int, int]
+	assert.Error(t, json.Unmarshal([]byte(`[]`), &zero))
+
+	tree := sequentialTree(3, 0, 10)
+	assert.Error(t, json.Unmarshal([]byte(`{"0": 1}`), tree))
+	assert.Error(t, json.Unmarshal([]byte(`[{"key": "x", "value": 1}]`), tree))
+	assert.Equal(t, 10, tree.Len(), "a failed decode leaves the tree alone")
+}
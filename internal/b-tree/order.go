@@ -0,0 +1,167 @@
+package btree
+
+import "iter"
+
+// Building comparators for multi-column keys instead of writing them by
+// hand: every column is a comparator over the whole key, usually made with
+// ByField, and Compare chains them, the first column that differs decides.
+//
+//	tenant := ByField(func(k key) string { return k.Tenant }, strings.Compare)
+//	created := ByField(func(k key) time.Time { return k.Created }, Desc(time.Time.Compare))
+//	tree := NewBTree[key, V](32, Compare(tenant, created))
+//
+// A comparator made of the leading columns only is what Matching takes to
+// scan every key that starts with the same columns.
+
+// Column compares two keys by one of their columns
+type Column[K any] func(a, b K) int
+
+// Compare orders keys by each column in turn
+func Compare[K any](columns ...Column[K]) Comparator[K] {
+	return func(a, b K) int {
+		for _, column := range columns {
+			if c := column(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
+
+// ByField is the column holding what field returns, ordered by cmp
+func ByField[K, F any](field func(K) F, cmp func(a, b F) int) Column[K] {
+	return func(a, b K) int {
+		return cmp(field(a), field(b))
+	}
+}
+
+// Desc reverses cmp, for columns sorted in descending order
+func Desc[T any](cmp func(a, b T) int) func(a, b T) int {
+	return func(a, b T) int {
+		return cmp(b, a)
+	}
+}
+
+// Collate compares strings by what key turns them into, strings.ToLower
+// gives case insensitive keys. Keys that collate equal are the same key for
+// the tree.
+func Collate(key func(string) string) func(a, b string) int {
+	return func(a, b string) int {
+		ka, kb := key(a), key(b)
+		switch {
+		case ka < kb:
+			return -1
+		case ka > kb:
+			return 1
+		}
+		return 0
+	}
+}
+
+// Null is a column value that may be missing, like a SQL NULL
+type Null[T comparable] struct {
+	Value T
+	Valid bool
+}
+
+// Some returns a present value
+func Some[T comparable](v T) Null[T] {
+	return Null[T]{Value: v, Valid: true}
+}
+
+// NullsFirst orders missing values before every present one, which are
+// ordered by cmp. Two missing values are equal.
+func NullsFirst[T comparable](cmp func(a, b T) int) func(a, b Null[T]) int {
+	return func(a, b Null[T]) int {
+		switch {
+		case !a.Valid && !b.Valid:
+			return 0
+		case !a.Valid:
+			return -1
+		case !b.Valid:
+			return 1
+		}
+		return cmp(a.Value, b.Value)
+	}
+}
+
+// NullsLast orders missing values after every present one
+func NullsLast[T comparable](cmp func(a, b T) int) func(a, b Null[T]) int {
+	first := NullsFirst(cmp)
+	return func(a, b Null[T]) int {
+		if a.Valid != b.Valid {
+			return -first(a, b)
+		}
+		return first(a, b)
+	}
+}
+
+// Tuple2 and Tuple3 are ready made multi-column keys
+type Tuple2[A, B comparable] struct {
+	A A
+	B B
+}
+
+type Tuple3[A, B, C comparable] struct {
+	A A
+	B B
+	C C
+}
+
+// CompareTuple2 orders tuples by A with ca, then by B with cb
+func CompareTuple2[A, B comparable](ca func(x, y A) int, cb func(x, y B) int) Comparator[Tuple2[A, B]] {
+	return Compare(
+		ByField(func(t Tuple2[A, B]) A { return t.A }, ca),
+		ByField(func(t Tuple2[A, B]) B { return t.B }, cb),
+	)
+}
+
+// CompareTuple3 orders tuples by A, B and then C
+func CompareTuple3[A, B, C comparable](
+	ca func(x, y A) int,
+	cb func(x, y B) int,
+	cc func(x, y C) int,
+) Comparator[Tuple3[A, B, C]] {
+	return Compare(
+		ByField(func(t Tuple3[A, B, C]) A { return t.A }, ca),
+		ByField(func(t Tuple3[A, B, C]) B { return t.B }, cb),
+		ByField(func(t Tuple3[A, B, C]) C { return t.C }, cc),
+	)
+}
+
+// Matching returns an iterator over the keys equal to probe according to
+// prefix, in key order. prefix must be coarser than the order of the tree,
+// typically its leading columns, so the matching keys are all together:
+//
+//	// every key of tenant "acme", whatever the other columns hold
+//	tree.Matching(key{Tenant: "acme"}, Compare(tenant))
+//
+// Only the path to the first match is searched.
+func (t *BTree[K, V]) Matching(probe K, prefix func(a, b K) int) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if t.root != nil {
+			t.walkMatching(t.root, probe, prefix, yield)
+		}
+	}
+}
+
+// walkMatching returns false once yield asked to stop or a key past the
+// matches shows up
+func (t *BTree[K, V]) walkMatching(node *Node[K, V], probe K, prefix func(a, b K) int, yield func(K, V) bool) bool {
+	// BinarySearch returns the first of many equal keys, which the other
+	// strategies don't promise
+	keys := t.keysOf(node)
+	index, _ := BinarySearch(keys, probe, prefix)
+	if !t.isLeaf(node) && !t.walkMatching(node.children[index], probe, prefix, yield) {
+		return false
+	}
+	for i := index; i < len(keys); i++ {
+		if prefix(keys[i], probe) > 0 || !yield(keys[i], node.values[i]) {
+			return false
+		}
+		if !t.isLeaf(node) && !t.walkMatching(node.children[i+1], probe, prefix, yield) {
+			return false
+		}
+	}
+	return true
+}
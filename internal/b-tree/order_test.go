@@ -0,0 +1,129 @@
+package btree
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type event struct {
+	Tenant string
+	Day    int
+	Name   string
+}
+
+var (
+	byTenant = ByField(func(e event) string { return e.Tenant }, strings.Compare)
+	byDay    = ByField(func(e event) int { return e.Day }, Desc(cmp.Compare[int]))
+	byName   = ByField(func(e event) string { return e.Name }, Collate(strings.ToLower))
+)
+
+func TestCompareColumns(t *testing.T) {
+	order := Compare(byTenant, byDay, byName)
+	events := []event{
+		{"b", 1, "x"},
+		{"a", 1, "y"},
+		{"a", 3, "x"},
+		{"a", 1, "X"}, // same key as {"a", 1, "x"} for the collation
+		{"a", 1, "w"},
+	}
+	slices.SortStableFunc(events, order)
+	assert.Equal(t, []event{
+		{"a", 3, "x"}, // newest first
+		{"a", 1, "w"},
+		{"a", 1, "X"},
+		{"a", 1, "y"},
+		{"b", 1, "x"},
+	}, events)
+	assert.Zero(t, order(event{"a", 1, "abc"}, event{"a", 1, "ABC"}))
+	assert.Zero(t, Compare[event]()(events[0], events[4]), "no columns, everything is equal")
+}
+
+func TestNullOrdering(t *testing.T) {
+	values := []Null[int]{Some(2), {}, Some(-1), {}}
+	first := slices.Clone(values)
+	slices.SortStableFunc(first, NullsFirst(cmp.Compare[int]))
+	assert.Equal(t, []Null[int]{{}, {}, Some(-1), Some(2)}, first)
+
+	last := slices.Clone(values)
+	slices.SortStableFunc(last, NullsLast(cmp.Compare[int]))
+	assert.Equal(t, []Null[int]{Some(-1), Some(2), {}, {}}, last)
+
+	desc := slices.Clone(values)
+	slices.SortStableFunc(desc, NullsLast(Desc(cmp.Compare[int])))
+	assert.Equal(t, []Null[int]{Some(2), Some(-1), {}, {}}, desc)
+}
+
+func TestTupleKeys(t *testing.T) {
+	tree := NewBTree[Tuple3[string, Null[int], string], int](4,
+		CompareTuple3(strings.Compare, NullsLast(cmp.Compare[int]), strings.Compare))
+	tree.Put(Tuple3[string, Null[int], string]{"a", Some(2), "x"}, 1)
+	tree.Put(Tuple3[string, Null[int], string]{"a", Null[int]{}, "x"}, 2)
+	tree.Put(Tuple3[string, Null[int], string]{"a", Some(1), "z"}, 3)
+	tree.Put(Tuple3[string, Null[int], string]{"a", Some(1), "y"}, 4)
+	tree.Put(Tuple3[string, Null[int], string]{"a", Some(2), "x"}, 5) // same key
+
+	var values []int
+	for _, v := range tree.All() {
+		values = append(values, v)
+	}
+	assert.Equal(t, []int{4, 3, 5, 2}, values)
+
+	pairs := NewBTree[Tuple2[int, string], bool](3, CompareTuple2(cmp.Compare[int], Desc(strings.Compare)))
+	pairs.Put(Tuple2[int, string]{1, "a"}, true)
+	pairs.Put(Tuple2[int, string]{1, "b"}, true)
+	pairs.Put(Tuple2[int, string]{0, "c"}, true)
+	assert.Equal(t,
+		[]Tuple2[int, string]{{0, "c"}, {1, "b"}, {1, "a"}},
+		collectKeys(pairs.All()))
+}
+
+func TestMatching(t *testing.T) {
+	order := Compare(byTenant, byDay, byName)
+	for _, degree := range []int{3, 4, 7} {
+		tree := NewBTree[event, int](degree, order)
+		var all []event
+		for i, tenant := range []string{"a", "b", "c", "d"} {
+			for day := range 10 {
+				for _, name := range []string{"p", "q", "r"} {
+					e := event{tenant, day, name}
+					tree.Put(e, i)
+					all = append(all, e)
+				}
+			}
+		}
+		slices.SortFunc(all, order)
+
+		want := func(match func(event) bool) []event {
+			var out []event
+			for _, e := range all {
+				if match(e) {
+					out = append(out, e)
+				}
+			}
+			return out
+		}
+		for _, tenant := range []string{"a", "b", "d"} {
+			got := collectKeys(tree.Matching(event{Tenant: tenant}, Compare(byTenant)))
+			assert.Equal(t, want(func(e event) bool { return e.Tenant == tenant }), got, "degree %d tenant %s", degree, tenant)
+		}
+		got := collectKeys(tree.Matching(event{Tenant: "c", Day: 4}, Compare(byTenant, byDay)))
+		assert.Equal(t, want(func(e event) bool { return e.Tenant == "c" && e.Day == 4 }), got)
+		assert.Empty(t, collectKeys(tree.Matching(event{Tenant: "bb"}, Compare(byTenant))))
+		assert.Empty(t, collectKeys(tree.Matching(event{Tenant: "z"}, Compare(byTenant))))
+
+		// stopping early
+		n := 0
+		for range tree.Matching(event{Tenant: "b"}, Compare(byTenant)) {
+			n++
+			if n == 5 {
+				break
+			}
+		}
+		assert.Equal(t, 5, n, fmt.Sprint(degree))
+	}
+}
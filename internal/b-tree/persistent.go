@@ -0,0 +1,296 @@
+package btree
+
+import (
+	"iter"
+	"slices"
+)
+
+// pnode is the node of a PersistentBTree. Once a node is reachable from a
+// tree it is never modified again, so it has no parent pointer: the same node
+// can belong to many versions at the same time.
+type pnode[K comparable, V any] struct {
+	entries  []*Item[K, V]
+	children []*pnode[K, V]
+}
+
+func (n *pnode[K, V]) isLeaf() bool {
+	return len(n.children) == 0
+}
+
+// clone returns a private copy of the node that can be modified freely
+func (n *pnode[K, V]) clone() *pnode[K, V] {
+	return &pnode[K, V]{entries: slices.Clone(n.entries), children: slices.Clone(n.children)}
+}
+
+// PersistentBTree is an immutable B-tree: Put and Delete leave the receiver
+// untouched and return a new version. Only the nodes on the path from the
+// root to the change are copied, everything else is shared with the previous
+// version, so keeping every version around costs O(log n) per change.
+type PersistentBTree[K comparable, V any] struct {
+	root  *pnode[K, V]
+	order int
+	less  Comparator[K]
+	size  int
+}
+
+// NewPersistentBTree creates an empty persistent B-tree with the given degree
+func NewPersistentBTree[K comparable, V any](order int, less Comparator[K]) *PersistentBTree[K, V] {
+	if order < 3 {
+		panic("Invalid degree, should be at least 3")
+	}
+	return &PersistentBTree[K, V]{order: order, less: less}
+}
+
+func (p *PersistentBTree[K, V]) maxEntries() int {
+	return p.order - 1
+}
+
+func (p *PersistentBTree[K, V]) minEntries() int {
+	return (p.order+1)/2 - 1
+}
+
+func (p *PersistentBTree[K, V]) middle() int {
+	return (p.order - 1) / 2
+}
+
+// with returns a new version sharing the configuration of p
+func (p *PersistentBTree[K, V]) with(root *pnode[K, V], size int) *PersistentBTree[K, V] {
+	return &PersistentBTree[K, V]{root: root, order: p.order, less: p.less, size: size}
+}
+
+func (p *PersistentBTree[K, V]) Len() int {
+	return p.size
+}
+
+func (p *PersistentBTree[K, V]) searchKeyIndex(node *pnode[K, V], key K) (int, bool) {
+	low, high := 0, len(node.entries)-1
+	for low <= high {
+		mid := (low + high) / 2
+		switch c := p.less(key, node.entries[mid].Key); {
+		case c == 0:
+			return mid, true
+		case c > 0:
+			low = mid + 1
+		default:
+			high = mid - 1
+		}
+	}
+	return low, false
+}
+
+func (p *PersistentBTree[K, V]) Get(key K) (value V, found bool) {
+	for node := p.root; node != nil; {
+		index, found := p.searchKeyIndex(node, key)
+		if found {
+			return node.entries[index].Value, true
+		}
+		if node.isLeaf() {
+			break
+		}
+		node = node.children[index]
+	}
+	return value, false
+}
+
+// Put returns a new version of the tree where key maps to value
+func (p *PersistentBTree[K, V]) Put(key K, value V) *PersistentBTree[K, V] {
+	item := &Item[K, V]{Key: key, Value: value}
+	if p.root == nil {
+		return p.with(&pnode[K, V]{entries: []*Item[K, V]{item}}, 1)
+	}
+	left, median, right, added := p.insert(p.root, item)
+	root := left
+	if median != nil { // the root itself was split
+		root = &pnode[K, V]{entries: []*Item[K, V]{median}, children: []*pnode[K, V]{left, right}}
+	}
+	size := p.size
+	if added {
+		size++
+	}
+	return p.with(root, size)
+}
+
+// insert copies the path down to the leaf where item belongs. When the copy
+// of node overflows it is split and the median goes back to the caller,
+// which places it in its own copy, like splitNonRoot does in place.
+func (p *PersistentBTree[K, V]) insert(
+	node *pnode[K, V],
+	item *Item[K, V],
+) (left *pnode[K, V], median *Item[K, V], right *pnode[K, V], added bool) {
+	index, found := p.searchKeyIndex(node, item.Key)
+	c := node.clone()
+	if found {
+		c.entries[index] = item
+		return c, nil, nil, false
+	}
+
+	if node.isLeaf() {
+		c.entries = slices.Insert(c.entries, index, item)
+		added = true
+	} else {
+		var child, childRight *pnode[K, V]
+		var childMedian *Item[K, V]
+		child, childMedian, childRight, added = p.insert(node.children[index], item)
+		c.children[index] = child
+		if childMedian != nil {
+			c.entries = slices.Insert(c.entries, index, childMedian)
+			c.children = slices.Insert(c.children, index+1, childRight)
+		}
+	}
+
+	if len(c.entries) <= p.maxEntries() {
+		return c, nil, nil, added
+	}
+	middle := p.middle()
+	left = &pnode[K, V]{entries: slices.Clone(c.entries[:middle])}
+	right = &pnode[K, V]{entries: slices.Clone(c.entries[middle+1:])}
+	if !c.isLeaf() {
+		left.children = slices.Clone(c.children[:middle+1])
+		right.children = slices.Clone(c.children[middle+1:])
+	}
+	return left, c.entries[middle], right, added
+}
+
+// Delete returns a new version of the tree without key, or the receiver and
+// an error when the key is not there
+func (p *PersistentBTree[K, V]) Delete(key K) (*PersistentBTree[K, V], error) {
+	if p.root == nil {
+		return p, ErrEmpty
+	}
+	root, found := p.delete(p.root, key)
+	if !found {
+		return p, ErrNotFound
+	}
+	// collapse a root left without entries
+	if len(root.entries) == 0 {
+		if root.isLeaf() {
+			root = nil
+		} else {
+			root = root.children[0]
+		}
+	}
+	return p.with(root, p.size-1), nil
+}
+
+// delete returns a copy of node without key. Like the mutable tree, an entry
+// of an internal node is replaced by its predecessor, which is then removed
+// from the leaf it lives in. Underflows are fixed by the parent on the way up.
+func (p *PersistentBTree[K, V]) delete(node *pnode[K, V], key K) (*pnode[K, V], bool) {
+	index, found := p.searchKeyIndex(node, key)
+	if node.isLeaf() {
+		if !found {
+			return node, false
+		}
+		c := node.clone()
+		c.entries = slices.Delete(c.entries, index, index+1)
+		return c, true
+	}
+
+	var child *pnode[K, V]
+	if found {
+		var predecessor *Item[K, V]
+		child, predecessor = p.deleteMax(node.children[index])
+		node = node.clone()
+		node.entries[index] = predecessor
+	} else {
+		child, found = p.delete(node.children[index], key)
+		if !found {
+			return node, false
+		}
+		node = node.clone()
+	}
+	node.children[index] = child
+	p.fixChild(node, index)
+	return node, true
+}
+
+// deleteMax returns a copy of the subtree without its greatest entry
+func (p *PersistentBTree[K, V]) deleteMax(node *pnode[K, V]) (*pnode[K, V], *Item[K, V]) {
+	c := node.clone()
+	if c.isLeaf() {
+		last := c.entries[len(c.entries)-1]
+		c.entries = c.entries[:len(c.entries)-1]
+		return c, last
+	}
+	last := len(c.children) - 1
+	child, item := p.deleteMax(c.children[last])
+	c.children[last] = child
+	p.fixChild(c, last)
+	return c, item
+}
+
+// fixChild restores the minimum occupancy of parent.children[index], parent
+// and that child must already be private copies. Siblings are copied before
+// being touched since they may be shared with older versions.
+func (p *PersistentBTree[K, V]) fixChild(parent *pnode[K, V], index int) {
+	child := parent.children[index]
+	if len(child.entries) >= p.minEntries() {
+		return
+	}
+
+	switch {
+	case index > 0 && len(parent.children[index-1].entries) > p.minEntries():
+		// borrow from left
+		left := parent.children[index-1].clone()
+		child.entries = slices.Insert(child.entries, 0, parent.entries[index-1])
+		parent.entries[index-1] = left.entries[len(left.entries)-1]
+		left.entries = left.entries[:len(left.entries)-1]
+		if !left.isLeaf() {
+			child.children = slices.Insert(child.children, 0, left.children[len(left.children)-1])
+			left.children = left.children[:len(left.children)-1]
+		}
+		parent.children[index-1] = left
+	case index < len(parent.children)-1 && len(parent.children[index+1].entries) > p.minEntries():
+		// borrow from right
+		right := parent.children[index+1].clone()
+		child.entries = append(child.entries, parent.entries[index])
+		parent.entries[index] = right.entries[0]
+		right.entries = slices.Delete(right.entries, 0, 1)
+		if !right.isLeaf() {
+			child.children = append(child.children, right.children[0])
+			right.children = slices.Delete(right.children, 0, 1)
+		}
+		parent.children[index+1] = right
+	case index > 0:
+		p.merge(parent, index-1)
+	default:
+		p.merge(parent, index)
+	}
+}
+
+// merge replaces children index and index+1 of parent, together with the
+// entry separating them, by a single new node
+func (p *PersistentBTree[K, V]) merge(parent *pnode[K, V], index int) {
+	left, right := parent.children[index], parent.children[index+1]
+	merged := &pnode[K, V]{
+		entries:  slices.Concat(left.entries, []*Item[K, V]{parent.entries[index]}, right.entries),
+		children: slices.Concat(left.children, right.children),
+	}
+	parent.entries = slices.Delete(parent.entries, index, index+1)
+	parent.children = slices.Delete(parent.children, index+1, index+2)
+	parent.children[index] = merged
+}
+
+// All returns an iterator over every key-value pair of this version in key order
+func (p *PersistentBTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if p.root != nil {
+			p.walk(p.root, yield)
+		}
+	}
+}
+
+func (p *PersistentBTree[K, V]) walk(node *pnode[K, V], yield func(K, V) bool) bool {
+	for i, entry := range node.entries {
+		if !node.isLeaf() && !p.walk(node.children[i], yield) {
+			return false
+		}
+		if !yield(entry.Key, entry.Value) {
+			return false
+		}
+	}
+	if !node.isLeaf() {
+		return p.walk(node.children[len(node.children)-1], yield)
+	}
+	return true
+}
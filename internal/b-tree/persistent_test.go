@@ -0,0 +1,109 @@
+package btree
+
+import (
+	"maps"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertValidPersistent checks the occupancy of every node and that all
+// leaves are at the same depth, returning that depth
+func assertValidPersistent[K comparable, V any](t *testing.T, p *PersistentBTree[K, V], node *pnode[K, V], isRoot bool) int {
+	assert.LessOrEqual(t, len(node.entries), p.maxEntries())
+	if !isRoot {
+		assert.GreaterOrEqual(t, len(node.entries), p.minEntries())
+	}
+	if node.isLeaf() {
+		return 1
+	}
+	assert.Equal(t, len(node.entries)+1, len(node.children))
+	depth := assertValidPersistent(t, p, node.children[0], false)
+	for _, child := range node.children[1:] {
+		assert.Equal(t, depth, assertValidPersistent(t, p, child, false))
+	}
+	return depth + 1
+}
+
+func assertVersion(t *testing.T, p *PersistentBTree[int, int], expected map[int]int) {
+	assert.Equal(t, len(expected), p.Len())
+	got := map[int]int{}
+	prev := -1
+	for k, v := range p.All() {
+		assert.Greater(t, k, prev, "keys in order")
+		prev = k
+		got[k] = v
+	}
+	assert.Equal(t, expected, got)
+	if p.root != nil {
+		assertValidPersistent(t, p, p.root, true)
+	}
+}
+
+func TestPersistentEveryVersionReadable(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		r := rand.New(rand.NewSource(int64(order)))
+		versions := []*PersistentBTree[int, int]{NewPersistentBTree[int, int](order, cmpInt)}
+		expected := []map[int]int{{}}
+
+		for i := 0; i < 1000; i++ {
+			last := versions[len(versions)-1]
+			state := maps.Clone(expected[len(expected)-1])
+			key := r.Intn(150)
+			if r.Intn(3) == 0 {
+				next, err := last.Delete(key)
+				_, ok := state[key]
+				assert.Equal(t, ok, err == nil)
+				if err != nil {
+					assert.Same(t, last, next)
+				}
+				delete(state, key)
+				versions = append(versions, next)
+			} else {
+				versions = append(versions, last.Put(key, i))
+				state[key] = i
+			}
+			expected = append(expected, state)
+		}
+
+		for i, version := range versions {
+			if i%50 == 0 || i == len(versions)-1 {
+				assertVersion(t, version, expected[i])
+			}
+		}
+	}
+}
+
+func TestPersistentSharesUnchangedNodes(t *testing.T) {
+	v1 := NewPersistentBTree[int, int](4, cmpInt)
+	for i := 0; i < 1000; i++ {
+		v1 = v1.Put(i, i)
+	}
+	v2 := v1.Put(0, -1)
+
+	value, _ := v1.Get(0)
+	assert.Equal(t, 0, value)
+	value, _ = v2.Get(0)
+	assert.Equal(t, -1, value)
+
+	assert.NotSame(t, v1.root, v2.root)
+	assert.NotSame(t, v1.root.children[0], v2.root.children[0], "the changed path is copied")
+	for i := 1; i < len(v1.root.children); i++ {
+		assert.Same(t, v1.root.children[i], v2.root.children[i], "the rest is shared")
+	}
+}
+
+func TestPersistentDelete(t *testing.T) {
+	empty := NewPersistentBTree[int, int](3, cmpInt)
+	_, err := empty.Delete(1)
+	assert.Error(t, err)
+
+	one := empty.Put(1, 1)
+	none, err := one.Delete(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, none.Len())
+	assert.Nil(t, none.root)
+	_, found := one.Get(1)
+	assert.True(t, found)
+}
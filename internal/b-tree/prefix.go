@@ -0,0 +1,121 @@
+package btree
+
+import "strings"
+
+// Prefix compression: keys close to each other, which are the ones that end
+// up in the same node, often share long prefixes, like paths
+// ("tenant/123/obj/..."). A tree created by NewPrefixCompressed stores the
+// prefix shared by the keys of a node once in Node.prefix and only the rest
+// of each key in Node.keys. prefix is always the longest prefix of every key
+// of the node, the entry helpers in btree.go keep it up to date as entries
+// come and go, including splits, merges and borrows.
+//
+// Only prefixes are compressed. Two things are left out:
+//   - suffix truncation, shortening separators to the shortest key that
+//     still tells two children apart. This is a B-tree, not a B+tree, so
+//     separators are entries with a value and must be kept whole. They
+//     still get the prefix of the node they live in.
+//   - []byte keys, a slice is not comparable so it can't be a key at all.
+//     Convert them to string.
+
+// prefixer does the byte work of prefix compression for a kind of key
+type prefixer[K any] interface {
+	common(a, b K) int // length of the longest prefix of a and b
+	size(k K) int
+	slice(k K, from, to int) K
+	concat(a, b K) K
+	clone(k K) K // a copy that doesn't keep the memory of k alive
+}
+
+type stringPrefixes[K ~string] struct{}
+
+func (stringPrefixes[K]) common(a, b K) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+func (stringPrefixes[K]) size(k K) int              { return len(k) }
+func (stringPrefixes[K]) slice(k K, from, to int) K { return k[from:to] }
+func (stringPrefixes[K]) concat(a, b K) K           { return a + b }
+func (stringPrefixes[K]) clone(k K) K               { return K(strings.Clone(string(k))) }
+
+// NewPrefixCompressed creates a B-tree over string keys, ordered byte by
+// byte, that stores the prefix shared by the keys of each node only once.
+// It behaves like any other BTree, whole keys are rebuilt as they are
+// returned. Only the prefixes are compressed, see above.
+func NewPrefixCompressed[K ~string, V any](order int) *BTree[K, V] {
+	tree := NewOrdered[K, V](order)
+	tree.prefixes = stringPrefixes[K]{}
+	return tree
+}
+
+// searchSuffix is searchKeyIndex for a compressed node. A key without the
+// node prefix is lower or greater than every key of the node, only keys with
+// it are compared against the suffixes.
+func (t *BTree[K, V]) searchSuffix(node *Node[K, V], key K) (int, bool) {
+	px := t.prefixes
+	n := px.size(node.prefix)
+	if px.common(node.prefix, key) < n {
+		if t.less(key, node.prefix) < 0 {
+			return 0, false
+		}
+		return len(node.keys), false
+	}
+	return t.search(node.keys, px.slice(key, n, px.size(key)), t.less)
+}
+
+// suffix returns what node n keeps of key: the part after the prefix, which
+// is first cut down to what key shares with it
+func (t *BTree[K, V]) suffix(n *Node[K, V], key K) K {
+	px := t.prefixes
+	if len(n.keys) == 0 {
+		n.prefix = px.clone(key)
+		return px.slice(key, px.size(key), px.size(key))
+	}
+	if shared := px.common(n.prefix, key); shared < px.size(n.prefix) {
+		moved := px.slice(n.prefix, shared, px.size(n.prefix))
+		for i, k := range n.keys {
+			n.keys[i] = px.concat(moved, k)
+		}
+		n.prefix = px.clone(px.slice(n.prefix, 0, shared))
+	}
+	return px.clone(px.slice(key, px.size(n.prefix), px.size(key)))
+}
+
+// growPrefix moves into the prefix the bytes every key of n still shares,
+// which happens when its first or last key goes away. Keys are sorted so
+// only those two bound the prefix.
+func (t *BTree[K, V]) growPrefix(n *Node[K, V]) {
+	px := t.prefixes
+	if len(n.keys) == 0 {
+		var empty K
+		n.prefix = empty
+		return
+	}
+	first, last := n.keys[0], n.keys[len(n.keys)-1]
+	grown := px.common(first, last)
+	if grown == 0 {
+		return
+	}
+	n.prefix = px.concat(n.prefix, px.slice(first, 0, grown))
+	for i, k := range n.keys {
+		n.keys[i] = px.clone(px.slice(k, grown, px.size(k)))
+	}
+}
+
+// keysOf returns the whole keys of a node
+func (t *BTree[K, V]) keysOf(node *Node[K, V]) []K {
+	if t.prefixes == nil {
+		return node.keys
+	}
+	keys := make([]K, len(node.keys))
+	for i := range node.keys {
+		keys[i] = t.key(node, i)
+	}
+	return keys
+}
@@ -0,0 +1,222 @@
+package btree
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertValidPrefixes checks that the prefix of every node is exactly the
+// longest prefix shared by its keys, on top of assertValidStructure
+func assertValidPrefixes[K ~string, V any](t *testing.T, tree *BTree[K, V]) {
+	if tree.root == nil {
+		return
+	}
+	assertValidStructure(t, tree, tree.root)
+	var walk func(node *Node[K, V])
+	walk = func(node *Node[K, V]) {
+		keys := tree.keysOf(node)
+		if len(keys) > 0 {
+			shared := tree.prefixes.common(keys[0], keys[len(keys)-1])
+			assert.Equal(t, keys[0][:shared], node.prefix, "keys %q", keys)
+		} else {
+			assert.Empty(t, node.prefix)
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(tree.root)
+	assert.True(t, slices.IsSorted(collectKeys(tree.All())))
+}
+
+// storedBytes adds up what the nodes keep for their keys
+func storedBytes[K ~string, V any](node *Node[K, V]) int {
+	n := len(node.prefix)
+	for _, s := range node.keys {
+		n += len(s)
+	}
+	for _, child := range node.children {
+		n += storedBytes(child)
+	}
+	return n
+}
+
+func pathKey(tenant, obj int) string {
+	return fmt.Sprintf("tenant/%03d/obj/%05d", tenant, obj)
+}
+
+func TestPrefixCompressedRandomOps(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	for order := 3; order <= 8; order++ {
+		tree := NewPrefixCompressed[string, int](order)
+		want := map[string]int{}
+		for i := range 3000 {
+			key := pathKey(rng.Intn(4), rng.Intn(200))
+			if rng.Intn(3) == 0 {
+				_, ok := want[key]
+				err := tree.Delete(key)
+				if ok {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+				}
+				delete(want, key)
+			} else {
+				assert.NoError(t, tree.Put(key, i))
+				want[key] = i
+			}
+			if i%100 == 0 {
+				assertValidPrefixes(t, tree)
+			}
+		}
+		assertValidPrefixes(t, tree)
+		assert.Equal(t, len(want), tree.Len())
+		for k, v := range want {
+			got, ok := tree.Get(k)
+			assert.True(t, ok, k)
+			assert.Equal(t, v, got, k)
+		}
+
+		var keys []string
+		for k, v := range tree.All() {
+			assert.Equal(t, want[k], v)
+			keys = append(keys, k)
+		}
+		assert.Equal(t, slices.Sorted(maps.Keys(want)), keys)
+	}
+}
+
+func TestPrefixCompressedLookupOutsidePrefix(t *testing.T) {
+	tree := NewPrefixCompressed[string, int](4)
+	for _, k := range []string{"b/1", "b/2", "b/3"} {
+		tree.Put(k, 0)
+	}
+	assert.Equal(t, "b/", tree.root.prefix)
+	for _, k := range []string{"", "a", "b", "b/", "b/0", "b/4", "c"} {
+		_, ok := tree.Get(k)
+		assert.False(t, ok, k)
+	}
+	tree.Put("a", 1)
+	tree.Put("b", 2)
+	tree.Put("c", 3)
+	assertValidPrefixes(t, tree)
+	assert.Equal(t, []string{"a", "b", "b/1", "b/2", "b/3", "c"}, collectKeys(tree.All()))
+}
+
+func TestPrefixRecomputedOnSplit(t *testing.T) {
+	tree := NewPrefixCompressed[string, int](4)
+	for _, k := range []string{"a/1", "a/2", "b/1"} {
+		tree.Put(k, 0)
+	}
+	assert.Equal(t, "", tree.root.prefix)
+
+	// middle is 1: a/1 | a/2 | b/1 b/2, the right half gets a longer prefix
+	tree.Put("b/2", 0)
+	assertValidPrefixes(t, tree)
+	assert.Equal(t, "a/2", tree.key(tree.root, 0))
+	assert.Equal(t, "a/1", tree.root.children[0].prefix)
+	assert.Equal(t, "b/", tree.root.children[1].prefix)
+	assert.Equal(t, []string{"1", "2"}, tree.root.children[1].keys)
+}
+
+func TestPrefixRecomputedOnMerge(t *testing.T) {
+	tree := NewPrefixCompressed[string, int](3)
+	for _, k := range []string{"a/1", "b/1", "b/2"} {
+		tree.Put(k, 0)
+	}
+	// b/1 on top, a/1 and b/2 alone in their leaves
+	assert.Equal(t, "b/2", tree.root.children[1].prefix)
+
+	assert.NoError(t, tree.Delete("a/1"))
+	assertValidPrefixes(t, tree)
+	assert.True(t, tree.isLeaf(tree.root))
+	assert.Equal(t, "b/", tree.root.prefix)
+	assert.Equal(t, []string{"1", "2"}, tree.root.keys)
+
+	assert.NoError(t, tree.Delete("b/2"))
+	assert.Equal(t, "b/1", tree.root.prefix)
+	assert.NoError(t, tree.Delete("b/1"))
+	assert.Empty(t, tree.root.prefix)
+	assert.ErrorIs(t, tree.Delete("b/1"), ErrEmpty)
+}
+
+func TestPrefixRecomputedOnBorrow(t *testing.T) {
+	tree := NewPrefixCompressed[string, int](4)
+	for _, k := range []string{"a/1", "b/1", "b/2", "b/3", "b/4"} {
+		tree.Put(k, 0)
+	}
+	// [b/1] on top of [a/1] and [b/2 b/3 b/4]
+	assert.Equal(t, "b/1", tree.key(tree.root, 0))
+	assert.Equal(t, "a/1", tree.root.children[0].prefix)
+
+	// a/1 underflows and takes b/1 from the parent, b/2 goes up
+	assert.NoError(t, tree.Delete("a/1"))
+	assertValidPrefixes(t, tree)
+	assert.Equal(t, "b/2", tree.key(tree.root, 0))
+	assert.Equal(t, "b/1", tree.root.children[0].prefix)
+	assert.Equal(t, "b/", tree.root.children[1].prefix)
+	assert.Equal(t, []string{"3", "4"}, tree.root.children[1].keys)
+
+	// borrowing from the left brings in a key without the prefix
+	tree.Put("a/0", 0)
+	assert.NoError(t, tree.Delete("b/3"))
+	assert.NoError(t, tree.Delete("b/4"))
+	assertValidPrefixes(t, tree)
+	assert.Equal(t, "b/1", tree.key(tree.root, 0))
+	assert.Equal(t, "b/2", tree.root.children[1].prefix)
+	assert.Equal(t, "a/0", tree.root.children[0].prefix)
+}
+
+func TestPrefixCompressedIsTransparent(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		// same keys in the same order as pathTree, so both get the same shape
+		plain := pathTree(order)
+		tree := NewPrefixCompressed[string, int](order)
+		for _, i := range rand.New(rand.NewSource(1)).Perm(250) {
+			tree.Put(pathKey(i/50, i%50), i)
+		}
+
+		for _, prefix := range []string{"", "tenant/", "tenant/000/obj/0004", "tenant/004/", "tenant/005", "a", "z"} {
+			assert.Equal(t, collectKeys(ScanPrefix(plain, prefix)), collectKeys(ScanPrefix(tree, prefix)), prefix)
+		}
+		var want, got strings.Builder
+		assert.NoError(t, plain.Dump(&want))
+		assert.NoError(t, tree.Dump(&got))
+		assert.Equal(t, want.String(), got.String(), "dumps show whole keys")
+
+		// split and join graft and redistribute nodes
+		left, right := tree.SplitAt(pathKey(2, 25))
+		assertValidPrefixes(t, left)
+		assertValidPrefixes(t, right)
+		assert.Equal(t, pathKey(2, 24), left.maxItem().Key)
+		joined, err := Join(left, right)
+		assert.NoError(t, err)
+		assertValidPrefixes(t, joined)
+		assert.Equal(t, collectKeys(plain.All()), collectKeys(joined.All()))
+
+		union := Union(joined, NewPrefixCompressed[string, int](order), nil)
+		assertValidPrefixes(t, union)
+		assert.Equal(t, collectKeys(plain.All()), collectKeys(union.All()))
+	}
+}
+
+func TestPrefixCompressionSavesSpace(t *testing.T) {
+	tree := NewPrefixCompressed[string, int](32)
+	raw := 0
+	for tenant := range 10 {
+		for obj := range 1000 {
+			k := pathKey(tenant, obj)
+			raw += len(k)
+			tree.Put(k, obj)
+		}
+	}
+	assertValidPrefixes(t, tree)
+	// keys are 20 bytes long and neighbors share ~17 of them
+	assert.Less(t, storedBytes(tree.root), raw/3)
+}
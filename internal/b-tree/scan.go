@@ -0,0 +1,58 @@
+package btree
+
+import (
+	"iter"
+	"strings"
+)
+
+// prefix scans: seek to the first key >= prefix with walkFrom and stop at
+// the first key that doesn't have it. They rely on the tree ordering keys
+// byte by byte (strings.Compare, cmp.Compare), with any other order the keys
+// with a prefix are not next to each other.
+
+// ScanPrefix returns an iterator over the entries whose key starts with
+// prefix, in key order. Keys must be strings since []byte can't be a key.
+func ScanPrefix[K ~string, V any](t *BTree[K, V], prefix K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if t.root == nil {
+			return
+		}
+		t.walkFrom(t.root, prefix, func(k K, v V) bool {
+			return strings.HasPrefix(string(k), string(prefix)) && yield(k, v)
+		})
+	}
+}
+
+// KeysWithPrefix is ScanPrefix for any key type. successor returns the
+// smallest key greater than every key starting with prefix, or false when
+// there is none, then the scan goes on to the end of the tree.
+func KeysWithPrefix[K comparable, V any](
+	t *BTree[K, V],
+	prefix K,
+	successor func(prefix K) (K, bool),
+) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		if t.root == nil {
+			return
+		}
+		end, bounded := successor(prefix)
+		t.walkFrom(t.root, prefix, func(k K, v V) bool {
+			return (!bounded || t.Less(k, end) < 0) && yield(k, v)
+		})
+	}
+}
+
+// StringSuccessor is the successor of a string prefix for KeysWithPrefix:
+// the prefix with its last byte incremented, after dropping trailing 0xff
+// bytes, which can't be incremented
+func StringSuccessor(prefix string) (string, bool) {
+	// byte by byte, strings.TrimRight would take 0xff as a rune
+	end := len(prefix)
+	for end > 0 && prefix[end-1] == 0xff {
+		end--
+	}
+	if end == 0 {
+		return "", false
+	}
+	return prefix[:end-1] + string([]byte{prefix[end-1] + 1}), true
+}
@@ -0,0 +1,96 @@
+package btree
+
+import (
+	"iter"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func collectKeys[K, V any](seq iter.Seq2[K, V]) []K {
+	var keys []K
+	for k := range seq {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// pathTree has the keys tenant/000/obj/00000 to tenant/004/obj/00049
+func pathTree(order int) *BTree[string, int] {
+	tree := NewBTree[string, int](order, strings.Compare)
+	for _, i := range rand.New(rand.NewSource(1)).Perm(250) {
+		tree.Put(pathKey(i/50, i%50), i)
+	}
+	return tree
+}
+
+func TestScanPrefix(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		tree := pathTree(order)
+
+		keys := collectKeys(ScanPrefix(tree, "tenant/002/"))
+		assert.Len(t, keys, 50)
+		assert.Equal(t, pathKey(2, 0), keys[0])
+		assert.Equal(t, pathKey(2, 49), keys[49])
+
+		assert.Equal(t,
+			[]string{pathKey(3, 10), pathKey(3, 11), pathKey(3, 12), pathKey(3, 13), pathKey(3, 14),
+				pathKey(3, 15), pathKey(3, 16), pathKey(3, 17), pathKey(3, 18), pathKey(3, 19)},
+			collectKeys(ScanPrefix(tree, "tenant/003/obj/0001")))
+		assert.Len(t, collectKeys(ScanPrefix(tree, "")), 250)
+		assert.Empty(t, collectKeys(ScanPrefix(tree, "tenant/009/")))
+		assert.Empty(t, collectKeys(ScanPrefix(tree, "zzz")))
+		assert.Equal(t, []string{pathKey(4, 49)}, collectKeys(ScanPrefix(tree, pathKey(4, 49))))
+	}
+	assert.Empty(t, collectKeys(ScanPrefix(NewBTree[string, int](3, strings.Compare), "a")))
+}
+
+func TestScanPrefixStopsEarly(t *testing.T) {
+	tree := pathTree(4)
+	var keys []string
+	for k, v := range ScanPrefix(tree, "tenant/001/") {
+		assert.Equal(t, 50+len(keys), v)
+		keys = append(keys, k)
+		if len(keys) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []string{pathKey(1, 0), pathKey(1, 1), pathKey(1, 2)}, keys)
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	tree := pathTree(5)
+	assert.Equal(t,
+		collectKeys(ScanPrefix(tree, "tenant/001/")),
+		collectKeys(KeysWithPrefix(tree, "tenant/001/", StringSuccessor)))
+
+	// integer keys: the prefix of a number is its value divided by 10
+	ints := NewBTree[int, int](4, cmpInt)
+	for i := range 100 {
+		ints.Put(i, i)
+	}
+	tens := func(prefix int) (int, bool) { return prefix + 10, true }
+	assert.Equal(t, []int{30, 31, 32, 33, 34, 35, 36, 37, 38, 39}, collectKeys(KeysWithPrefix(ints, 30, tens)))
+
+	unbounded := func(int) (int, bool) { return 0, false }
+	assert.Len(t, collectKeys(KeysWithPrefix(ints, 90, unbounded)), 10)
+}
+
+func TestStringSuccessor(t *testing.T) {
+	for prefix, want := range map[string]string{
+		"a":         "b",
+		"tenant/":   "tenant0",
+		"a\xff":     "b",
+		"a\xfe\xff": "a\xff",
+	} {
+		got, ok := StringSuccessor(prefix)
+		assert.True(t, ok, prefix)
+		assert.Equal(t, want, got, prefix)
+	}
+	for _, prefix := range []string{"", "\xff", "\xff\xff"} {
+		_, ok := StringSuccessor(prefix)
+		assert.False(t, ok, prefix)
+	}
+}
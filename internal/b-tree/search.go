@@ -0,0 +1,89 @@
+package btree
+
+// Search finds key among the sorted keys of a node. It returns the index of
+// the key, or the index where it would be inserted and false.
+type Search[K any] func(keys []K, key K, cmp func(K, K) int) (index int, found bool)
+
+// DefaultLinearMax is the node size up to which AutoSearch scans linearly.
+// With int keys linear search wins up to ~32 keys and loses badly past 64,
+// see BenchmarkSearch. On uniformly spread numbers InterpolationSearch beats
+// both from order 32 on.
+const DefaultLinearMax = 32
+
+// Number is any type interpolation search can do arithmetic on
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// SetSearch changes how keys are looked up inside each node. The default is
+// AutoSearch(DefaultLinearMax).
+func (t *BTree[K, V]) SetSearch(search Search[K]) {
+	t.search = search
+}
+
+// BinarySearch halves the range with a single comparison per step and only
+// checks for equality once it's done
+func BinarySearch[K any](keys []K, key K, cmp func(K, K) int) (int, bool) {
+	low, high := 0, len(keys)
+	for low < high {
+		mid := int(uint(low+high) >> 1)
+		if cmp(keys[mid], key) < 0 {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, low < len(keys) && cmp(keys[low], key) == 0
+}
+
+// LinearSearch scans the keys from the start, it does more comparisons than
+// BinarySearch but they are predictable and go over contiguous memory, which
+// wins on small nodes
+func LinearSearch[K any](keys []K, key K, cmp func(K, K) int) (int, bool) {
+	for i, k := range keys {
+		if c := cmp(k, key); c >= 0 {
+			return i, c == 0
+		}
+	}
+	return len(keys), false
+}
+
+// AutoSearch scans linearly nodes with up to linearMax keys and uses binary
+// search on bigger ones
+func AutoSearch[K any](linearMax int) Search[K] {
+	return func(keys []K, key K, cmp func(K, K) int) (int, bool) {
+		if len(keys) <= linearMax {
+			return LinearSearch(keys, key, cmp)
+		}
+		return BinarySearch(keys, key, cmp)
+	}
+}
+
+// InterpolationSearch guesses where key is from its value, relative to the
+// first and last keys of the range, instead of always probing the middle. On
+// uniformly spread keys it takes O(log log n) probes. cmp still decides the
+// order, so it is correct with any comparator but only fast when it agrees
+// with the numeric order of the keys.
+func InterpolationSearch[K Number](keys []K, key K, cmp func(K, K) int) (int, bool) {
+	low, high := 0, len(keys) // the key is in [low, high)
+	for high-low > 2 {
+		first, last := float64(keys[low]), float64(keys[high-1])
+		if last <= first {
+			break
+		}
+		guess := low + int(float64(high-1-low)*((float64(key)-first)/(last-first)))
+		guess = min(max(guess, low), high-1)
+		switch c := cmp(keys[guess], key); {
+		case c == 0:
+			return guess, true
+		case c < 0:
+			low = guess + 1
+		default:
+			high = guess
+		}
+	}
+	index, found := LinearSearch(keys[low:high], key, cmp)
+	return low + index, found
+}
@@ -0,0 +1,83 @@
+package btree
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func intSearches() map[string]Search[int] {
+	return map[string]Search[int]{
+		"binary":        BinarySearch[int],
+		"linear":        LinearSearch[int],
+		"interpolation": InterpolationSearch[int],
+		"auto":          AutoSearch[int](4),
+	}
+}
+
+func TestSearchStrategiesAgree(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for n := 0; n < 40; n++ {
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = rng.Intn(50) * rng.Intn(50) // skewed, with duplicates removed below
+		}
+		slices.Sort(keys)
+		keys = slices.Compact(keys)
+		for key := -1; key <= 2500; key += 7 {
+			wantIndex, wantFound := slices.BinarySearch(keys, key)
+			for name, search := range intSearches() {
+				index, found := search(keys, key, cmpInt)
+				assert.Equal(t, wantIndex, index, "%s %v %d", name, keys, key)
+				assert.Equal(t, wantFound, found, "%s %v %d", name, keys, key)
+			}
+		}
+	}
+}
+
+func TestInterpolationWithReversedOrder(t *testing.T) {
+	// the guesses are useless but the answer must still be right
+	desc := func(a, b int) int { return cmpInt(b, a) }
+	keys := []int{90, 70, 50, 30, 10, 5, 1}
+	for i, key := range keys {
+		index, found := InterpolationSearch(keys, key, desc)
+		assert.True(t, found)
+		assert.Equal(t, i, index)
+	}
+	index, found := InterpolationSearch(keys, 40, desc)
+	assert.False(t, found)
+	assert.Equal(t, 3, index)
+}
+
+func TestTreeWithEverySearch(t *testing.T) {
+	for name, search := range intSearches() {
+		tree := NewBTree[int, int](16, cmpInt)
+		tree.SetSearch(search)
+		rng := rand.New(rand.NewSource(5))
+		want := map[int]int{}
+		for range 3000 {
+			k := rng.Intn(1000)
+			if rng.Intn(3) == 0 {
+				tree.Delete(k)
+				delete(want, k)
+			} else {
+				tree.Put(k, k)
+				want[k] = k
+			}
+		}
+		assertValidStructure(t, tree, tree.root)
+		assert.Equal(t, len(want), tree.Len(), name)
+		for k, v := range want {
+			got, ok := tree.Get(k)
+			assert.True(t, ok, name)
+			assert.Equal(t, v, got, name)
+		}
+
+		// trees derived from it keep searching the same way
+		left, right := tree.SplitAt(500)
+		assert.NotNil(t, left.search, name)
+		assert.NotNil(t, right.search, name)
+	}
+}
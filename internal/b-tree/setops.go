@@ -0,0 +1,94 @@
+package btree
+
+import "iter"
+
+// Set operations walk both trees side by side in key order, which is linear
+// in the size of the inputs, and bulk build the result from the merged items.
+// Both trees must order keys with the same comparison function, the result
+// uses the degree and comparison function of a.
+
+// Resolve picks the value kept for a key present in both trees
+type Resolve[K comparable, V any] func(key K, a, b V) V
+
+// Union returns a tree with the keys present in a or b. Values for keys in
+// both come from resolve, or from a when resolve is nil.
+func Union[K comparable, V any](a, b *BTree[K, V], resolve Resolve[K, V]) *BTree[K, V] {
+	var items []Item[K, V]
+	merge(a, b, func(key K, va, vb V, inA, inB bool) {
+		switch {
+		case inA && inB:
+			items = append(items, Item[K, V]{Key: key, Value: pick(resolve, key, va, vb)})
+		case inA:
+			items = append(items, Item[K, V]{Key: key, Value: va})
+		default:
+			items = append(items, Item[K, V]{Key: key, Value: vb})
+		}
+	})
+	return fromSorted(a, items)
+}
+
+// Intersection returns a tree with the keys present in both a and b, values
+// come from resolve, or from a when resolve is nil
+func Intersection[K comparable, V any](a, b *BTree[K, V], resolve Resolve[K, V]) *BTree[K, V] {
+	var items []Item[K, V]
+	merge(a, b, func(key K, va, vb V, inA, inB bool) {
+		if inA && inB {
+			items = append(items, Item[K, V]{Key: key, Value: pick(resolve, key, va, vb)})
+		}
+	})
+	return fromSorted(a, items)
+}
+
+// Difference returns a tree with the entries of a whose key is not in b
+func Difference[K comparable, V any](a, b *BTree[K, V]) *BTree[K, V] {
+	var items []Item[K, V]
+	merge(a, b, func(key K, va, _ V, inA, inB bool) {
+		if inA && !inB {
+			items = append(items, Item[K, V]{Key: key, Value: va})
+		}
+	})
+	return fromSorted(a, items)
+}
+
+func pick[K comparable, V any](resolve Resolve[K, V], key K, a, b V) V {
+	if resolve == nil {
+		return a
+	}
+	return resolve(key, a, b)
+}
+
+func fromSorted[K comparable, V any](like *BTree[K, V], items []Item[K, V]) *BTree[K, V] {
+	tree := NewBTree[K, V](like.order, like.less)
+	tree.search = like.search
+	tree.keyCodec, tree.valueCodec = like.keyCodec, like.valueCodec
+	tree.prefixes = like.prefixes
+	tree.buildSorted(items)
+	return tree
+}
+
+// merge calls fn for every distinct key of a and b in order, telling in which
+// of the two trees the key is present
+func merge[K comparable, V any](a, b *BTree[K, V], fn func(key K, va, vb V, inA, inB bool)) {
+	nextA, stopA := iter.Pull2(a.All())
+	defer stopA()
+	nextB, stopB := iter.Pull2(b.All())
+	defer stopB()
+
+	var zero V
+	ka, va, okA := nextA()
+	kb, vb, okB := nextB()
+	for okA || okB {
+		switch {
+		case !okB || (okA && a.Less(ka, kb) < 0):
+			fn(ka, va, zero, true, false)
+			ka, va, okA = nextA()
+		case !okA || a.Less(ka, kb) > 0:
+			fn(kb, zero, vb, false, true)
+			kb, vb, okB = nextB()
+		default:
+			fn(ka, va, vb, true, true)
+			ka, va, okA = nextA()
+			kb, vb, okB = nextB()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func treeFromMap(order int, m map[int]int) *BTree[int, int] {
+	tree := NewBTree[int, int](order, cmpInt)
+	for k, v := range m {
+		tree.Put(k, v)
+	}
+	return tree
+}
+
+func treeToMap(tree *BTree[int, int]) map[int]int {
+	m := map[int]int{}
+	for k, v := range tree.All() {
+		m[k] = v
+	}
+	return m
+}
+
+func TestSetOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for order := 3; order <= 6; order++ {
+		ma, mb := map[int]int{}, map[int]int{}
+		for i := 0; i < 300; i++ {
+			ma[r.Intn(500)] = i
+			mb[r.Intn(500)] = -i
+		}
+		a, b := treeFromMap(order, ma), treeFromMap(order+1, mb)
+		sum := func(_ int, x, y int) int { return x + y }
+
+		union, inter, diff := map[int]int{}, map[int]int{}, map[int]int{}
+		for k, v := range ma {
+			union[k] = v
+			if w, ok := mb[k]; ok {
+				union[k] = v + w
+				inter[k] = v + w
+			} else {
+				diff[k] = v
+			}
+		}
+		for k, v := range mb {
+			if _, ok := ma[k]; !ok {
+				union[k] = v
+			}
+		}
+
+		for _, tc := range []struct {
+			name     string
+			got      *BTree[int, int]
+			expected map[int]int
+		}{
+			{"union", Union(a, b, sum), union},
+			{"intersection", Intersection(a, b, sum), inter},
+			{"difference", Difference(a, b), diff},
+		} {
+			assertValidTree(t, tc.got, len(tc.expected))
+			assert.Equal(t, tc.expected, treeToMap(tc.got), tc.name)
+			if tc.got.root != nil {
+				assertValidStructure(t, tc.got, tc.got.root)
+			}
+			assert.Equal(t, order, tc.got.order, "result is built like a")
+		}
+	}
+}
+
+func TestSetOperationsEdgeCases(t *testing.T) {
+	empty := NewBTree[int, int](3, cmpInt)
+	a := treeFromMap(3, map[int]int{1: 10, 2: 20})
+	b := treeFromMap(3, map[int]int{2: 200, 3: 300})
+
+	assert.Equal(t, map[int]int{1: 10, 2: 20}, treeToMap(Union(a, empty, nil)))
+	assert.Equal(t, map[int]int{}, treeToMap(Intersection(empty, a, nil)))
+	assert.Equal(t, map[int]int{1: 10, 2: 20, 3: 300}, treeToMap(Union(a, b, nil)), "nil resolve keeps a")
+	assert.Equal(t, map[int]int{2: 20}, treeToMap(Intersection(a, b, nil)))
+	assert.Equal(t, map[int]int{3: 300}, treeToMap(Difference(b, a)))
+
+	// inputs are left untouched
+	assert.Equal(t, map[int]int{1: 10, 2: 20}, treeToMap(a))
+}
@@ -0,0 +1,131 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// skipList is only here as a baseline for the benchmarks, it's the usual
+// ordered map people reach for instead of a B-tree (LevelDB memtables...)
+type skipList[K any, V any] struct {
+	head  *skipNode[K, V]
+	level int
+	cmp   func(a, b K) int
+	rng   *rand.Rand
+}
+
+type skipNode[K any, V any] struct {
+	key   K
+	value V
+	next  []*skipNode[K, V]
+}
+
+const skipMaxLevel = 24
+
+func newSkipList[K any, V any](cmp func(a, b K) int) *skipList[K, V] {
+	return &skipList[K, V]{
+		head:  &skipNode[K, V]{next: make([]*skipNode[K, V], skipMaxLevel)},
+		level: 1,
+		cmp:   cmp,
+		rng:   rand.New(rand.NewSource(1)),
+	}
+}
+
+// each level keeps a quarter of the nodes of the one below
+func (s *skipList[K, V]) randomLevel() int {
+	level := 1
+	for level < skipMaxLevel && s.rng.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+// findPrev fills update with the last node of every level before key and
+// returns the first node at or after it
+func (s *skipList[K, V]) findPrev(key K, update []*skipNode[K, V]) *skipNode[K, V] {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && s.cmp(x.next[i].key, key) < 0 {
+			x = x.next[i]
+		}
+		if update != nil {
+			update[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+func (s *skipList[K, V]) Put(key K, value V) {
+	var update [skipMaxLevel]*skipNode[K, V]
+	x := s.findPrev(key, update[:])
+	if x != nil && s.cmp(x.key, key) == 0 {
+		x.value = value
+		return
+	}
+	level := s.randomLevel()
+	for ; s.level < level; s.level++ {
+		update[s.level] = s.head
+	}
+	n := &skipNode[K, V]{key: key, value: value, next: make([]*skipNode[K, V], level)}
+	for i := range level {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+}
+
+func (s *skipList[K, V]) Get(key K) (V, bool) {
+	x := s.findPrev(key, nil)
+	if x != nil && s.cmp(x.key, key) == 0 {
+		return x.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+func (s *skipList[K, V]) Delete(key K) {
+	var update [skipMaxLevel]*skipNode[K, V]
+	x := s.findPrev(key, update[:])
+	if x == nil || s.cmp(x.key, key) != 0 {
+		return
+	}
+	for i := range x.next {
+		update[i].next[i] = x.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+}
+
+// ascend calls yield from the first key at or after lo until it returns false
+func (s *skipList[K, V]) ascend(lo K, yield func(K, V) bool) {
+	for x := s.findPrev(lo, nil); x != nil && yield(x.key, x.value); x = x.next[0] {
+	}
+}
+
+func TestSkipListMatchesBTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	list := newSkipList[int, int](cmpInt)
+	tree := NewBTree[int, int](4, cmpInt)
+	for range 5000 {
+		k := rng.Intn(500)
+		if rng.Intn(3) == 0 {
+			list.Delete(k)
+			tree.Delete(k)
+		} else {
+			list.Put(k, k*2)
+			tree.Put(k, k*2)
+		}
+	}
+
+	var got, want []int
+	list.ascend(0, func(k, v int) bool {
+		got = append(got, k, v)
+		return true
+	})
+	for k, v := range tree.All() {
+		want = append(want, k, v)
+	}
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,224 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+)
+
+// A snapshot is every entry of the tree in key order:
+//
+//	header  [magic "BTSN"][version uint16][count uvarint]
+//	records [key len uvarint][key][value len uvarint][value] x count
+//	trailer [crc32c uint32] of header and records
+//
+// integers are big endian. Keys and values are encoded by the codecs of the
+// tree.
+const (
+	snapshotMagic   = "BTSN"
+	snapshotVersion = 1
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SetCodecs sets how WriteTo and ReadFrom encode keys and values, codec.Gob
+// is used until it is called
+func (t *BTree[K, V]) SetCodecs(keys codec.Codec[K], values codec.Codec[V]) {
+	t.keyCodec, t.valueCodec = keys, values
+}
+
+func (t *BTree[K, V]) codecs() (codec.Codec[K], codec.Codec[V]) {
+	kc, vc := t.keyCodec, t.valueCodec
+	if kc == nil {
+		kc = codec.Gob[K]{}
+	}
+	if vc == nil {
+		vc = codec.Gob[V]{}
+	}
+	return kc, vc
+}
+
+// WriteTo writes a snapshot of the tree to w, it implements io.WriterTo
+func (t *BTree[K, V]) WriteTo(w io.Writer) (int64, error) {
+	kc, vc := t.codecs()
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	crc := crc32.New(crcTable)
+	body := io.MultiWriter(bw, crc)
+
+	buf := append([]byte(snapshotMagic), 0, snapshotVersion)
+	buf = binary.AppendUvarint(buf, uint64(t.size))
+	if _, err := body.Write(buf); err != nil {
+		return cw.n, err
+	}
+	var key, value []byte
+	var err error
+	for k, v := range t.All() {
+		if key, err = kc.Encode(key[:0], k); err != nil {
+			return cw.n, err
+		}
+		if value, err = vc.Encode(value[:0], v); err != nil {
+			return cw.n, err
+		}
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+		if _, err := body.Write(buf); err != nil {
+			return cw.n, err
+		}
+	}
+	if _, err := bw.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return cw.n, err
+	}
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom replaces the contents of the tree with the snapshot in r, it
+// implements io.ReaderFrom. Nothing changes unless the whole snapshot is
+// read and checks out. The tree is rebuilt bottom up, not with Put.
+//
+// r is read through a bufio.Reader unless it is an io.ByteReader already,
+// wrap it in one if more data follows the snapshot.
+func (t *BTree[K, V]) ReadFrom(r io.Reader) (int64, error) {
+	kc, vc := t.codecs()
+	sr := &snapshotReader{crc: crc32.New(crcTable)}
+	if br, ok := r.(byteReader); ok {
+		sr.r = br
+	} else {
+		sr.r = bufio.NewReader(r)
+	}
+
+	header := sr.next(uint64(len(snapshotMagic) + 2))
+	count := sr.uvarint()
+	if sr.err != nil {
+		return sr.n, sr.error()
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return sr.n, fmt.Errorf("%w: bad magic %q", ErrCorruptSnapshot, header[:len(snapshotMagic)])
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version != snapshotVersion {
+		return sr.n, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+	}
+
+	var items []Item[K, V]
+	for i := uint64(0); i < count && sr.err == nil; i++ {
+		key := sr.next(sr.uvarint())
+		k, err := kc.Decode(key)
+		if sr.err == nil && err != nil {
+			sr.err = fmt.Errorf("%w: key %d: %v", ErrCorruptSnapshot, i, err)
+		}
+		value := sr.next(sr.uvarint())
+		v, err := vc.Decode(value)
+		if sr.err == nil && err != nil {
+			sr.err = fmt.Errorf("%w: value %d: %v", ErrCorruptSnapshot, i, err)
+		}
+		if sr.err == nil && len(items) > 0 && t.Less(items[len(items)-1].Key, k) >= 0 {
+			sr.err = fmt.Errorf("%w: key %d out of order", ErrCorruptSnapshot, i)
+		}
+		items = append(items, Item[K, V]{Key: k, Value: v})
+	}
+	sum := sr.crc.Sum32()
+	sr.crc = nil // the trailer is not part of the checksum
+	trailer := sr.next(4)
+	if sr.err != nil {
+		return sr.n, sr.error()
+	}
+	if binary.BigEndian.Uint32(trailer) != sum {
+		return sr.n, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+
+	t.buildSorted(items)
+	return sr.n, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// snapshotReader reads the pieces of a snapshot keeping the first error, the
+// number of bytes read and the checksum of everything read so far
+type snapshotReader struct {
+	r   byteReader
+	n   int64
+	crc hash.Hash32
+	err error
+}
+
+// next reads n bytes. They are read as they come instead of allocating n
+// bytes up front, a corrupt length only costs what is really in the stream.
+func (s *snapshotReader) next(n uint64) []byte {
+	if s.err != nil {
+		return nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(s.r, int64(min(n, math.MaxInt64))))
+	s.n += int64(len(buf))
+	if err == nil && uint64(len(buf)) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		s.err = err
+		return nil
+	}
+	if s.crc != nil {
+		s.crc.Write(buf)
+	}
+	return buf
+}
+
+func (s *snapshotReader) uvarint() uint64 {
+	if s.err != nil {
+		return 0
+	}
+	var buf []byte
+	v, err := binary.ReadUvarint(byteFunc(func() (byte, error) {
+		b, err := s.r.ReadByte()
+		if err == nil {
+			s.n++
+			buf = append(buf, b)
+		}
+		return b, err
+	}))
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: %v", ErrCorruptSnapshot, err) // overflow
+	}
+	if err != nil {
+		s.err = err
+		return 0
+	}
+	s.crc.Write(buf)
+	return v
+}
+
+// error turns running out of input into ErrCorruptSnapshot, a snapshot cut
+// short is as broken as one with a bad checksum
+func (s *snapshotReader) error() error {
+	if errors.Is(s.err, io.EOF) || errors.Is(s.err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", ErrCorruptSnapshot, io.ErrUnexpectedEOF)
+	}
+	return s.err
+}
+
+type byteFunc func() (byte, error)
+
+func (f byteFunc) ReadByte() (byte, error) { return f() }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
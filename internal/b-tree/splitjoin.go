@@ -0,0 +1,319 @@
+package btree
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Splitting and joining whole trees works by cutting nodes along a single
+// root to leaf path and grafting subtrees at the height where they fit, so
+// only O(log n) nodes are touched. Subtree counts give the size of every
+// resulting tree without walking it.
+
+// piece is a detached subtree, height 0 means the piece is empty and leaves
+// have height 1
+type piece[K comparable, V any] struct {
+	root   *Node[K, V]
+	height int
+}
+
+func (t *BTree[K, V]) height() int {
+	if t.isEmpty() {
+		return 0
+	}
+	h := 1
+	for node := t.root; !t.isLeaf(node); node = node.children[0] {
+		h++
+	}
+	return h
+}
+
+// fromPiece wraps a piece in a tree configured like t
+func (t *BTree[K, V]) fromPiece(p piece[K, V]) *BTree[K, V] {
+	tree := &BTree[K, V]{
+		order:      t.order,
+		less:       t.less,
+		search:     t.search,
+		keyCodec:   t.keyCodec,
+		valueCodec: t.valueCodec,
+		aug:        t.aug,
+		prefixes:   t.prefixes,
+	}
+	if p.height > 0 {
+		p.root.parent = nil
+		tree.root = p.root
+		tree.size = p.root.count
+	}
+	return tree
+}
+
+// newPiece builds a fresh node out of the entries from i to j of src, a node
+// left with no entries collapses into its only child
+func (t *BTree[K, V]) newPiece(src *Node[K, V], i, j int, children []*Node[K, V], height int) piece[K, V] {
+	if i == j {
+		if len(children) == 0 {
+			return piece[K, V]{}
+		}
+		children[0].parent = nil
+		return piece[K, V]{root: children[0], height: height - 1}
+	}
+	node := t.newNode(len(children) == 0)
+	t.appendRange(node, src, i, j)
+	node.children = append(node.children, children...)
+	setParent(node.children, node)
+	t.refreshNode(node)
+	return piece[K, V]{root: node, height: height}
+}
+
+// SplitAt moves the entries of t into two new trees, the first one with the
+// keys lower than key and the second one with the rest. t is left empty.
+func (t *BTree[K, V]) SplitAt(key K) (*BTree[K, V], *BTree[K, V]) {
+	var left, right piece[K, V]
+	if !t.isEmpty() {
+		left, right = t.splitPiece(t.root, t.height(), key)
+	}
+	t.root, t.size = nil, 0
+	return t.fromPiece(left), t.fromPiece(right)
+}
+
+// splitPiece cuts the subtree rooted at node. Only the child on the path to
+// key is split recursively, the entries and children at each side of it are
+// joined back to the halves coming from below.
+func (t *BTree[K, V]) splitPiece(node *Node[K, V], height int, key K) (left, right piece[K, V]) {
+	node.parent = nil
+	defer t.freeNode(node) // its entries and children were copied to the pieces
+	index, found := t.searchKeyIndex(node, key)
+	if t.isLeaf(node) {
+		return t.newPiece(node, 0, index, nil, 1), t.newPiece(node, index, len(node.keys), nil, 1)
+	}
+	if found {
+		left = t.newPiece(node, 0, index, node.children[:index+1], height)
+		rest := t.newPiece(node, index+1, len(node.keys), node.children[index+1:], height)
+		right = t.join3(piece[K, V]{}, t.item(node, index), rest)
+		return left, right
+	}
+
+	left, right = t.splitPiece(node.children[index], height-1, key)
+	if index > 0 {
+		before := t.newPiece(node, 0, index-1, node.children[:index], height)
+		left = t.join3(before, t.item(node, index-1), left)
+	}
+	if index < len(node.keys) {
+		after := t.newPiece(node, index+1, len(node.keys), node.children[index+1:], height)
+		right = t.join3(right, t.item(node, index), after)
+	}
+	return left, right
+}
+
+// Join concatenates two trees built with the same degree, every key of left
+// must be lower than every key of right. Both inputs are left empty.
+//
+// Nodes move to the result as they are, so both trees must also share the
+// comparison function, the prefix compression and, when augmented, the
+// Augmented they belong to, like the halves SplitAt returns do. Anything
+// else is ErrIncompatible.
+func Join[K comparable, V any](left, right *BTree[K, V]) (*BTree[K, V], error) {
+	if left.order != right.order {
+		return nil, fmt.Errorf("%w: %d and %d", ErrDegreeMismatch, left.order, right.order)
+	}
+	switch {
+	case reflect.ValueOf(left.less).Pointer() != reflect.ValueOf(right.less).Pointer():
+		return nil, fmt.Errorf("%w: different comparison functions", ErrIncompatible)
+	case left.prefixes != right.prefixes:
+		return nil, fmt.Errorf("%w: only one of them compresses keys", ErrIncompatible)
+	case left.aug != right.aug:
+		return nil, fmt.Errorf("%w: aggregates are kept by different trees", ErrIncompatible)
+	}
+	if left.isEmpty() || right.isEmpty() {
+		joined := left
+		if left.isEmpty() {
+			joined = right
+		}
+		result := joined.fromPiece(piece[K, V]{root: joined.root, height: joined.height()})
+		left.root, left.size, right.root, right.size = nil, 0, nil, 0
+		return result, nil
+	}
+
+	maxLeft := left.maxItem()
+	minRight := right.minItem()
+	if left.Less(maxLeft.Key, minRight.Key) >= 0 {
+		return nil, fmt.Errorf("%w: left ends at %v, right starts at %v", ErrOverlap, maxLeft.Key, minRight.Key)
+	}
+
+	// the smallest entry of right becomes the separator of the graft
+	minRight, err := right.deleteMin()
+	if err != nil {
+		return nil, err
+	}
+	p := left.join3(
+		piece[K, V]{root: left.root, height: left.height()},
+		minRight,
+		piece[K, V]{root: right.root, height: right.height()},
+	)
+	result := left.fromPiece(p)
+	left.root, left.size, right.root, right.size = nil, 0, nil, 0
+	return result, nil
+}
+
+func (t *BTree[K, V]) minItem() Item[K, V] {
+	node := t.root
+	for !t.isLeaf(node) {
+		node = node.children[0]
+	}
+	return t.item(node, 0)
+}
+
+// deleteMin removes the smallest entry, like Delete but leaving the hooks
+// and the counters out of it since the entry only moves to another tree
+func (t *BTree[K, V]) deleteMin() (Item[K, V], error) {
+	if t.isEmpty() {
+		return Item[K, V]{}, ErrEmpty
+	}
+	counters := t.counters
+	defer func() { t.counters = counters }()
+	node := t.root
+	for !t.isLeaf(node) {
+		node = node.children[0]
+	}
+	return t.removeAt(node, 0), nil
+}
+
+func (t *BTree[K, V]) maxItem() Item[K, V] {
+	node := t.rightmostLeaf(t.root)
+	return t.item(node, len(node.keys)-1)
+}
+
+// join3 joins l, sep and r, where every key of l is lower than sep and every
+// key of r is greater. The shorter piece is grafted on the spine of the
+// taller one at the level where the heights match.
+func (t *BTree[K, V]) join3(l piece[K, V], sep Item[K, V], r piece[K, V]) piece[K, V] {
+	switch {
+	case l.height == 0 && r.height == 0:
+		leaf := t.newNode(true)
+		t.appendItem(leaf, sep)
+		t.refreshNode(leaf)
+		return piece[K, V]{root: leaf, height: 1}
+	case l.height == 0:
+		return t.insertPiece(r, sep)
+	case r.height == 0:
+		return t.insertPiece(l, sep)
+	case l.height == r.height:
+		root := t.newNode(false)
+		t.appendItem(root, sep)
+		root.children = append(root.children, l.root, r.root)
+		setParent(root.children, root)
+		if t.underflows(l.root) || t.underflows(r.root) {
+			t.redistribute(root, 0)
+		}
+		if len(root.keys) == 0 { // both halves fit in a single node
+			child := root.children[0]
+			child.parent = nil
+			t.freeNode(root)
+			return piece[K, V]{root: child, height: l.height}
+		}
+		t.refreshNode(root)
+		return piece[K, V]{root: root, height: l.height + 1}
+	case l.height > r.height:
+		node := l.root
+		for h := l.height; h > r.height+1; h-- {
+			node = node.children[len(node.children)-1]
+		}
+		t.appendItem(node, sep)
+		node.children = append(node.children, r.root)
+		r.root.parent = node
+		return t.graft(l, node, len(node.keys)-1)
+	default:
+		node := r.root
+		for h := r.height; h > l.height+1; h-- {
+			node = node.children[0]
+		}
+		t.insertItem(node, 0, sep)
+		node.children = slices.Insert(node.children, 0, l.root)
+		l.root.parent = node
+		return t.graft(r, node, 0)
+	}
+}
+
+// graft finishes a join3 once a subtree was hung from node, next to the
+// entry at index. The grafted root may be underfull and node may overflow.
+func (t *BTree[K, V]) graft(p piece[K, V], node *Node[K, V], index int) piece[K, V] {
+	if t.underflows(node.children[index]) || t.underflows(node.children[index+1]) {
+		t.redistribute(node, index)
+	}
+	t.root = p.root
+	t.split(node) // also refreshes the counts up to the root
+	if t.root != p.root {
+		p.height++
+	}
+	p.root = t.root
+	t.root = nil
+	return p
+}
+
+// insertPiece adds item, which is lower or greater than every key, to p
+func (t *BTree[K, V]) insertPiece(p piece[K, V], item Item[K, V]) piece[K, V] {
+	t.root = p.root
+	// the item goes to the leftmost or the rightmost leaf
+	node := p.root
+	for !t.isLeaf(node) {
+		if t.Less(item.Key, t.key(node, 0)) < 0 {
+			node = node.children[0]
+		} else {
+			node = node.children[len(node.children)-1]
+		}
+	}
+	t.insertLeaf(node, item)
+	if t.root != p.root {
+		p.height++
+	}
+	p.root = t.root
+	t.root = nil
+	return p
+}
+
+func (t *BTree[K, V]) underflows(node *Node[K, V]) bool {
+	return len(node.keys) < t.minEntries()
+}
+
+// redistribute evens out children index and index+1 of parent. If their
+// entries plus the separator fit in one node they are merged, otherwise they
+// are spread in halves, which leaves both at least at minEntries.
+func (t *BTree[K, V]) redistribute(parent *Node[K, V], index int) {
+	left, right := parent.children[index], parent.children[index+1]
+	sep := t.item(parent, index)
+
+	if len(left.keys)+1+len(right.keys) <= t.maxEntries() {
+		t.appendItem(left, sep)
+		t.appendRange(left, right, 0, len(right.keys))
+		left.children = append(left.children, right.children...)
+		setParent(left.children, left)
+		t.deleteItems(parent, index, index+1)
+		parent.children = slices.Delete(parent.children, index+1, index+2)
+		t.refreshNode(left)
+		t.freeNode(right)
+		return
+	}
+
+	all := &Node[K, V]{children: slices.Concat(left.children, right.children)}
+	t.appendRange(all, left, 0, len(left.keys))
+	t.appendItem(all, sep)
+	t.appendRange(all, right, 0, len(right.keys))
+
+	middle := len(all.keys) / 2
+	t.truncate(left, 0)
+	t.appendRange(left, all, 0, middle)
+	t.truncate(right, 0)
+	t.appendRange(right, all, middle+1, len(all.keys))
+	t.setItem(parent, index, t.item(all, middle))
+	if len(all.children) > 0 {
+		clear(left.children)
+		clear(right.children)
+		left.children = append(left.children[:0], all.children[:middle+1]...)
+		right.children = append(right.children[:0], all.children[middle+1:]...)
+		setParent(left.children, left)
+		setParent(right.children, right)
+	}
+	t.refreshNode(left)
+	t.refreshNode(right)
+}
@@ -0,0 +1,127 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sequentialTree(order, from, to int) *BTree[int, int] {
+	tree := NewBTree[int, int](order, cmpInt)
+	for i := from; i < to; i++ {
+		tree.Put(i, i)
+	}
+	return tree
+}
+
+func assertKeys(t *testing.T, tree *BTree[int, int], from, to int) {
+	assertValidTree(t, tree, to-from)
+	if tree.isEmpty() {
+		return
+	}
+	assertValidStructure(t, tree, tree.root)
+	assert.Nil(t, tree.root.parent)
+	next := from
+	for k := range tree.All() {
+		assert.Equal(t, next, k)
+		next++
+	}
+	assert.Equal(t, to, next)
+}
+
+func TestSplitAt(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, n := range []int{0, 1, 2, 10, 100, 500} {
+			for _, key := range []int{-1, 0, 1, n / 3, n / 2, n - 1, n, n + 5} {
+				tree := sequentialTree(order, 0, n)
+				left, right := tree.SplitAt(key)
+
+				cut := min(max(key, 0), n)
+				assertKeys(t, left, 0, cut)
+				assertKeys(t, right, cut, n)
+				assert.True(t, tree.isEmpty())
+
+				// both halves keep working as normal trees
+				left.Put(-10, 0)
+				right.Put(n+10, 0)
+				assertValidStructure(t, left, left.root)
+				assertValidStructure(t, right, right.root)
+			}
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	for order := 3; order <= 7; order++ {
+		for _, sizes := range [][2]int{{0, 0}, {0, 5}, {5, 0}, {1, 1}, {1, 300}, {300, 1}, {3, 500}, {500, 3}, {200, 200}} {
+			left := sequentialTree(order, 0, sizes[0])
+			right := sequentialTree(order, sizes[0], sizes[0]+sizes[1])
+			joined, err := Join(left, right)
+			assert.NoError(t, err)
+			assertKeys(t, joined, 0, sizes[0]+sizes[1])
+			assert.True(t, left.isEmpty())
+			assert.True(t, right.isEmpty())
+		}
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	_, err := Join(sequentialTree(3, 0, 10), sequentialTree(3, 5, 15))
+	assert.ErrorIs(t, err, ErrOverlap)
+	_, err = Join(sequentialTree(3, 0, 10), sequentialTree(4, 10, 15))
+	assert.ErrorIs(t, err, ErrDegreeMismatch)
+
+	reversed := NewBTree[int, int](3, func(a, b int) int { return cmpInt(b, a) })
+	reversed.Put(20, 20)
+	_, err = Join(sequentialTree(3, 0, 10), reversed)
+	assert.ErrorIs(t, err, ErrIncompatible)
+
+	plain, compressed := NewOrdered[string, int](3), NewPrefixCompressed[string, int](3)
+	plain.Put("a", 1)
+	compressed.Put("b", 2)
+	_, err = Join(plain, compressed)
+	assert.ErrorIs(t, err, ErrIncompatible)
+	assert.Equal(t, 1, plain.Len(), "inputs are left alone on error")
+
+	// each keeps its own aggregates, nodes of one are unknown to the other
+	a, b := NewAugmented[int, int](3, cmpInt, maxMonoid()), NewAugmented[int, int](3, cmpInt, maxMonoid())
+	for i := 0; i < 10; i++ {
+		a.Put(i, i)
+		b.Put(i+10, i+10)
+	}
+	_, err = Join(a.BTree, b.BTree)
+	assert.ErrorIs(t, err, ErrIncompatible)
+	_, err = Join(a.BTree, sequentialTree(3, 10, 20))
+	assert.ErrorIs(t, err, ErrIncompatible)
+}
+
+func TestJoinReportsNothing(t *testing.T) {
+	left, right := sequentialTree(3, 0, 10), sequentialTree(3, 10, 20)
+	counters := right.Stats().Counters
+	right.OnDelete(func(k, _ int) { t.Errorf("Join reported deleting %d", k) })
+	joined, err := Join(left, right)
+	assert.NoError(t, err)
+	assertKeys(t, joined, 0, 20)
+	assert.Equal(t, counters, right.Stats().Counters)
+}
+
+func TestSplitJoinRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	tree := NewAugmented[int, int](4, cmpInt, sumMonoid())
+	for i := 0; i < 1000; i++ {
+		tree.Put(r.Intn(5000), 1)
+	}
+	total, size := tree.Total(), tree.Len()
+
+	for i := 0; i < 20; i++ {
+		left, right := tree.SplitAt(r.Intn(5000))
+		assert.Equal(t, size, left.Len()+right.Len())
+		joined, err := Join(left, right)
+		assert.NoError(t, err)
+		assertValidStructure(t, joined, joined.root)
+		tree.BTree = joined
+	}
+	assert.Equal(t, total, tree.Total(), "aggregates survive the grafts")
+	assertValidAggregates(t, tree, tree.root)
+}
@@ -0,0 +1,77 @@
+package btree
+
+import "unsafe"
+
+// Counters accumulate how many times the tree had to restructure itself
+// since it was created or since the last ResetCounters
+type Counters struct {
+	Splits        int // nodes split because they overflowed, the root included
+	Merges        int // pairs of siblings merged because one underflowed
+	Borrows       int // entries rotated from a sibling to fix an underflow
+	RootCollapses int // times the root was left empty and its child took over
+}
+
+// Stats is a snapshot of the shape of the tree, useful to pick the order
+type Stats struct {
+	Height int
+	Nodes  int
+	Leaves int
+	Size   int // number of entries
+
+	MinNodeEntries int // the root is left out unless it is the only node
+	MaxNodeEntries int
+	AvgNodeEntries float64
+
+	// FillFactor has one value per level, from the root down: entries in the
+	// level over the entries its nodes could hold
+	FillFactor []float64
+
+	// MemoryBytes is a shallow estimate of the memory held by nodes and items,
+	// what keys and values point to (string bytes, slices...) is not counted
+	MemoryBytes int
+
+	Counters
+}
+
+// Stats walks the whole tree, so it costs O(n)
+func (t *BTree[K, V]) Stats() Stats {
+	s := Stats{Size: t.size, Counters: t.counters}
+	if t.isEmpty() {
+		return s
+	}
+
+	var (
+		nodeSize  = int(unsafe.Sizeof(Node[K, V]{}))
+		keySize   = int(unsafe.Sizeof(*new(K)))
+		valueSize = int(unsafe.Sizeof(*new(V)))
+		ptrSize   = int(unsafe.Sizeof(uintptr(0)))
+	)
+	s.MinNodeEntries = -1
+	for _, level := range t.levels() {
+		entries := 0
+		for _, d := range level {
+			n := len(d.node.keys)
+			entries += n
+			s.Nodes++
+			if t.isLeaf(d.node) {
+				s.Leaves++
+			}
+			if d.node != t.root || t.isLeaf(t.root) {
+				if s.MinNodeEntries == -1 || n < s.MinNodeEntries {
+					s.MinNodeEntries = n
+				}
+			}
+			s.MaxNodeEntries = max(s.MaxNodeEntries, n)
+			s.MemoryBytes += nodeSize + cap(d.node.keys)*keySize + cap(d.node.values)*valueSize + cap(d.node.children)*ptrSize
+		}
+		s.FillFactor = append(s.FillFactor, float64(entries)/float64(len(level)*t.maxEntries()))
+	}
+	s.Height = len(s.FillFactor)
+	s.AvgNodeEntries = float64(t.size) / float64(s.Nodes)
+	return s
+}
+
+// ResetCounters sets the restructuring counters back to zero
+func (t *BTree[K, V]) ResetCounters() {
+	t.counters = Counters{}
+}
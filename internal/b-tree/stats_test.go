@@ -0,0 +1,48 @@
+package btree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsShape(t *testing.T) {
+	empty := NewBTree[int, int](3, cmpInt).Stats()
+	assert.Equal(t, Stats{}, empty)
+
+	//		[4]
+	//	[2]		[6]
+	// [1] [3] [5] [7]
+	s := sequentialTree(3, 1, 8).Stats()
+	assert.Equal(t, 3, s.Height)
+	assert.Equal(t, 7, s.Nodes)
+	assert.Equal(t, 4, s.Leaves)
+	assert.Equal(t, 7, s.Size)
+	assert.Equal(t, 1, s.MinNodeEntries)
+	assert.Equal(t, 1, s.MaxNodeEntries)
+	assert.Equal(t, 1.0, s.AvgNodeEntries)
+	assert.Equal(t, []float64{0.5, 0.5, 0.5}, s.FillFactor)
+	assert.Positive(t, s.MemoryBytes)
+
+	// a single leaf root counts for the minimum
+	s = sequentialTree(5, 0, 1).Stats()
+	assert.Equal(t, 1, s.MinNodeEntries)
+	assert.Equal(t, []float64{0.25}, s.FillFactor)
+}
+
+func TestStatsCounters(t *testing.T) {
+	tree := sequentialTree(3, 1, 8)
+	// puts 3, 5 and 7 split a leaf, 7 also splits the root above it
+	assert.Equal(t, Counters{Splits: 4}, tree.Stats().Counters)
+
+	tree.ResetCounters()
+	tree.Delete(1) // series of underflows, see TestBTreeRemove7
+	assert.Equal(t, Counters{Merges: 2, RootCollapses: 1}, tree.Stats().Counters)
+
+	tree.ResetCounters()
+	tree.Put(8, 0)
+	tree.Delete(5) // leaf [5] borrows through the parent from [7,8]
+	c := tree.Stats().Counters
+	assert.Equal(t, 1, c.Borrows)
+	assert.Zero(t, c.Merges)
+}
@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// Codec knows how to turn a value of type T into bytes and back, it is what
+// lets the on-disk pieces (log, snapshots, tables) store any key or value type
+type Codec[T any] interface {
+	// Encode appends the encoding of v to dst and returns the extended slice,
+	// or an error for a value that can't be encoded
+	Encode(dst []byte, v T) ([]byte, error)
+	// Decode parses a value previously produced by Encode
+	Decode(src []byte) (T, error)
+}
+
+var ErrShortBuffer = errors.New("codec: short buffer")
+
+// String stores strings as their raw bytes
+type String struct{}
+
+func (String) Encode(dst []byte, v string) ([]byte, error) { return append(dst, v...), nil }
+
+func (String) Decode(src []byte) (string, error) { return string(src), nil }
+
+// Bytes stores byte slices as is, Decode returns a copy so callers can keep it
+type Bytes struct{}
+
+func (Bytes) Encode(dst []byte, v []byte) ([]byte, error) { return append(dst, v...), nil }
+
+func (Bytes) Decode(src []byte) ([]byte, error) { return bytes.Clone(src), nil }
+
+// Int stores ints as zig-zag varints
+type Int struct{}
+
+func (Int) Encode(dst []byte, v int) ([]byte, error) { return binary.AppendVarint(dst, int64(v)), nil }
+
+func (Int) Decode(src []byte) (int, error) {
+	v, n := binary.Varint(src)
+	if n <= 0 {
+		return 0, ErrShortBuffer
+	}
+	return int(v), nil
+}
+
+// Uint64 stores uint64 as fixed 8 bytes big endian, so encoded keys keep the
+// numeric order when compared as bytes
+type Uint64 struct{}
+
+func (Uint64) Encode(dst []byte, v uint64) ([]byte, error) {
+	return binary.BigEndian.AppendUint64(dst, v), nil
+}
+
+func (Uint64) Decode(src []byte) (uint64, error) {
+	if len(src) < 8 {
+		return 0, ErrShortBuffer
+	}
+	return binary.BigEndian.Uint64(src), nil
+}
+
+// Gob is the fallback for any type encoding/gob can handle, it is slower and
+// bigger than the specialized codecs but needs no extra code. Types gob
+// can't handle, such as those with chan or func fields, fail to encode.
+type Gob[T any] struct{}
+
+func (Gob[T]) Encode(dst []byte, v T) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := gob.NewEncoder(buf).Encode(&v); err != nil {
+		return dst, fmt.Errorf("codec: gob encode: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob[T]) Decode(src []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(src)).Decode(&v)
+	return v, err
+}
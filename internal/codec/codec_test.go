@@ -0,0 +1,44 @@
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func roundTrip[T any](t *testing.T, c Codec[T], v T) {
+	b, err := c.Encode(nil, v)
+	assert.NoError(t, err)
+	got, err := c.Decode(b)
+	assert.NoError(t, err)
+	assert.Equal(t, v, got)
+}
+
+func TestRoundTrip(t *testing.T) {
+	roundTrip[string](t, String{}, "tenant/123/obj")
+	roundTrip[[]byte](t, Bytes{}, []byte{0, 1, 2})
+	roundTrip[int](t, Int{}, -42)
+	roundTrip[uint64](t, Uint64{}, 1<<60)
+	roundTrip[map[string]int](t, Gob[map[string]int]{}, map[string]int{"a": 1})
+}
+
+func TestUint64KeepsOrder(t *testing.T) {
+	a, _ := Uint64{}.Encode(nil, 255)
+	b, _ := Uint64{}.Encode(nil, 256)
+	assert.Less(t, string(a), string(b))
+}
+
+func TestDecodeShortBuffer(t *testing.T) {
+	_, err := Uint64{}.Decode([]byte{1, 2})
+	assert.ErrorIs(t, err, ErrShortBuffer)
+	_, err = Int{}.Decode(nil)
+	assert.ErrorIs(t, err, ErrShortBuffer)
+}
+
+func TestGobEncodeError(t *testing.T) {
+	type withFunc struct{ F func() }
+	dst := []byte("prefix")
+	got, err := Gob[withFunc]{}.Encode(dst, withFunc{F: func() {}})
+	assert.Error(t, err)
+	assert.Equal(t, []byte("prefix"), got)
+}
@@ -0,0 +1,296 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+var ErrCompaction = errors.New("lsm: invalid compaction")
+
+// job is a Compaction with its inputs resolved
+type job[K comparable, V any] struct {
+	*Compaction
+	// inputs in the order reads go through them, newest first
+	inputs []*table[K, V]
+	// tombstones can go once no older table may hold the keys they hide
+	dropTombstones bool
+}
+
+// Compact runs compactions until the Strategy has nothing to pick, which is
+// what the background compactor does each time the Scheduler wakes it up
+func (db *DB[K, V]) Compact() error {
+	for {
+		ran, err := db.compactOnce()
+		if err != nil || !ran {
+			return err
+		}
+	}
+}
+
+// compactOnce runs the compaction the strategy picks, if any. The inputs
+// are merged without holding the lock, reads and writes go on meanwhile and
+// the result is swapped in at the end. Flushes only add tables at the front
+// of level 0, which doesn't change what the job has to do.
+func (db *DB[K, V]) compactOnce() (bool, error) {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return false, ErrClosed
+	}
+	var c *Compaction
+	if db.opts.Strategy != nil {
+		c = db.opts.Strategy.Pick(db.levelInfo())
+	}
+	var j *job[K, V]
+	var err error
+	if c != nil {
+		j, err = db.plan(c)
+	}
+	db.mu.RUnlock()
+	if c == nil || err != nil {
+		return false, err
+	}
+
+	outputs, err := db.run(j)
+	if err != nil {
+		return false, err
+	}
+	return true, db.install(j, outputs)
+}
+
+func (db *DB[K, V]) levelInfo() [][]TableInfo {
+	levels := make([][]TableInfo, len(db.levels))
+	for i, level := range db.levels {
+		for _, t := range level {
+			levels[i] = append(levels[i], TableInfo{Seq: t.seq, Size: t.size(), Count: t.reader.Len()})
+		}
+	}
+	return levels
+}
+
+// plan checks the compaction and completes its inputs, see Compaction
+func (db *DB[K, V]) plan(c *Compaction) (*job[K, V], error) {
+	switch {
+	case c.Level < 0 || c.Level >= len(db.levels) || len(c.Inputs) == 0:
+		return nil, fmt.Errorf("%w: no inputs in level %d", ErrCompaction, c.Level)
+	case c.Output == c.Level && c.Level != 0:
+		return nil, fmt.Errorf("%w: only level 0 is compacted in place", ErrCompaction)
+	case c.Output != c.Level && c.Output != c.Level+1:
+		return nil, fmt.Errorf("%w: level %d can't go to %d", ErrCompaction, c.Level, c.Output)
+	}
+	level := db.levels[c.Level]
+	var positions []int
+	for _, seq := range c.Inputs {
+		i := slices.IndexFunc(level, func(t *table[K, V]) bool { return t.seq == seq })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: table %d is not in level %d", ErrCompaction, seq, c.Level)
+		}
+		positions = append(positions, i)
+	}
+	slices.Sort(positions)
+	positions = slices.Compact(positions)
+	first, last := positions[0], positions[len(positions)-1]
+
+	j := &job[K, V]{Compaction: c}
+	switch {
+	case c.Output == 0:
+		if last-first+1 != len(positions) {
+			return nil, fmt.Errorf("%w: level 0 inputs must be next to each other", ErrCompaction)
+		}
+		j.inputs = slices.Clone(level[first : last+1])
+	case c.Level == 0:
+		last = len(level) - 1
+		j.inputs = slices.Clone(level[first:])
+	default:
+		for _, i := range positions {
+			j.inputs = append(j.inputs, level[i])
+		}
+	}
+
+	lo, hi, ok := db.keyRange(j.inputs)
+	if !ok {
+		return j, nil // only empty tables, nothing to merge
+	}
+	var older []*table[K, V]
+	if c.Output == 0 {
+		older = append(older, level[last+1:]...)
+		for _, below := range db.levels[1:] {
+			older = append(older, below...)
+		}
+	} else {
+		if c.Output < len(db.levels) {
+			for _, t := range db.levels[c.Output] {
+				if t.overlaps(db.cmp, lo, hi) {
+					j.inputs = append(j.inputs, t)
+				}
+			}
+			lo, hi, _ = db.keyRange(j.inputs)
+		}
+		for _, below := range db.levels[min(c.Output+1, len(db.levels)):] {
+			older = append(older, below...)
+		}
+	}
+	j.dropTombstones = !slices.ContainsFunc(older, func(t *table[K, V]) bool {
+		return t.overlaps(db.cmp, lo, hi)
+	})
+	return j, nil
+}
+
+// keyRange returns the smallest and the greatest keys of the tables
+func (db *DB[K, V]) keyRange(tables []*table[K, V]) (lo, hi K, ok bool) {
+	for _, t := range tables {
+		if t.reader.Len() == 0 {
+			continue
+		}
+		if !ok || db.cmp(t.min, lo) < 0 {
+			lo = t.min
+		}
+		if !ok || db.cmp(t.max, hi) > 0 {
+			hi = t.max
+		}
+		ok = true
+	}
+	return lo, hi, ok
+}
+
+func (db *DB[K, V]) allocSeq() uint64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	seq := db.nextSeq
+	db.nextSeq++
+	return seq
+}
+
+// run merges the inputs into new tables, only the newest version of each key
+// is kept. It returns the sequence numbers of the tables written.
+func (db *DB[K, V]) run(j *job[K, V]) ([]uint64, error) {
+	var outputs []uint64
+	var tf *tableFile[K, V]
+	fail := func(err error) ([]uint64, error) {
+		if tf != nil {
+			tf.abort()
+		}
+		for _, seq := range outputs {
+			os.Remove(tablePath(db.dir, seq))
+		}
+		return nil, err
+	}
+
+	var broken error
+	sources := db.tableSources(slices.Values(j.inputs), &broken)
+	for k, e := range merge(db.cmp, sources) {
+		if broken != nil {
+			return fail(broken)
+		}
+		if e.tombstone && j.dropTombstones {
+			continue
+		}
+		if tf == nil {
+			var err error
+			if tf, err = db.createTable(db.allocSeq()); err != nil {
+				return fail(err)
+			}
+		}
+		if err := tf.w.Add(k, e); err != nil {
+			return fail(err)
+		}
+		if j.MaxTableSize > 0 && int64(tf.w.Size()) >= j.MaxTableSize {
+			if err := tf.finish(); err != nil {
+				tf = nil
+				return fail(err)
+			}
+			outputs, tf = append(outputs, tf.seq), nil
+		}
+	}
+	if broken != nil {
+		return fail(broken)
+	}
+	if tf != nil {
+		if err := tf.finish(); err != nil {
+			tf = nil
+			return fail(err)
+		}
+		outputs = append(outputs, tf.seq)
+	}
+	return outputs, nil
+}
+
+// install replaces the inputs of the job with its outputs, the input files
+// are removed once the new manifest is written and nothing reads them
+func (db *DB[K, V]) install(j *job[K, V], outputs []uint64) error {
+	db.mu.Lock()
+	var tables []*table[K, V]
+	var written int64
+	for _, seq := range outputs {
+		t, err := db.openTable(seq)
+		if err != nil {
+			db.mu.Unlock()
+			for _, t := range tables {
+				t.reader.Close()
+			}
+			for _, seq := range outputs {
+				os.Remove(tablePath(db.dir, seq))
+			}
+			return err
+		}
+		tables = append(tables, t)
+		written += t.size()
+	}
+
+	levels := make([][]*table[K, V], max(len(db.levels), j.Output+1))
+	for i, level := range db.levels {
+		levels[i] = slices.DeleteFunc(slices.Clone(level), func(t *table[K, V]) bool {
+			return slices.Contains(j.inputs, t)
+		})
+	}
+	if j.Output == 0 {
+		// where the run was, flushes may have added tables in front of it
+		at := slices.Index(db.levels[0], j.inputs[0])
+		levels[0] = slices.Insert(levels[0], at, tables...)
+	} else {
+		levels[j.Output] = append(levels[j.Output], tables...)
+		slices.SortFunc(levels[j.Output], func(a, b *table[K, V]) int { return db.cmp(a.min, b.min) })
+	}
+	if err := db.writeManifest(levels); err != nil {
+		db.mu.Unlock()
+		for _, t := range tables {
+			t.reader.Close()
+			os.Remove(t.path)
+		}
+		return err
+	}
+	db.levels = levels
+	db.stats.Compactions++
+	db.stats.CompactedBytes += written
+	db.mu.Unlock()
+
+	// iterators that pinned the inputs may still be reading them, the files
+	// go when the last of them is done
+	var err error
+	for _, t := range j.inputs {
+		t.obsolete.Store(true)
+		if uerr := t.unref(); err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// compactor is the background goroutine started when a Scheduler is set
+func (db *DB[K, V]) compactor() {
+	defer db.wg.Done()
+	for db.opts.Scheduler.Wait(db.done) {
+		if err := db.Compact(); err != nil && !errors.Is(err, ErrClosed) {
+			db.mu.Lock()
+			if db.bgErr == nil {
+				db.bgErr = err
+			}
+			db.mu.Unlock()
+		}
+	}
+}
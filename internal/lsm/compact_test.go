@@ -0,0 +1,420 @@
+package lsm
+
+import (
+	"cmp"
+	"maps"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/LucasUTNFRD/db-from-scratch/internal/sstable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// churn writes n random puts and deletes over keys 0..keys-1 and returns the
+// expected contents
+func churn(t *testing.T, db *DB[int, int], r *rand.Rand, n, keys int, expected map[int]int) {
+	for i := 0; i < n; i++ {
+		k := r.Intn(keys)
+		if r.Intn(5) == 0 {
+			require.NoError(t, db.Delete(k))
+			delete(expected, k)
+		} else {
+			require.NoError(t, db.Put(k, i))
+			expected[k] = i
+		}
+	}
+}
+
+// assertLevels checks that the levels below 0 are sorted and don't overlap
+func assertLevels(t *testing.T, db *DB[int, int]) {
+	for i, level := range db.levels {
+		if i == 0 {
+			continue
+		}
+		for j := 1; j < len(level); j++ {
+			assert.Less(t, level[j-1].max, level[j].min, "level %d", i)
+		}
+	}
+}
+
+func smallTables() Options {
+	return Options{Order: 8, MemtableSize: 512, Table: sstable.Options{BlockSize: 256}}
+}
+
+func TestLeveledCompaction(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallTables()
+	opts.Strategy = Leveled{L0Tables: 2, BaseSize: 2 << 10, Multiplier: 3, TableSize: 1 << 10}
+	db := openIntDB(t, dir, opts)
+	r := rand.New(rand.NewSource(2))
+	expected := map[int]int{}
+	for round := 0; round < 10; round++ {
+		churn(t, db, r, 1000, 2000, expected)
+		require.NoError(t, db.Compact())
+		assertLevels(t, db)
+		assertContents(t, db, expected)
+	}
+	assert.Less(t, len(db.levels[0]), 2)
+	assert.GreaterOrEqual(t, len(db.levels), 3, "data went down several levels")
+	stats := db.Stats()
+	assert.Positive(t, stats.Compactions)
+	assert.Greater(t, stats.WriteAmplification(), 1.0)
+	levels := len(db.levels)
+	require.NoError(t, db.Close())
+
+	db = openIntDB(t, dir, opts)
+	defer db.Close()
+	assert.Len(t, db.levels, levels, "levels come back from the manifest")
+	assertLevels(t, db)
+	assertContents(t, db, expected)
+}
+
+func TestSizeTieredCompaction(t *testing.T) {
+	opts := smallTables()
+	opts.Strategy = SizeTiered{MinTables: 4, MinSize: 1}
+	db := openIntDB(t, t.TempDir(), opts)
+	defer db.Close()
+	r := rand.New(rand.NewSource(3))
+	expected := map[int]int{}
+	for round := 0; round < 10; round++ {
+		churn(t, db, r, 500, 1000, expected)
+		require.NoError(t, db.Compact())
+		assertContents(t, db, expected)
+	}
+	assert.Len(t, db.levels, 1, "everything stays in level 0")
+	assert.Less(t, len(db.levels[0]), 20)
+	assert.Positive(t, db.Stats().Compactions)
+}
+
+// strategy lets a test pick compactions by hand
+type strategy func(levels [][]TableInfo) *Compaction
+
+func (s strategy) Pick(levels [][]TableInfo) *Compaction {
+	return s(levels)
+}
+
+// once returns a strategy that picks c the first time only
+func once(c *Compaction) strategy {
+	done := false
+	return func([][]TableInfo) *Compaction {
+		if done {
+			return nil
+		}
+		done = true
+		return c
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{})
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Put(i, i))
+	}
+	require.NoError(t, db.Flush()) // seq 1
+	for i := 0; i < 50; i++ {
+		require.NoError(t, db.Delete(i))
+	}
+	require.NoError(t, db.Flush()) // seq 2
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put(i, -i))
+	}
+	require.NoError(t, db.Flush()) // seq 3
+
+	// table 1 still holds what the tombstones hide, they must stay
+	db.opts.Strategy = once(&Compaction{Level: 0, Inputs: []uint64{3, 2}, Output: 0})
+	require.NoError(t, db.Compact())
+	assert.Len(t, db.levels[0], 2)
+	assert.Equal(t, 50, db.levels[0][0].reader.Len(), "10 values and 40 tombstones")
+	_, found, err := db.Get(20)
+	require.NoError(t, err)
+	assert.False(t, found)
+	v, _, _ := db.Get(5)
+	assert.Equal(t, -5, v)
+
+	// with nothing below, they go away along with the values they shadow
+	db.opts.Strategy = once(&Compaction{Level: 0, Inputs: []uint64{4, 1}, Output: 1})
+	require.NoError(t, db.Compact())
+	assert.Empty(t, db.levels[0])
+	require.Len(t, db.levels[1], 1)
+	assert.Equal(t, 60, db.levels[1][0].reader.Len())
+	expected := map[int]int{}
+	for i := 0; i < 100; i++ {
+		if i < 10 {
+			expected[i] = -i
+		} else if i >= 50 {
+			expected[i] = i
+		}
+	}
+	assertContents(t, db, expected)
+
+	// only tombstones left, nothing is written at all
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Delete(i))
+	}
+	require.NoError(t, db.Flush())
+	db.opts.Strategy = once(&Compaction{Level: 0, Inputs: []uint64{6}, Output: 1})
+	require.NoError(t, db.Compact())
+	assert.Zero(t, db.Stats().TableBytes())
+	assertContents(t, db, map[int]int{})
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "only the manifest, every input was removed")
+	require.NoError(t, db.Close())
+}
+
+func TestCompactionInputsAreCompleted(t *testing.T) {
+	db := openIntDB(t, t.TempDir(), Options{})
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Put(1, i))
+		require.NoError(t, db.Flush())
+	}
+	// only the newest table is named, the two older ones must come along or
+	// they would hide it once it is in level 1
+	db.opts.Strategy = once(&Compaction{Level: 0, Inputs: []uint64{3}, Output: 1})
+	require.NoError(t, db.Compact())
+	assert.Empty(t, db.levels[0])
+	v, _, _ := db.Get(1)
+	assert.Equal(t, 2, v)
+
+	require.NoError(t, db.Put(1, 10))
+	require.NoError(t, db.Put(2, 20))
+	require.NoError(t, db.Flush())
+	db.opts.Strategy = once(&Compaction{Level: 0, Inputs: []uint64{5}, Output: 1})
+	require.NoError(t, db.Compact())
+	require.Len(t, db.levels[1], 1, "the overlapping table of level 1 was merged in")
+	assertContents(t, db, map[int]int{1: 10, 2: 20})
+}
+
+func TestInvalidCompaction(t *testing.T) {
+	db := openIntDB(t, t.TempDir(), Options{})
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Put(i, i))
+		require.NoError(t, db.Flush())
+	}
+	for _, c := range []*Compaction{
+		{Level: 0, Inputs: []uint64{3, 1}, Output: 0},
+		{Level: 0, Inputs: []uint64{7}, Output: 1},
+		{Level: 0, Inputs: nil, Output: 1},
+		{Level: 0, Inputs: []uint64{1}, Output: 2},
+		{Level: 3, Inputs: []uint64{1}, Output: 4},
+	} {
+		db.opts.Strategy = once(c)
+		assert.ErrorIs(t, db.Compact(), ErrCompaction, "%+v", c)
+	}
+	assertContents(t, db, map[int]int{0: 0, 1: 1, 2: 2})
+}
+
+func TestBackgroundCompaction(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallTables()
+	opts.Strategy = Leveled{L0Tables: 2, BaseSize: 4 << 10, TableSize: 1 << 10}
+	opts.Scheduler = AfterFlush()
+	db := openIntDB(t, dir, opts)
+	r := rand.New(rand.NewSource(4))
+	expected := map[int]int{}
+	churn(t, db, r, 5000, 1000, expected)
+
+	assert.Eventually(t, func() bool {
+		s := db.Stats()
+		return s.Compactions > 0 && s.Levels[0].Tables < 2
+	}, 5*time.Second, time.Millisecond)
+	assertContents(t, db, expected)
+	require.NoError(t, db.Close())
+
+	db = openIntDB(t, dir, Options{})
+	defer db.Close()
+	assertContents(t, db, expected)
+}
+
+func TestAllPinsCompactedTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{})
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Put(i, i))
+		require.NoError(t, db.Flush())
+	}
+	db.opts.Strategy = SizeTiered{MinTables: 3}
+
+	n := 0
+	var err error
+	for range db.All(&err) {
+		if n == 0 {
+			require.NoError(t, db.Compact())
+			assert.Len(t, db.levels[0], 1)
+			for seq := uint64(1); seq <= 3; seq++ {
+				assert.FileExists(t, tablePath(dir, seq), "still read by the loop")
+			}
+		}
+		n++
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	for seq := uint64(1); seq <= 3; seq++ {
+		assert.NoFileExists(t, tablePath(dir, seq), "removed once the loop is done")
+	}
+	assertContents(t, db, map[int]int{0: 0, 1: 1, 2: 2})
+}
+
+func TestAllWhileCompacting(t *testing.T) {
+	dir := t.TempDir()
+	opts := smallTables()
+	opts.Strategy = Leveled{L0Tables: 2, BaseSize: 4 << 10, TableSize: 1 << 10}
+	opts.Scheduler = AfterFlush()
+	db := openIntDB(t, dir, opts)
+	r := rand.New(rand.NewSource(5))
+	expected := map[int]int{}
+	churn(t, db, r, 3000, 1000, expected)
+	before := maps.Clone(expected)
+
+	// the writes from the loop flush and wake up the compactor, which swaps
+	// out the tables the loop reads while the loop takes the lock again
+	n := 0
+	var err error
+	for k, v := range db.All(&err) {
+		assert.Equal(t, before[k], v, "key %d", k)
+		got, found, gerr := db.Get(k)
+		require.NoError(t, gerr)
+		assert.True(t, found, "key %d", k)
+		assert.Equal(t, v, got)
+		require.NoError(t, db.Put(k+1000, v))
+		expected[k+1000] = v
+		n++
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, len(before), n, "writes made during the loop aren't seen")
+	assertContents(t, db, expected)
+	require.NoError(t, db.Close())
+
+	// replaced tables didn't stay behind
+	db = openIntDB(t, dir, Options{})
+	defer db.Close()
+	seqs, err := listTables(dir)
+	require.NoError(t, err)
+	tables := 0
+	for range db.tables() {
+		tables++
+	}
+	assert.Len(t, seqs, tables)
+	assertContents(t, db, expected)
+}
+
+func TestEveryScheduler(t *testing.T) {
+	done := make(chan struct{})
+	s := Every(time.Millisecond)
+	s.Flushed()
+	assert.True(t, s.Wait(done))
+	close(done)
+	assert.False(t, Every(time.Hour).Wait(done))
+	assert.False(t, AfterFlush().Wait(done))
+}
+
+func TestAmplification(t *testing.T) {
+	db := openIntDB(t, t.TempDir(), Options{Table: sstable.Options{BitsPerKey: -1}})
+	defer db.Close()
+	assert.Zero(t, db.Stats().WriteAmplification())
+
+	// the same keys four times over
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, db.Put(i, round))
+		}
+		require.NoError(t, db.Flush())
+	}
+	space, err := db.SpaceAmplification()
+	require.NoError(t, err)
+	assert.InDelta(t, 4, space, 0.2)
+	before := db.Stats()
+	assert.Equal(t, before.TableBytes(), before.FlushedBytes, "each table written once by its flush")
+	assert.Equal(t, float64(before.FlushedBytes)/float64(before.UserBytes), before.WriteAmplification())
+
+	db.opts.Strategy = SizeTiered{MinTables: 4}
+	require.NoError(t, db.Compact())
+	space, err = db.SpaceAmplification()
+	require.NoError(t, err)
+	assert.InDelta(t, 1, space, 0.01)
+	after := db.Stats()
+	assert.Equal(t, 1, after.Compactions)
+	assert.Equal(t, before.TableBytes()/4, after.TableBytes(), "one round survived")
+	assert.InDelta(t, before.WriteAmplification()*1.25, after.WriteAmplification(), 0.01, "the survivors were written again")
+}
+
+// stallingCodec blocks the first decode after stall is set until release is
+// closed
+type stallingCodec struct {
+	codec.Int
+	stall   *atomic.Bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c stallingCodec) Decode(b []byte) (int, error) {
+	if c.stall.CompareAndSwap(true, false) {
+		close(c.entered)
+		<-c.release
+	}
+	return c.Int.Decode(b)
+}
+
+func TestSpaceAmplificationDoesNotBlockFlushes(t *testing.T) {
+	kc := stallingCodec{stall: &atomic.Bool{}, entered: make(chan struct{}), release: make(chan struct{})}
+	db, err := Open[int, int](t.TempDir(), cmp.Compare[int], kc, codec.Int{}, Options{})
+	require.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Put(i, i))
+	}
+	require.NoError(t, db.Flush())
+
+	kc.stall.Store(true)
+	result := make(chan error)
+	go func() {
+		_, err := db.SpaceAmplification()
+		result <- err
+	}()
+	<-kc.entered
+
+	// the merge is stuck in the middle of a table
+	flushed := make(chan error)
+	go func() {
+		require.NoError(t, db.Put(1000, 1000))
+		flushed <- db.Flush()
+	}()
+	select {
+	case err := <-flushed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		close(kc.release)
+		t.Fatal("flush waited for SpaceAmplification")
+	}
+	close(kc.release)
+	assert.NoError(t, <-result)
+	assert.Len(t, db.levels[0], 2)
+}
+
+func TestOrphanTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{})
+	require.NoError(t, db.Put(1, 1))
+	require.NoError(t, db.Close())
+
+	// a table written by a compaction that never made it to the manifest
+	data, err := os.ReadFile(tablePath(dir, 1))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(tablePath(dir, 7), data, 0o644))
+
+	db, err = Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{}, Options{})
+	require.NoError(t, err)
+	assert.NoFileExists(t, tablePath(dir, 7))
+	assert.Equal(t, uint64(8), db.nextSeq, "its number isn't reused")
+	require.NoError(t, db.Close())
+}
@@ -0,0 +1,429 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+	"sync"
+
+	btree "github.com/LucasUTNFRD/db-from-scratch/internal/b-tree"
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/LucasUTNFRD/db-from-scratch/internal/sstable"
+)
+
+var (
+	ErrClosed = errors.New("lsm: db is closed")
+	// ErrCorrupt is returned for a table that fails its checksums
+	ErrCorrupt = sstable.ErrCorrupt
+)
+
+// Options tune an LSM tree
+type Options struct {
+	// Order of the memtable BTree, 32 if zero
+	Order int
+	// MemtableSize is the size in bytes of the encoded keys and values the
+	// memtable holds before it is flushed to a table, 4MB if zero
+	MemtableSize int
+	// Table tunes the blocks and bloom filters of the tables
+	Table sstable.Options
+	// Strategy picks the tables to compact, nil disables compaction
+	Strategy Strategy
+	// Scheduler runs compactions in the background, if nil they only happen
+	// when Compact is called
+	Scheduler Scheduler
+}
+
+// DB is a log-structured merge tree. Writes go to a BTree in memory, the
+// memtable, which is written out as an immutable sorted table once it grows
+// past Options.MemtableSize, so the disk only sees sequential writes.
+//
+// Flushed tables land in level 0, newest first. Compactions merge them into
+// bigger tables, possibly in lower levels, throwing away the versions that
+// newer ones shadow. Reads look at the memtable first and then at the tables
+// level by level, the first version of a key found wins. Tables are
+// SSTables, their bloom filters and key ranges let Get skip most of them
+// without reading a block.
+//
+// The memtable is not logged: what hasn't been flushed is lost if the
+// process dies before Close. A DB is safe for concurrent use.
+type DB[K comparable, V any] struct {
+	mu   sync.RWMutex
+	dir  string
+	cmp  btree.Comparator[K]
+	kc   codec.Codec[K]
+	ec   entryCodec[V]
+	opts Options
+
+	mem     *btree.BTree[K, entry[V]]
+	memSize int
+	// levels[0] goes from newest to oldest and its tables may overlap, the
+	// tables of the other levels don't and are sorted by key
+	levels  [][]*table[K, V]
+	nextSeq uint64
+	closed  bool
+	stats   Stats
+	// flushErr is the error of the last flush a write triggered, the write
+	// itself went through so it is reported by the next one
+	flushErr error
+
+	// one compaction at a time, whether background or Compact
+	compactMu sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+	bgErr     error
+}
+
+// Open loads the LSM tree stored in dir, or creates an empty one
+func Open[K comparable, V any](
+	dir string,
+	cmp btree.Comparator[K],
+	kc codec.Codec[K],
+	vc codec.Codec[V],
+	opts Options,
+) (*DB[K, V], error) {
+	if opts.Order == 0 {
+		opts.Order = 32
+	}
+	if opts.MemtableSize == 0 {
+		opts.MemtableSize = 4 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	db := &DB[K, V]{
+		dir:     dir,
+		cmp:     cmp,
+		kc:      kc,
+		ec:      entryCodec[V]{values: vc},
+		opts:    opts,
+		nextSeq: 1,
+		done:    make(chan struct{}),
+	}
+	db.mem = db.newMemtable()
+	if err := db.load(); err != nil {
+		db.closeTables()
+		return nil, err
+	}
+	if opts.Strategy != nil && opts.Scheduler != nil {
+		db.wg.Add(1)
+		go db.compactor()
+	}
+	return db, nil
+}
+
+// load opens the tables listed by the manifest and removes the others. A
+// directory without manifest has only flushed tables, they all go to level 0.
+func (db *DB[K, V]) load() error {
+	seqs, err := listTables(db.dir)
+	if err != nil {
+		return err
+	}
+	nextSeq, levels, found, err := readManifest(db.dir)
+	if err != nil {
+		return err
+	}
+	if !found {
+		slices.Sort(seqs)
+		slices.Reverse(seqs)
+		levels = [][]uint64{seqs}
+	}
+
+	live := map[uint64]bool{}
+	for _, level := range levels {
+		var tables []*table[K, V]
+		for _, seq := range level {
+			t, err := db.openTable(seq)
+			if err != nil {
+				return err
+			}
+			live[seq] = true
+			tables = append(tables, t)
+		}
+		db.levels = append(db.levels, tables)
+	}
+	db.nextSeq = max(db.nextSeq, nextSeq)
+	for _, seq := range seqs {
+		db.nextSeq = max(db.nextSeq, seq+1)
+		if !live[seq] {
+			if err := os.Remove(tablePath(db.dir, seq)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (db *DB[K, V]) newMemtable() *btree.BTree[K, entry[V]] {
+	return btree.NewBTree[K, entry[V]](db.opts.Order, db.cmp)
+}
+
+// tables returns every table in the order reads go through them
+func (db *DB[K, V]) tables() iter.Seq[*table[K, V]] {
+	return func(yield func(*table[K, V]) bool) {
+		for _, level := range db.levels {
+			for _, t := range level {
+				if !yield(t) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Put stores value under key. The write that fills the memtable flushes it,
+// if that fails the write still went through: the error is returned by the
+// next write, which tries the flush again before doing anything.
+func (db *DB[K, V]) Put(key K, value V) error {
+	return db.write(key, entry[V]{value: value})
+}
+
+// Delete removes key. It doesn't check whether the key exists, it writes a
+// tombstone that hides it from then on.
+func (db *DB[K, V]) Delete(key K) error {
+	return db.write(key, entry[V]{tombstone: true})
+}
+
+func (db *DB[K, V]) write(key K, e entry[V]) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	// nothing gets in while the memtable can't be written out
+	if db.flushErr != nil {
+		if db.flushErr = db.flush(); db.flushErr != nil {
+			return db.flushErr
+		}
+	}
+	// encoding first so an entry that can't be flushed never gets in
+	k, err := db.kc.Encode(nil, key)
+	if err != nil {
+		return err
+	}
+	v, err := db.ec.Encode(nil, e)
+	if err != nil {
+		return err
+	}
+	if err := db.mem.Put(key, e); err != nil {
+		return err
+	}
+	// replaced versions still count, it's only an estimate of the flush size
+	size := len(k) + len(v)
+	db.memSize += size
+	db.stats.UserBytes += int64(size)
+	if db.memSize >= db.opts.MemtableSize {
+		db.flushErr = db.flush()
+	}
+	return nil
+}
+
+// Get returns the newest value of key
+func (db *DB[K, V]) Get(key K) (value V, found bool, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	e, found := db.mem.Get(key)
+	if !found {
+		for t := range db.tables() {
+			if e, found, err = t.get(key); err != nil {
+				return value, false, err
+			}
+			if found {
+				break
+			}
+		}
+	}
+	if !found || e.tombstone {
+		return value, false, nil
+	}
+	return e.value, true, nil
+}
+
+// All returns an iterator over the live keys in order, merging the memtable
+// and every table. It goes over a snapshot taken when the loop starts: the
+// memtable is copied and the tables are pinned so compactions can't remove
+// them, the DB can be used from the loop but what changes meanwhile isn't
+// seen. A table that can't be read ends the iteration early and its error
+// is stored in err, check it once the loop is done.
+func (db *DB[K, V]) All(err *error) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		mem, tables, serr := db.snapshot()
+		if serr != nil {
+			*err = serr
+			return
+		}
+		// once a table stopped in the middle the merge can't be trusted,
+		// newer versions of the keys that follow may be missing
+		var broken error
+		defer func() {
+			if uerr := unpin(tables); broken == nil {
+				broken = uerr
+			}
+			if broken != nil {
+				*err = broken
+			}
+		}()
+		sources := append([]iter.Seq2[K, entry[V]]{mem}, db.tableSources(slices.Values(tables), &broken)...)
+		for k, e := range merge(db.cmp, sources) {
+			if broken != nil || !e.tombstone && !yield(k, e.value) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot copies the memtable and pins the tables, in the order reads go
+// through them. The caller unrefs the tables once done.
+func (db *DB[K, V]) snapshot() (iter.Seq2[K, entry[V]], []*table[K, V], error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, nil, ErrClosed
+	}
+	items := make([]btree.Item[K, entry[V]], 0, db.mem.Len())
+	for k, e := range db.mem.All() {
+		items = append(items, btree.Item[K, entry[V]]{Key: k, Value: e})
+	}
+	tables := db.pin()
+	mem := func(yield func(K, entry[V]) bool) {
+		for _, item := range items {
+			if !yield(item.Key, item.Value) {
+				return
+			}
+		}
+	}
+	return mem, tables, nil
+}
+
+// pin refs the tables in the order reads go through them, so they can be
+// read without the lock. It must be called with mu held.
+func (db *DB[K, V]) pin() []*table[K, V] {
+	var tables []*table[K, V]
+	for t := range db.tables() {
+		t.ref()
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// unpin releases the tables returned by pin
+func unpin[K comparable, V any](tables []*table[K, V]) error {
+	var err error
+	for _, t := range tables {
+		if uerr := t.unref(); err == nil {
+			err = uerr
+		}
+	}
+	return err
+}
+
+// tableSources returns the contents of the tables for a merge, err is set
+// to the first error of a table that can't be read to the end
+func (db *DB[K, V]) tableSources(tables iter.Seq[*table[K, V]], err *error) []iter.Seq2[K, entry[V]] {
+	var sources []iter.Seq2[K, entry[V]]
+	for t := range tables {
+		sources = append(sources, func(yield func(K, entry[V]) bool) {
+			var terr error
+			for k, e := range t.all(&terr) {
+				if !yield(k, e) {
+					return
+				}
+			}
+			if terr != nil && *err == nil {
+				*err = fmt.Errorf("%s: %w", t.path, terr)
+			}
+		})
+	}
+	return sources
+}
+
+// Flush writes the memtable to a new table even if it isn't full
+func (db *DB[K, V]) Flush() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.flushErr = db.flush()
+	return db.flushErr
+}
+
+func (db *DB[K, V]) flush() error {
+	if db.mem.Len() == 0 {
+		return nil
+	}
+	seq := db.nextSeq
+	if err := db.writeTable(seq, db.mem.All()); err != nil {
+		return err
+	}
+	db.nextSeq++
+	t, err := db.openTable(seq)
+	if err != nil {
+		return err
+	}
+	levels := slices.Clone(db.levels)
+	if len(levels) == 0 {
+		levels = append(levels, nil)
+	}
+	levels[0] = slices.Insert(slices.Clone(levels[0]), 0, t)
+	if err := db.writeManifest(levels); err != nil {
+		t.reader.Close()
+		os.Remove(t.path)
+		return err
+	}
+	db.levels = levels
+	db.mem, db.memSize = db.newMemtable(), 0
+	db.stats.FlushedBytes += t.size()
+	if db.opts.Scheduler != nil {
+		db.opts.Scheduler.Flushed()
+	}
+	return nil
+}
+
+func (db *DB[K, V]) writeManifest(levels [][]*table[K, V]) error {
+	seqs := make([][]uint64, len(levels))
+	for i, level := range levels {
+		for _, t := range level {
+			seqs[i] = append(seqs[i], t.seq)
+		}
+	}
+	return writeManifest(db.dir, db.nextSeq, seqs)
+}
+
+// Close stops the background compactor and flushes the memtable, the DB
+// can't be used afterwards. It reports the error of a failed background
+// compaction, if any.
+func (db *DB[K, V]) Close() error {
+	select {
+	case <-db.done:
+		return nil
+	default:
+		close(db.done)
+	}
+	db.wg.Wait()
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
+	err := db.flush()
+	if cerr := db.closeTables(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = db.bgErr
+	}
+	return err
+}
+
+func (db *DB[K, V]) closeTables() error {
+	var err error
+	for t := range db.tables() {
+		if cerr := t.unref(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
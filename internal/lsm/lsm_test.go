@@ -0,0 +1,186 @@
+package lsm
+
+import (
+	"cmp"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openIntDB(t *testing.T, dir string, opts Options) *DB[int, int] {
+	db, err := Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{}, opts)
+	require.NoError(t, err)
+	return db
+}
+
+func assertContents(t *testing.T, db *DB[int, int], expected map[int]int) {
+	n := 0
+	prev := -1
+	var err error
+	for k, v := range db.All(&err) {
+		assert.Greater(t, k, prev, "keys in order")
+		assert.Equal(t, expected[k], v, "key %d", k)
+		prev = k
+		n++
+	}
+	assert.Equal(t, len(expected), n)
+	assert.NoError(t, err)
+	for k, v := range expected {
+		got, found, err := db.Get(k)
+		assert.NoError(t, err)
+		assert.True(t, found, "key %d", k)
+		assert.Equal(t, v, got)
+	}
+}
+
+func TestPutGetDelete(t *testing.T) {
+	db := openIntDB(t, t.TempDir(), Options{Order: 4})
+	defer db.Close()
+	require.NoError(t, db.Put(1, 10))
+	require.NoError(t, db.Put(2, 20))
+	require.NoError(t, db.Put(1, 11))
+	require.NoError(t, db.Delete(2))
+	require.NoError(t, db.Delete(3), "deleting a missing key is fine")
+	assertContents(t, db, map[int]int{1: 11})
+	_, found, err := db.Get(2)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, db.levels[0])
+}
+
+func TestTombstonesShadowOlderTables(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{Order: 4})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.Put(i, i))
+	}
+	require.NoError(t, db.Flush())
+	require.NoError(t, db.Delete(3))
+	require.NoError(t, db.Put(4, 40))
+	require.NoError(t, db.Flush())
+	require.NoError(t, db.Put(3, 30)) // back to life in the memtable
+	require.NoError(t, db.Delete(5))
+
+	expected := map[int]int{0: 0, 1: 1, 2: 2, 3: 30, 4: 40, 6: 6, 7: 7, 8: 8, 9: 9}
+	assertContents(t, db, expected)
+	assert.Len(t, db.levels[0], 2)
+	assert.Equal(t, []uint64{2, 1}, []uint64{db.levels[0][0].seq, db.levels[0][1].seq})
+
+	require.NoError(t, db.Close())
+	assert.ErrorIs(t, db.Put(1, 1), ErrClosed)
+	assert.NoError(t, db.Close())
+
+	db = openIntDB(t, dir, Options{Order: 4})
+	defer db.Close()
+	assert.Len(t, db.levels[0], 3, "close flushed the memtable")
+	assertContents(t, db, expected)
+}
+
+func TestFlushOnSize(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{Order: 8, MemtableSize: 256})
+	r := rand.New(rand.NewSource(1))
+	expected := map[int]int{}
+	for i := 0; i < 5000; i++ {
+		k := r.Intn(500)
+		if r.Intn(4) == 0 {
+			require.NoError(t, db.Delete(k))
+			delete(expected, k)
+		} else {
+			require.NoError(t, db.Put(k, i))
+			expected[k] = i
+		}
+	}
+	assert.Greater(t, len(db.levels[0]), 10)
+	assertContents(t, db, expected)
+	for k := 0; k < 500; k++ {
+		if _, ok := expected[k]; !ok {
+			_, found, err := db.Get(k)
+			assert.NoError(t, err)
+			assert.False(t, found, "key %d", k)
+		}
+	}
+	require.NoError(t, db.Close())
+
+	db = openIntDB(t, dir, Options{Order: 8, MemtableSize: 256})
+	defer db.Close()
+	assertContents(t, db, expected)
+}
+
+func TestOpenCleansUpAndChecks(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{})
+	require.NoError(t, db.Put(1, 1))
+	require.NoError(t, db.Close())
+
+	// a flush that died halfway
+	require.NoError(t, os.WriteFile(tablePath(dir, 2)+".tmp", []byte("half"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644))
+	db = openIntDB(t, dir, Options{})
+	assert.Len(t, db.levels[0], 1)
+	assert.NoFileExists(t, tablePath(dir, 2)+".tmp")
+	require.NoError(t, db.Put(2, 2))
+	require.NoError(t, db.Close())
+	assert.FileExists(t, tablePath(dir, 2))
+
+	// a broken data block is only seen when it is read
+	data, err := os.ReadFile(tablePath(dir, 1))
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(tablePath(dir, 1), data, 0o644))
+	db = openIntDB(t, dir, Options{})
+	_, _, err = db.Get(1)
+	assert.ErrorIs(t, err, ErrCorrupt)
+	v, found, err := db.Get(2)
+	assert.NoError(t, err, "other tables still work")
+	assert.True(t, found)
+	assert.Equal(t, 2, v)
+	err = nil
+	for range db.All(&err) {
+	}
+	assert.ErrorIs(t, err, ErrCorrupt)
+	require.NoError(t, db.Close())
+
+	data[len(data)-5] ^= 0xff // the footer checksum
+	require.NoError(t, os.WriteFile(tablePath(dir, 1), data, 0o644))
+	_, err = Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{}, Options{})
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestFailedFlushIsReportedByNextWrite(t *testing.T) {
+	dir := t.TempDir()
+	db := openIntDB(t, dir, Options{MemtableSize: 64})
+	defer db.Close()
+	// without its directory the memtable can't be written out
+	require.NoError(t, os.RemoveAll(dir))
+	expected := map[int]int{}
+	i := 0
+	for ; db.flushErr == nil; i++ {
+		require.NoError(t, db.Put(i, i), "the write that fills the memtable went through")
+		expected[i] = i
+	}
+	assert.Error(t, db.Put(i, i))
+	assert.Error(t, db.Delete(0))
+	assertContents(t, db, expected)
+
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	require.NoError(t, db.Put(i, i), "the flush is retried first")
+	expected[i] = i
+	assert.Len(t, db.levels[0], 1)
+	assertContents(t, db, expected)
+}
+
+func TestPutEncodeError(t *testing.T) {
+	db, err := Open[int, func()](t.TempDir(), cmp.Compare[int], codec.Int{}, codec.Gob[func()]{}, Options{})
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Error(t, db.Put(1, func() {}))
+	_, found, err := db.Get(1)
+	assert.NoError(t, err)
+	assert.False(t, found, "a value that can't be encoded is not stored")
+}
@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// The manifest lists the live tables level by level, in the order reads go
+// through them:
+//
+//	[magic "LSMMANI1"][next seq uvarint][levels uvarint]
+//	[tables uvarint][seq uvarint] x tables, for every level
+//	[crc32c uint32]
+//
+// A flush or a compaction only takes effect once the manifest that includes
+// its tables replaced the previous one, tables it doesn't list are leftovers
+// of a crash and are removed by Open.
+const (
+	manifestFile  = "MANIFEST"
+	manifestMagic = "LSMMANI1"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func writeManifest(dir string, nextSeq uint64, levels [][]uint64) error {
+	buf := append([]byte(manifestMagic), binary.AppendUvarint(nil, nextSeq)...)
+	buf = binary.AppendUvarint(buf, uint64(len(levels)))
+	for _, level := range levels {
+		buf = binary.AppendUvarint(buf, uint64(len(level)))
+		for _, seq := range level {
+			buf = binary.AppendUvarint(buf, seq)
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable))
+
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFile))
+}
+
+// readManifest returns found false when there is no manifest yet
+func readManifest(dir string) (nextSeq uint64, levels [][]uint64, found bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return 0, nil, false, nil
+	}
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if len(data) < len(manifestMagic)+4 || !bytes.HasPrefix(data, []byte(manifestMagic)) {
+		return 0, nil, false, fmt.Errorf("%w: bad manifest", ErrCorrupt)
+	}
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, crcTable) != sum {
+		return 0, nil, false, fmt.Errorf("%w: manifest checksum mismatch", ErrCorrupt)
+	}
+
+	buf := body[len(manifestMagic):]
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			err = fmt.Errorf("%w: bad manifest", ErrCorrupt)
+			buf = nil
+			return 0
+		}
+		buf = buf[n:]
+		return v
+	}
+	nextSeq = uvarint()
+	for n := uvarint(); n > 0 && err == nil; n-- {
+		var level []uint64
+		for m := uvarint(); m > 0 && err == nil; m-- {
+			level = append(level, uvarint())
+		}
+		levels = append(levels, level)
+	}
+	return nextSeq, levels, err == nil, err
+}
@@ -0,0 +1,103 @@
+package lsm
+
+import "iter"
+
+// merge combines sorted sources into one sorted sequence. A key present in
+// several sources is yielded once, with the entry of the first source that
+// has it, so sources must go from newest to oldest. Tombstones are yielded
+// like any other entry, it is up to the caller to skip them.
+func merge[K comparable, V any](cmp func(a, b K) int, sources []iter.Seq2[K, entry[V]]) iter.Seq2[K, entry[V]] {
+	return func(yield func(K, entry[V]) bool) {
+		h := &mergeHeap[K, V]{cmp: cmp}
+		for i, src := range sources {
+			next, stop := iter.Pull2(src)
+			defer stop()
+			c := &cursor[K, V]{source: i, next: next}
+			if c.advance() {
+				h.push(c)
+			}
+		}
+		for len(h.cursors) > 0 {
+			top := h.cursors[0]
+			key, e := top.key, top.entry
+			// every other source holding the same key has an older version
+			for len(h.cursors) > 0 && cmp(h.cursors[0].key, key) == 0 {
+				c := h.cursors[0]
+				if c.advance() {
+					h.fix()
+				} else {
+					h.pop()
+				}
+			}
+			if !yield(key, e) {
+				return
+			}
+		}
+	}
+}
+
+// cursor is the current position in one source of a merge
+type cursor[K comparable, V any] struct {
+	source int
+	next   func() (K, entry[V], bool)
+	key    K
+	entry  entry[V]
+}
+
+func (c *cursor[K, V]) advance() bool {
+	var ok bool
+	c.key, c.entry, ok = c.next()
+	return ok
+}
+
+// mergeHeap is a min heap of cursors by key, ties go to the lowest source so
+// the newest version of a key is always on top
+type mergeHeap[K comparable, V any] struct {
+	cmp     func(a, b K) int
+	cursors []*cursor[K, V]
+}
+
+func (h *mergeHeap[K, V]) less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if c := h.cmp(a.key, b.key); c != 0 {
+		return c < 0
+	}
+	return a.source < b.source
+}
+
+func (h *mergeHeap[K, V]) push(c *cursor[K, V]) {
+	h.cursors = append(h.cursors, c)
+	for i := len(h.cursors) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.cursors[i], h.cursors[parent] = h.cursors[parent], h.cursors[i]
+		i = parent
+	}
+}
+
+func (h *mergeHeap[K, V]) pop() {
+	last := len(h.cursors) - 1
+	h.cursors[0] = h.cursors[last]
+	h.cursors[last] = nil
+	h.cursors = h.cursors[:last]
+	h.fix()
+}
+
+// fix moves the top cursor down after its key changed
+func (h *mergeHeap[K, V]) fix() {
+	for i := 0; ; {
+		smallest := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(h.cursors) && h.less(child, smallest) {
+				smallest = child
+			}
+		}
+		if smallest == i {
+			return
+		}
+		h.cursors[i], h.cursors[smallest] = h.cursors[smallest], h.cursors[i]
+		i = smallest
+	}
+}
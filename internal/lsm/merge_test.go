@@ -0,0 +1,59 @@
+package lsm
+
+import (
+	"cmp"
+	"iter"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func source(pairs ...any) iter.Seq2[int, entry[string]] {
+	return func(yield func(int, entry[string]) bool) {
+		for i := 0; i < len(pairs); i += 2 {
+			e := entry[string]{tombstone: pairs[i+1] == nil}
+			if !e.tombstone {
+				e.value = pairs[i+1].(string)
+			}
+			if !yield(pairs[i].(int), e) {
+				return
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	merged := merge(cmp.Compare[int], []iter.Seq2[int, entry[string]]{
+		source(2, "new", 5, nil),
+		source(),
+		source(1, "old", 2, "old", 5, "old", 9, "old"),
+		source(2, "oldest", 3, "oldest", 9, "oldest"),
+	})
+	var keys []int
+	var entries []entry[string]
+	for k, e := range merged {
+		keys = append(keys, k)
+		entries = append(entries, e)
+	}
+	assert.Equal(t, []int{1, 2, 3, 5, 9}, keys)
+	assert.Equal(t, []entry[string]{
+		{value: "old"},
+		{value: "new"},
+		{value: "oldest"},
+		{tombstone: true},
+		{value: "old"},
+	}, entries)
+
+	// stopping early releases every source
+	n := 0
+	for range merged {
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, n)
+	for range merge(cmp.Compare[int], []iter.Seq2[int, entry[string]]{}) {
+		t.Error("no sources, nothing to merge")
+	}
+}
@@ -0,0 +1,60 @@
+package lsm
+
+import "time"
+
+// Scheduler tells the background compactor when to look for work. Every time
+// Wait returns true the compactor runs compactions until the Strategy has
+// nothing left to pick.
+type Scheduler interface {
+	// Flushed is called after every memtable flush, it must not block
+	Flushed()
+	// Wait blocks until the compactor should run, it returns false once done
+	// is closed
+	Wait(done <-chan struct{}) bool
+}
+
+// AfterFlush runs the compactor after every flush, which is when the shape
+// of the tree changes
+func AfterFlush() Scheduler {
+	return &afterFlush{trigger: make(chan struct{}, 1)}
+}
+
+type afterFlush struct {
+	trigger chan struct{}
+}
+
+func (s *afterFlush) Flushed() {
+	select {
+	case s.trigger <- struct{}{}:
+	default: // a run is already pending
+	}
+}
+
+func (s *afterFlush) Wait(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	case <-s.trigger:
+		return true
+	}
+}
+
+// Every runs the compactor periodically, whether the tree changed or not
+func Every(d time.Duration) Scheduler {
+	return every(d)
+}
+
+type every time.Duration
+
+func (every) Flushed() {}
+
+func (e every) Wait(done <-chan struct{}) bool {
+	timer := time.NewTimer(time.Duration(e))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,102 @@
+package lsm
+
+import (
+	"io"
+	"slices"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/sstable"
+)
+
+// Stats counts what the DB wrote since it was opened and describes the
+// tables it has now
+type Stats struct {
+	// UserBytes is the size of the keys and values given to Put and Delete
+	UserBytes int64
+	// FlushedBytes and CompactedBytes are the size of the tables written by
+	// flushes and by compactions
+	FlushedBytes   int64
+	CompactedBytes int64
+	Compactions    int
+	Levels         []LevelStats
+}
+
+// LevelStats describes the tables of a level
+type LevelStats struct {
+	Tables int
+	Bytes  int64
+}
+
+// TableBytes is the size of every table on disk
+func (s Stats) TableBytes() int64 {
+	var size int64
+	for _, l := range s.Levels {
+		size += l.Bytes
+	}
+	return size
+}
+
+// WriteAmplification is how many bytes went to disk for each byte written
+// by the user, 0 before anything was written
+func (s Stats) WriteAmplification() float64 {
+	if s.UserBytes == 0 {
+		return 0
+	}
+	return float64(s.FlushedBytes+s.CompactedBytes) / float64(s.UserBytes)
+}
+
+func (db *DB[K, V]) Stats() Stats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	s := db.stats
+	s.Levels = make([]LevelStats, len(db.levels))
+	for i, level := range db.levels {
+		for _, t := range level {
+			s.Levels[i].Tables++
+			s.Levels[i].Bytes += t.size()
+		}
+	}
+	return s
+}
+
+// SpaceAmplification is the size of the tables over the size of a single
+// table holding only the live keys, which is what they would take fully
+// compacted. It reads every table to find out, from a pinned snapshot so
+// flushes and compactions go on meanwhile.
+func (db *DB[K, V]) SpaceAmplification() (amp float64, err error) {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return 0, ErrClosed
+	}
+	tables := db.pin()
+	db.mu.RUnlock()
+	defer func() {
+		if uerr := unpin(tables); err == nil {
+			err = uerr
+		}
+	}()
+
+	var broken error
+	var size int64
+	live := sstable.NewWriter(io.Discard, db.cmp, db.kc, db.ec, db.opts.Table)
+	for _, t := range tables {
+		size += t.size()
+	}
+	for k, e := range merge(db.cmp, db.tableSources(slices.Values(tables), &broken)) {
+		if broken != nil {
+			return 0, broken
+		}
+		if !e.tombstone {
+			if err := live.Add(k, e); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if broken != nil {
+		return 0, broken
+	}
+	if err := live.Finish(); err != nil {
+		return 0, err
+	}
+	return float64(size) / float64(live.Size()), nil
+}
@@ -0,0 +1,174 @@
+package lsm
+
+// TableInfo describes a table to a Strategy
+type TableInfo struct {
+	Seq   uint64
+	Size  int64 // bytes on disk
+	Count int   // entries, tombstones included
+}
+
+// Compaction is the work picked by a Strategy: merge the Inputs, tables of
+// Level, into new tables that go to Output, which is either Level itself or
+// the level below it.
+//
+// The DB completes the inputs so the result stays correct:
+//   - compacting inside level 0 requires inputs next to each other in it
+//   - going from level 0 down takes every level 0 table older than the
+//     newest input too, a newer version of a key can't end up below an older
+//     one
+//   - going down also takes the tables of Output that overlap the inputs
+type Compaction struct {
+	Level  int
+	Inputs []uint64
+	Output int
+	// MaxTableSize splits the output in tables of about that many bytes,
+	// 0 writes a single table
+	MaxTableSize int64
+}
+
+// Strategy decides which tables to compact. levels holds the tables the way
+// reads go through them: level 0 from newest to oldest, the other levels
+// sorted by key. Pick returns nil when there is nothing worth doing.
+type Strategy interface {
+	Pick(levels [][]TableInfo) *Compaction
+}
+
+func levelSize(level []TableInfo) int64 {
+	var size int64
+	for _, t := range level {
+		size += t.Size
+	}
+	return size
+}
+
+// Leveled keeps level 0 small and every level below it 10 times bigger than
+// the previous one, each made of tables that don't overlap. A read checks at
+// most one table per level and obsolete data is dropped early, at the price
+// of rewriting the same keys once per level.
+type Leveled struct {
+	// L0Tables is how many level 0 tables trigger a compaction into level 1,
+	// 4 if zero
+	L0Tables int
+	// BaseSize is the target size of level 1 in bytes, 10MB if zero
+	BaseSize int64
+	// Multiplier is how much bigger each level is than the one above, 10 if
+	// zero
+	Multiplier int
+	// TableSize is the size of the tables of levels 1 and below, 2MB if zero
+	TableSize int64
+}
+
+func (l Leveled) withDefaults() Leveled {
+	if l.L0Tables == 0 {
+		l.L0Tables = 4
+	}
+	if l.BaseSize == 0 {
+		l.BaseSize = 10 << 20
+	}
+	if l.Multiplier == 0 {
+		l.Multiplier = 10
+	}
+	if l.TableSize == 0 {
+		l.TableSize = 2 << 20
+	}
+	return l
+}
+
+// Pick compacts level 0 once it has too many tables, otherwise the level
+// furthest past its target size, one table at a time, the oldest first
+func (l Leveled) Pick(levels [][]TableInfo) *Compaction {
+	l = l.withDefaults()
+	if len(levels) > 0 && len(levels[0]) >= l.L0Tables {
+		inputs := make([]uint64, len(levels[0]))
+		for i, t := range levels[0] {
+			inputs[i] = t.Seq
+		}
+		return &Compaction{Level: 0, Inputs: inputs, Output: 1, MaxTableSize: l.TableSize}
+	}
+
+	best, bestScore := 0, 1.0
+	target := l.BaseSize
+	for i := 1; i < len(levels); i++ {
+		if score := float64(levelSize(levels[i])) / float64(target); score > bestScore {
+			best, bestScore = i, score
+		}
+		target *= int64(l.Multiplier)
+	}
+	if best == 0 {
+		return nil
+	}
+	oldest := levels[best][0]
+	for _, t := range levels[best] {
+		if t.Seq < oldest.Seq {
+			oldest = t
+		}
+	}
+	return &Compaction{Level: best, Inputs: []uint64{oldest.Seq}, Output: best + 1, MaxTableSize: l.TableSize}
+}
+
+// SizeTiered keeps every table in level 0 and merges runs of tables of about
+// the same size into one bigger table. Each key is rewritten fewer times than
+// with Leveled, but reads may go through more tables and obsolete versions
+// stay around longer.
+type SizeTiered struct {
+	// MinTables is how many similar tables make a run worth merging, 4 if
+	// zero
+	MinTables int
+	// MaxTables caps how many tables are merged at once, 32 if zero
+	MaxTables int
+	// Ratio is how far from the average size of a run a table can be and
+	// still join it, 0.5 (half to one and a half times) if zero
+	Ratio float64
+	// MinSize puts every table smaller than it in the same tier, 1MB if zero
+	MinSize int64
+}
+
+func (s SizeTiered) withDefaults() SizeTiered {
+	if s.MinTables == 0 {
+		s.MinTables = 4
+	}
+	if s.MaxTables == 0 {
+		s.MaxTables = 32
+	}
+	if s.Ratio == 0 {
+		s.Ratio = 0.5
+	}
+	if s.MinSize == 0 {
+		s.MinSize = 1 << 20
+	}
+	return s
+}
+
+// Pick merges the first run of at least MinTables adjacent level 0 tables of
+// similar size. Runs are made of adjacent tables only so the newest version
+// of every key stays above the older ones.
+func (s SizeTiered) Pick(levels [][]TableInfo) *Compaction {
+	s = s.withDefaults()
+	if len(levels) == 0 {
+		return nil
+	}
+	tables := levels[0]
+	similar := func(size int64, total int64, n int) bool {
+		avg := float64(total) / float64(n)
+		if avg < float64(s.MinSize) && size < s.MinSize {
+			return true
+		}
+		return float64(size) >= avg*(1-s.Ratio) && float64(size) <= avg*(1+s.Ratio)
+	}
+	for start := 0; start < len(tables); {
+		end, total := start+1, tables[start].Size
+		for end < len(tables) && end-start < s.MaxTables && similar(tables[end].Size, total, end-start) {
+			total += tables[end].Size
+			end++
+		}
+		if end-start >= s.MinTables {
+			inputs := make([]uint64, 0, end-start)
+			for _, t := range tables[start:end] {
+				inputs = append(inputs, t.Seq)
+			}
+			return &Compaction{Level: 0, Inputs: inputs, Output: 0}
+		}
+		start++
+	}
+	return nil
+}
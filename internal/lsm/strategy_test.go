@@ -0,0 +1,53 @@
+package lsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func infos(sizes ...int64) []TableInfo {
+	var tables []TableInfo
+	for i, size := range sizes {
+		tables = append(tables, TableInfo{Seq: uint64(100 - i), Size: size})
+	}
+	return tables
+}
+
+func TestLeveledPick(t *testing.T) {
+	l := Leveled{L0Tables: 3, BaseSize: 100, Multiplier: 10, TableSize: 50}
+	assert.Nil(t, l.Pick(nil))
+	assert.Nil(t, l.Pick([][]TableInfo{infos(10, 10)}))
+
+	c := l.Pick([][]TableInfo{infos(10, 10, 10)})
+	assert.Equal(t, &Compaction{Level: 0, Inputs: []uint64{100, 99, 98}, Output: 1, MaxTableSize: 50}, c)
+
+	// level 1 is at 150% of its target, level 2 at 120%
+	levels := [][]TableInfo{
+		infos(10),
+		{{Seq: 7, Size: 50}, {Seq: 3, Size: 50}, {Seq: 5, Size: 50}},
+		{{Seq: 1, Size: 1200}},
+	}
+	c = l.Pick(levels)
+	assert.Equal(t, &Compaction{Level: 1, Inputs: []uint64{3}, Output: 2, MaxTableSize: 50}, c, "the oldest table of level 1")
+
+	levels[2][0].Size = 2000
+	assert.Equal(t, 2, l.Pick(levels).Level)
+	levels[1], levels[2] = infos(100), infos(1000)
+	assert.Nil(t, l.Pick(levels), "every level at its target")
+}
+
+func TestSizeTieredPick(t *testing.T) {
+	s := SizeTiered{MinTables: 3, MaxTables: 4, MinSize: 10}
+	assert.Nil(t, s.Pick(nil))
+	assert.Nil(t, s.Pick([][]TableInfo{infos(100, 100, 400, 400)}))
+
+	// the small ones all go together, whatever their size
+	c := s.Pick([][]TableInfo{infos(1, 5, 2, 100)})
+	assert.Equal(t, &Compaction{Level: 0, Inputs: []uint64{100, 99, 98}, Output: 0}, c)
+
+	c = s.Pick([][]TableInfo{infos(400, 100, 120, 90, 110, 100, 1000)})
+	assert.Equal(t, []uint64{99, 98, 97, 96}, c.Inputs, "a run of similar sizes, capped at MaxTables")
+
+	assert.Nil(t, s.Pick([][]TableInfo{infos(100, 100, 1000, 100)}), "runs are made of adjacent tables only")
+}
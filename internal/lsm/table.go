@@ -0,0 +1,201 @@
+package lsm
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/LucasUTNFRD/db-from-scratch/internal/sstable"
+)
+
+const tableSuffix = ".sst"
+
+// entry is what the memtable and the tables hold for a key. Delete leaves a
+// tombstone that hides the older values of the key in the tables below.
+type entry[V any] struct {
+	value     V
+	tombstone bool
+}
+
+// entryCodec stores an entry as a tag byte followed by the value, tombstones
+// have no value
+type entryCodec[V any] struct {
+	values codec.Codec[V]
+}
+
+const (
+	tagValue     = 0
+	tagTombstone = 1
+)
+
+func (c entryCodec[V]) Encode(dst []byte, e entry[V]) ([]byte, error) {
+	if e.tombstone {
+		return append(dst, tagTombstone), nil
+	}
+	return c.values.Encode(append(dst, tagValue), e.value)
+}
+
+func (c entryCodec[V]) Decode(src []byte) (entry[V], error) {
+	switch {
+	case len(src) == 0:
+		return entry[V]{}, codec.ErrShortBuffer
+	case src[0] == tagTombstone:
+		return entry[V]{tombstone: true}, nil
+	case src[0] != tagValue:
+		return entry[V]{}, fmt.Errorf("lsm: unknown entry tag %d", src[0])
+	}
+	v, err := c.values.Decode(src[1:])
+	return entry[V]{value: v}, err
+}
+
+// table is an immutable sorted file written by a flush or a compaction
+type table[K comparable, V any] struct {
+	seq      uint64
+	path     string
+	reader   *sstable.Reader[K, entry[V]]
+	min, max K
+
+	// refs counts the levels of the DB and the iterators that use the
+	// table, the file is closed once it drops to zero. It is also removed
+	// if a compaction replaced the table.
+	refs     atomic.Int32
+	obsolete atomic.Bool
+}
+
+func tablePath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d%s", seq, tableSuffix))
+}
+
+// tableFile is a table being written, it goes through a temporary file so a
+// crash never leaves half a table behind
+type tableFile[K comparable, V any] struct {
+	seq  uint64
+	path string
+	f    *os.File
+	w    *sstable.Writer[K, entry[V]]
+}
+
+func (db *DB[K, V]) createTable(seq uint64) (*tableFile[K, V], error) {
+	path := tablePath(db.dir, seq)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &tableFile[K, V]{seq: seq, path: path, f: f, w: sstable.NewWriter(f, db.cmp, db.kc, db.ec, db.opts.Table)}, nil
+}
+
+// finish completes the table and moves it in place
+func (tf *tableFile[K, V]) finish() error {
+	if err := tf.w.Finish(); err != nil {
+		tf.abort()
+		return err
+	}
+	if err := tf.f.Sync(); err != nil {
+		tf.abort()
+		return err
+	}
+	if err := tf.f.Close(); err != nil {
+		os.Remove(tf.path + ".tmp")
+		return err
+	}
+	return os.Rename(tf.path+".tmp", tf.path)
+}
+
+// abort throws the table away
+func (tf *tableFile[K, V]) abort() {
+	tf.f.Close()
+	os.Remove(tf.path + ".tmp")
+}
+
+// writeTable writes the pairs, in key order, to the table seq
+func (db *DB[K, V]) writeTable(seq uint64, pairs iter.Seq2[K, entry[V]]) error {
+	tf, err := db.createTable(seq)
+	if err != nil {
+		return err
+	}
+	if err := tf.w.WriteAll(pairs); err != nil {
+		tf.abort()
+		return err
+	}
+	return tf.finish()
+}
+
+func (db *DB[K, V]) openTable(seq uint64) (*table[K, V], error) {
+	path := tablePath(db.dir, seq)
+	r, err := sstable.Open(path, db.cmp, db.kc, db.ec)
+	if err != nil {
+		return nil, err
+	}
+	t := &table[K, V]{seq: seq, path: path, reader: r}
+	t.min, _ = r.Min()
+	t.max, _ = r.Max()
+	t.refs.Store(1) // held by the levels
+	return t, nil
+}
+
+// ref pins the table, it must be taken while the table is still in the
+// levels, that is with the DB locked
+func (t *table[K, V]) ref() {
+	t.refs.Add(1)
+}
+
+// unref releases a reference, the last one closes the table and removes
+// its file if it is obsolete
+func (t *table[K, V]) unref() error {
+	if t.refs.Add(-1) > 0 {
+		return nil
+	}
+	err := t.reader.Close()
+	if t.obsolete.Load() {
+		if rerr := os.Remove(t.path); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func (t *table[K, V]) get(key K) (entry[V], bool, error) {
+	return t.reader.Get(key)
+}
+
+func (t *table[K, V]) all(err *error) iter.Seq2[K, entry[V]] {
+	return t.reader.All(err)
+}
+
+func (t *table[K, V]) size() int64 {
+	return t.reader.Size()
+}
+
+// overlaps reports whether the keys of the table may fall in [lo, hi]
+func (t *table[K, V]) overlaps(cmp func(a, b K) int, lo, hi K) bool {
+	return t.reader.Len() > 0 && cmp(t.min, hi) <= 0 && cmp(lo, t.max) <= 0
+}
+
+// listTables returns the sequence numbers of the tables in dir, temporary
+// files left by a crash during a flush or a compaction are removed
+func listTables(dir string) ([]uint64, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, tableSuffix+".tmp") {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var seq uint64
+		if _, err := fmt.Sscanf(name, "%06d"+tableSuffix, &seq); err != nil || tablePath(dir, seq) != filepath.Join(dir, name) {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	return seqs, nil
+}
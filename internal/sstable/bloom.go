@@ -0,0 +1,50 @@
+package sstable
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloom is a bloom filter over encoded keys: bits followed by the number of
+// probes. A key is probed with double hashing, h1 + i*h2, from a single 64
+// bit hash.
+type bloom []byte
+
+func keyHash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// newBloom builds the filter of the given key hashes
+func newBloom(hashes []uint64, bitsPerKey int) bloom {
+	probes := min(max(int(math.Round(float64(bitsPerKey)*math.Ln2)), 1), 30)
+	bits := max(len(hashes)*bitsPerKey, 64)
+	filter := make(bloom, (bits+7)/8+1)
+	filter[len(filter)-1] = byte(probes)
+	bits = (len(filter) - 1) * 8
+	for _, h := range hashes {
+		h1, h2 := uint32(h), uint32(h>>32)
+		for i := 0; i < probes; i++ {
+			bit := (h1 + uint32(i)*h2) % uint32(bits)
+			filter[bit/8] |= 1 << (bit % 8)
+		}
+	}
+	return filter
+}
+
+// mayContain is false only for keys that were never added
+func (b bloom) mayContain(h uint64) bool {
+	if len(b) < 2 {
+		return true // no filter, everything may be there
+	}
+	probes, bits := int(b[len(b)-1]), uint32(len(b)-1)*8
+	h1, h2 := uint32(h), uint32(h>>32)
+	for i := 0; i < probes; i++ {
+		bit := (h1 + uint32(i)*h2) % bits
+		if b[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,29 @@
+package sstable
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloom(t *testing.T) {
+	var hashes []uint64
+	for i := 0; i < 10000; i++ {
+		hashes = append(hashes, keyHash([]byte(fmt.Sprint("in", i))))
+	}
+	filter := newBloom(hashes, DefaultBitsPerKey)
+	for _, h := range hashes {
+		assert.True(t, filter.mayContain(h), "no false negatives")
+	}
+	positives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.mayContain(keyHash([]byte(fmt.Sprint("out", i)))) {
+			positives++
+		}
+	}
+	assert.Less(t, positives, 200, "about 1%% false positives")
+
+	assert.True(t, bloom(nil).mayContain(42), "no filter")
+	assert.False(t, newBloom(nil, DefaultBitsPerKey).mayContain(42))
+}
@@ -0,0 +1,97 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// An SSTable is an immutable file of sorted key-value pairs:
+//
+//	data blocks   [entries][crc32c uint32] x N
+//	filter block  [bloom bits][probes uint8][crc32c uint32]
+//	meta block    [count uvarint][min key][max key][crc32c uint32]
+//	index block   [last key][block offset uvarint][block size uvarint] x N, [crc32c uint32]
+//	footer        [filter handle][meta handle][index handle][crc32c uint32][magic]
+//
+// Entries share the start of their key with the previous entry of the block:
+//
+//	[shared uvarint][unshared uvarint][value len uvarint][unshared key bytes][value]
+//
+// and every block starts with a whole key. Keys in the meta and index blocks
+// are prefixed by their length. A handle is the offset and size of a block,
+// checksum excluded, as two big endian uint64. Keys and values are encoded
+// with the codecs given to the Writer and the Reader.
+const (
+	magic      = "SSTABLE1"
+	handleSize = 16
+	footerSize = 3*handleSize + 4 + len(magic)
+
+	// DefaultBlockSize is the size data blocks are cut at
+	DefaultBlockSize = 4096
+	// DefaultBitsPerKey gives the bloom filter a ~1% false positive rate
+	DefaultBitsPerKey = 10
+)
+
+var (
+	ErrCorrupt    = errors.New("sstable: corrupt table")
+	ErrOutOfOrder = errors.New("sstable: keys added out of order")
+	ErrFinished   = errors.New("sstable: writer already finished")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// handle locates a block in the file
+type handle struct {
+	offset, size uint64
+}
+
+func (h handle) append(dst []byte) []byte {
+	dst = binary.BigEndian.AppendUint64(dst, h.offset)
+	return binary.BigEndian.AppendUint64(dst, h.size)
+}
+
+func decodeHandle(src []byte) handle {
+	return handle{binary.BigEndian.Uint64(src), binary.BigEndian.Uint64(src[8:])}
+}
+
+// decoder reads the pieces of a block, keeping the first error
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: bad varint", ErrCorrupt)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) next(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = fmt.Errorf("%w: truncated block", ErrCorrupt)
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(d.uvarint())
+}
+
+func appendBytes(dst, b []byte) []byte {
+	return append(binary.AppendUvarint(dst, uint64(len(b))), b...)
+}
@@ -0,0 +1,305 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"sort"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+)
+
+// Reader serves lookups and scans from an SSTable. The filter, the meta and
+// the index blocks are loaded when the table is opened, data blocks are read
+// when needed. Every block is checked against its checksum before use.
+//
+// A Reader is safe for concurrent use.
+type Reader[K, V any] struct {
+	r    io.ReaderAt
+	file *os.File // only set when the Reader opened the file itself
+	size int64
+	cmp  func(a, b K) int
+	kc   codec.Codec[K]
+	vc   codec.Codec[V]
+
+	filter   bloom
+	count    uint64
+	min, max K
+	blocks   []handle
+	lastKeys []K // last key of each block, the sparse index
+}
+
+// Open opens the table stored at path, Close releases the file
+func Open[K, V any](path string, cmp func(a, b K) int, kc codec.Codec[K], vc codec.Codec[V]) (*Reader[K, V], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f, info.Size(), cmp, kc, vc)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.file = f
+	return r, nil
+}
+
+// NewReader reads the table of the given size from r
+func NewReader[K, V any](r io.ReaderAt, size int64, cmp func(a, b K) int, kc codec.Codec[K], vc codec.Codec[V]) (*Reader[K, V], error) {
+	t := &Reader[K, V]{r: r, size: size, cmp: cmp, kc: kc, vc: vc}
+	if size < int64(footerSize) {
+		return nil, fmt.Errorf("%w: file too short", ErrCorrupt)
+	}
+	footer := make([]byte, footerSize)
+	if err := readAt(r, footer, size-int64(footerSize)); err != nil {
+		return nil, err
+	}
+	handles, sum := footer[:3*handleSize], footer[3*handleSize:3*handleSize+4]
+	if string(footer[3*handleSize+4:]) != magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	if crc32.Checksum(handles, crcTable) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: footer checksum mismatch", ErrCorrupt)
+	}
+
+	filter, err := t.readBlock(decodeHandle(handles))
+	if err != nil {
+		return nil, err
+	}
+	t.filter = filter
+	if err := t.readMeta(decodeHandle(handles[handleSize:])); err != nil {
+		return nil, err
+	}
+	if err := t.readIndex(decodeHandle(handles[2*handleSize:])); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// readAt fills buf from off. A ReaderAt may return io.EOF along with a full
+// read that ends at the last byte, which is fine.
+func readAt(r io.ReaderAt, buf []byte, off int64) error {
+	n, err := r.ReadAt(buf, off)
+	if n == len(buf) {
+		return nil
+	}
+	return err
+}
+
+// readBlock reads a block and checks it against the checksum that follows it
+func (t *Reader[K, V]) readBlock(h handle) ([]byte, error) {
+	if h.offset > uint64(t.size) || h.size > uint64(t.size)-h.offset || uint64(t.size)-h.offset-h.size < 4 {
+		return nil, fmt.Errorf("%w: block out of bounds", ErrCorrupt)
+	}
+	buf := make([]byte, h.size+4)
+	if err := readAt(t.r, buf, int64(h.offset)); err != nil {
+		return nil, err
+	}
+	block := buf[:h.size]
+	if crc32.Checksum(block, crcTable) != binary.BigEndian.Uint32(buf[h.size:]) {
+		return nil, fmt.Errorf("%w: block at %d: checksum mismatch", ErrCorrupt, h.offset)
+	}
+	return block, nil
+}
+
+func (t *Reader[K, V]) decodeKey(b []byte) (K, error) {
+	k, err := t.kc.Decode(b)
+	if err != nil {
+		err = fmt.Errorf("%w: key: %v", ErrCorrupt, err)
+	}
+	return k, err
+}
+
+func (t *Reader[K, V]) readMeta(h handle) error {
+	block, err := t.readBlock(h)
+	if err != nil {
+		return err
+	}
+	d := decoder{buf: block}
+	t.count = d.uvarint()
+	if t.count == 0 || d.err != nil {
+		return d.err
+	}
+	first, last := d.bytes(), d.bytes()
+	if d.err != nil {
+		return d.err
+	}
+	if t.min, err = t.decodeKey(first); err != nil {
+		return err
+	}
+	t.max, err = t.decodeKey(last)
+	return err
+}
+
+func (t *Reader[K, V]) readIndex(h handle) error {
+	block, err := t.readBlock(h)
+	if err != nil {
+		return err
+	}
+	d := decoder{buf: block}
+	for len(d.buf) > 0 && d.err == nil {
+		last := d.bytes()
+		h := handle{offset: d.uvarint(), size: d.uvarint()}
+		if d.err != nil {
+			break
+		}
+		k, err := t.decodeKey(last)
+		if err != nil {
+			return err
+		}
+		t.lastKeys = append(t.lastKeys, k)
+		t.blocks = append(t.blocks, h)
+	}
+	return d.err
+}
+
+// Len returns the number of pairs in the table
+func (t *Reader[K, V]) Len() int {
+	return int(t.count)
+}
+
+// Size returns the size of the table file in bytes
+func (t *Reader[K, V]) Size() int64 {
+	return t.size
+}
+
+// Min and Max return the smallest and the greatest keys, false for an empty
+// table
+func (t *Reader[K, V]) Min() (K, bool) {
+	return t.min, t.count > 0
+}
+
+func (t *Reader[K, V]) Max() (K, bool) {
+	return t.max, t.count > 0
+}
+
+// Get looks key up. Keys outside [Min, Max] or rejected by the bloom filter
+// are answered without reading any data block, otherwise a single block is
+// read.
+func (t *Reader[K, V]) Get(key K) (value V, found bool, err error) {
+	if t.count == 0 || t.cmp(key, t.min) < 0 || t.cmp(key, t.max) > 0 {
+		return value, false, nil
+	}
+	k, err := t.kc.Encode(nil, key)
+	if err != nil {
+		return value, false, err
+	}
+	if !t.filter.mayContain(keyHash(k)) {
+		return value, false, nil
+	}
+	i := t.seek(key)
+	if i == len(t.blocks) {
+		return value, false, nil
+	}
+	for k, v := range t.block(i, &err) {
+		if c := t.cmp(k, key); c == 0 {
+			return v, true, nil
+		} else if c > 0 {
+			break
+		}
+	}
+	return value, false, err
+}
+
+// seek returns the first block that may hold key, the one whose last key is
+// not below it
+func (t *Reader[K, V]) seek(key K) int {
+	return sort.Search(len(t.lastKeys), func(i int) bool {
+		return t.cmp(t.lastKeys[i], key) >= 0
+	})
+}
+
+// block iterates over the pairs of data block i, a failure to read or decode
+// it ends the iteration and is stored in err
+func (t *Reader[K, V]) block(i int, err *error) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		block, e := t.readBlock(t.blocks[i])
+		if e != nil {
+			*err = e
+			return
+		}
+		d := decoder{buf: block}
+		var key []byte
+		for len(d.buf) > 0 {
+			shared, unshared, size := d.uvarint(), d.uvarint(), d.uvarint()
+			if d.err == nil && shared > uint64(len(key)) {
+				d.err = fmt.Errorf("%w: shared prefix longer than previous key", ErrCorrupt)
+			}
+			suffix, value := d.next(unshared), d.next(size)
+			if d.err != nil {
+				*err = d.err
+				return
+			}
+			key = append(key[:shared:shared], suffix...)
+			k, e := t.decodeKey(key)
+			if e != nil {
+				*err = e
+				return
+			}
+			v, e := t.vc.Decode(value)
+			if e != nil {
+				*err = fmt.Errorf("%w: value: %v", ErrCorrupt, e)
+				return
+			}
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over every pair in key order. Iterators can't
+// return errors: a scan stops early at the first unreadable block and stores
+// the error in err, check it once the loop ends.
+func (t *Reader[K, V]) All(err *error) iter.Seq2[K, V] {
+	return t.scan(0, func(K) bool { return true }, func(K) bool { return true }, err)
+}
+
+// Range returns an iterator over the pairs with lo <= key < hi, only the
+// blocks that overlap the range are read. Errors are reported like in All.
+func (t *Reader[K, V]) Range(lo, hi K, err *error) iter.Seq2[K, V] {
+	return t.scan(t.seek(lo),
+		func(k K) bool { return t.cmp(k, lo) >= 0 },
+		func(k K) bool { return t.cmp(k, hi) < 0 },
+		err,
+	)
+}
+
+// scan walks the blocks from first on, skipping the keys before the range and
+// stopping at the first one past it. The error belongs to the iterator, so
+// concurrent scans of the same Reader don't see each other's failures.
+func (t *Reader[K, V]) scan(first int, started, inRange func(K) bool, err *error) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for i := first; i < len(t.blocks); i++ {
+			var berr error
+			for k, v := range t.block(i, &berr) {
+				if !started(k) {
+					continue
+				}
+				if !inRange(k) || !yield(k, v) {
+					return
+				}
+			}
+			if berr != nil {
+				*err = berr
+				return
+			}
+		}
+	}
+}
+
+// Close releases the file if the Reader was created by Open
+func (t *Reader[K, V]) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
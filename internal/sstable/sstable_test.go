@@ -0,0 +1,231 @@
+package sstable
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	btree "github.com/LucasUTNFRD/db-from-scratch/internal/b-tree"
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func userKey(i int) string {
+	return fmt.Sprintf("tenant/acme/user/%05d", i)
+}
+
+// writeTable writes the even users 0..2n-2 through a BTree, like a memtable
+// flush does
+func writeTable(t *testing.T, n int, opts Options) []byte {
+	tree := btree.NewOrdered[string, int](16)
+	for i := 0; i < n; i++ {
+		tree.Put(userKey(2*i), i)
+	}
+	var buf bytes.Buffer
+	w := NewWriter[string, int](&buf, strings.Compare, codec.String{}, codec.Int{}, opts)
+	require.NoError(t, w.WriteAll(tree.All()))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, uint64(n), w.Count())
+	assert.Equal(t, uint64(buf.Len()), w.Size())
+	return buf.Bytes()
+}
+
+func readTable(data []byte) (*Reader[string, int], error) {
+	return NewReader[string, int](bytes.NewReader(data), int64(len(data)), strings.Compare, codec.String{}, codec.Int{})
+}
+
+func TestRoundTrip(t *testing.T) {
+	const n = 1000
+	data := writeTable(t, n, Options{BlockSize: 256})
+	r, err := readTable(data)
+	require.NoError(t, err)
+	assert.Greater(t, len(r.blocks), 20)
+	assert.Less(t, len(data), n*len(userKey(0)), "keys are prefix compressed")
+
+	assert.Equal(t, n, r.Len())
+	lo, _ := r.Min()
+	hi, _ := r.Max()
+	assert.Equal(t, userKey(0), lo)
+	assert.Equal(t, userKey(2*n-2), hi)
+
+	i := 0
+	var scanErr error
+	for k, v := range r.All(&scanErr) {
+		assert.Equal(t, userKey(2*i), k)
+		assert.Equal(t, i, v)
+		i++
+	}
+	assert.Equal(t, n, i)
+
+	for i := -1; i < 2*n+1; i++ {
+		v, found, err := r.Get(userKey(i))
+		require.NoError(t, err)
+		assert.Equal(t, i >= 0 && i%2 == 0 && i < 2*n, found, "key %d", i)
+		if found {
+			assert.Equal(t, i/2, v)
+		} else {
+			assert.Zero(t, v)
+		}
+	}
+	assert.NoError(t, scanErr)
+}
+
+func TestRange(t *testing.T) {
+	r, err := readTable(writeTable(t, 500, Options{BlockSize: 128}))
+	require.NoError(t, err)
+	for _, bounds := range [][2]int{{0, 1000}, {-5, 3}, {1, 2}, {101, 377}, {998, 2000}, {400, 400}, {500, 100}} {
+		var got []int
+		var scanErr error
+		for _, v := range r.Range(userKey(bounds[0]), userKey(bounds[1]), &scanErr) {
+			got = append(got, v)
+		}
+		var want []int
+		for i := max(bounds[0], 0); i < min(bounds[1], 1000); i++ {
+			if i%2 == 0 {
+				want = append(want, i/2)
+			}
+		}
+		assert.Equal(t, want, got, "range %v", bounds)
+		assert.NoError(t, scanErr)
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	r, err := readTable(writeTable(t, 0, Options{}))
+	require.NoError(t, err)
+	assert.Zero(t, r.Len())
+	_, ok := r.Min()
+	assert.False(t, ok)
+	_, found, err := r.Get("x")
+	assert.False(t, found)
+	assert.NoError(t, err)
+	for range r.All(&err) {
+		t.Error("empty table")
+	}
+	assert.NoError(t, err)
+}
+
+func TestWriterErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter[int, int](&buf, cmp.Compare[int], codec.Int{}, codec.Int{}, Options{})
+	require.NoError(t, w.Add(1, 1))
+	assert.ErrorIs(t, w.Add(1, 2), ErrOutOfOrder)
+	assert.ErrorIs(t, w.Add(0, 2), ErrOutOfOrder)
+	require.NoError(t, w.Add(2, 2))
+	require.NoError(t, w.Finish())
+	assert.ErrorIs(t, w.Add(3, 3), ErrFinished)
+	assert.ErrorIs(t, w.Finish(), ErrFinished)
+}
+
+func TestWithoutFilter(t *testing.T) {
+	r, err := readTable(writeTable(t, 100, Options{BitsPerKey: -1}))
+	require.NoError(t, err)
+	assert.Empty(t, r.filter)
+	v, found, err := r.Get(userKey(42))
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 21, v)
+	_, found, _ = r.Get(userKey(43))
+	assert.False(t, found)
+}
+
+// every byte of the file is covered by a checksum, flipping any of them must
+// be caught when the table is opened or read
+func TestCorruption(t *testing.T) {
+	data := writeTable(t, 60, Options{BlockSize: 64})
+	for i := range data {
+		corrupt := bytes.Clone(data)
+		corrupt[i] ^= 0x40
+		r, err := readTable(corrupt)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrCorrupt, "byte %d", i)
+			continue
+		}
+		n := 0
+		for range r.All(&err) {
+			n++
+		}
+		assert.ErrorIs(t, err, ErrCorrupt, "byte %d", i)
+		assert.Less(t, n, 60)
+
+		// Get reports it too, from the block holding the broken byte
+		var getErr error
+		for k := 0; k < 120 && getErr == nil; k += 2 {
+			_, _, getErr = r.Get(userKey(k))
+		}
+		assert.ErrorIs(t, getErr, ErrCorrupt, "byte %d", i)
+	}
+
+	for _, size := range []int{0, 10, footerSize, len(data) - 1} {
+		_, err := readTable(data[len(data)-size:])
+		assert.ErrorIs(t, err, ErrCorrupt, "truncated to %d", size)
+	}
+}
+
+func TestScanErrorsBelongToTheIterator(t *testing.T) {
+	data := writeTable(t, 500, Options{BlockSize: 128})
+	r, err := readTable(data)
+	require.NoError(t, err)
+	// break the first data block, the rest of the table is fine
+	data[10] ^= 0x40
+
+	var allErr error
+	for range r.All(&allErr) {
+		t.Error("first block is broken")
+	}
+	assert.ErrorIs(t, allErr, ErrCorrupt)
+
+	n := 0
+	var rangeErr error
+	for range r.Range(userKey(500), userKey(600), &rangeErr) {
+		n++
+	}
+	assert.NoError(t, rangeErr, "a scan that doesn't read the broken block succeeds")
+	assert.Equal(t, 50, n)
+}
+
+// eofReader returns io.EOF along with reads that reach the end, as
+// io.ReaderAt allows
+type eofReader struct {
+	*bytes.Reader
+}
+
+func (r eofReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	if err == nil && off+int64(n) == r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestReaderAtEOF(t *testing.T) {
+	data := writeTable(t, 100, Options{BlockSize: 64})
+	r, err := NewReader[string, int](eofReader{bytes.NewReader(data)}, int64(len(data)), strings.Compare, codec.String{}, codec.Int{})
+	require.NoError(t, err)
+	n := 0
+	for range r.All(&err) {
+		n++
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, 100, n)
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.sst")
+	require.NoError(t, os.WriteFile(path, writeTable(t, 10, Options{}), 0o644))
+	r, err := Open[string, int](path, strings.Compare, codec.String{}, codec.Int{})
+	require.NoError(t, err)
+	assert.Equal(t, 10, r.Len())
+	require.NoError(t, r.Close())
+
+	require.NoError(t, os.WriteFile(path, []byte("not a table"), 0o644))
+	_, err = Open[string, int](path, strings.Compare, codec.String{}, codec.Int{})
+	assert.ErrorIs(t, err, ErrCorrupt)
+	assert.Contains(t, err.Error(), path)
+}
@@ -0,0 +1,191 @@
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"iter"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+)
+
+// Options tune the tables written by a Writer
+type Options struct {
+	// BlockSize is the size data blocks are cut at, DefaultBlockSize if zero
+	BlockSize int
+	// BitsPerKey is the size of the bloom filter per key, DefaultBitsPerKey
+	// if zero. Negative values leave the table without filter.
+	BitsPerKey int
+}
+
+// Writer writes an SSTable to w, keys must be added in increasing order
+// according to cmp. Finish must be called to write the index and the footer.
+type Writer[K, V any] struct {
+	w    *bufio.Writer
+	n    uint64 // bytes written so far, the offset of the next block
+	cmp  func(a, b K) int
+	kc   codec.Codec[K]
+	vc   codec.Codec[V]
+	opts Options
+
+	block   []byte
+	lastKey []byte // encoded key of the last entry, for prefix compression
+	index   []byte
+	hashes  []uint64
+	count   uint64
+	first   []byte
+	last    K
+	done    bool
+	err     error
+	scratch []byte
+}
+
+// NewWriter starts a table on w
+func NewWriter[K, V any](w io.Writer, cmp func(a, b K) int, kc codec.Codec[K], vc codec.Codec[V], opts Options) *Writer[K, V] {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BitsPerKey == 0 {
+		opts.BitsPerKey = DefaultBitsPerKey
+	}
+	return &Writer[K, V]{w: bufio.NewWriter(w), cmp: cmp, kc: kc, vc: vc, opts: opts}
+}
+
+// Add appends a pair, its key must be greater than the previous one
+func (w *Writer[K, V]) Add(key K, value V) error {
+	switch {
+	case w.err != nil:
+		return w.err
+	case w.done:
+		return ErrFinished
+	case w.count > 0 && w.cmp(w.last, key) >= 0:
+		return ErrOutOfOrder
+	}
+
+	// a pair that can't be encoded is rejected, the table stays usable
+	k, err := w.kc.Encode(w.scratch[:0], key)
+	if err != nil {
+		return err
+	}
+	w.scratch = k
+	v, err := w.vc.Encode(nil, value)
+	if err != nil {
+		return err
+	}
+	shared := 0
+	if len(w.block) > 0 {
+		shared = len(commonPrefix(w.lastKey, k))
+	}
+	w.block = binary.AppendUvarint(w.block, uint64(shared))
+	w.block = binary.AppendUvarint(w.block, uint64(len(k)-shared))
+	w.block = binary.AppendUvarint(w.block, uint64(len(v)))
+	w.block = append(w.block, k[shared:]...)
+	w.block = append(w.block, v...)
+
+	w.lastKey = append(w.lastKey[:0], k...)
+	w.hashes = append(w.hashes, keyHash(k))
+	if w.count == 0 {
+		w.first = bytes.Clone(k)
+	}
+	w.last = key
+	w.count++
+	if len(w.block) >= w.opts.BlockSize {
+		w.flushBlock()
+	}
+	return w.err
+}
+
+// WriteAll adds every pair of an ordered sequence, such as BTree.All
+func (w *Writer[K, V]) WriteAll(pairs iter.Seq2[K, V]) error {
+	for k, v := range pairs {
+		if err := w.Add(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushBlock writes the current data block and indexes it by its last key
+func (w *Writer[K, V]) flushBlock() {
+	if len(w.block) == 0 {
+		return
+	}
+	h := w.writeBlock(w.block)
+	w.index = appendBytes(w.index, w.lastKey)
+	w.index = binary.AppendUvarint(w.index, h.offset)
+	w.index = binary.AppendUvarint(w.index, h.size)
+	w.block = w.block[:0]
+}
+
+// writeBlock writes a block followed by its checksum
+func (w *Writer[K, V]) writeBlock(block []byte) handle {
+	h := handle{offset: w.n, size: uint64(len(block))}
+	w.write(block)
+	w.write(binary.BigEndian.AppendUint32(nil, crc32.Checksum(block, crcTable)))
+	return h
+}
+
+func (w *Writer[K, V]) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(b)
+	w.n += uint64(len(b))
+}
+
+// Finish writes the last block, the filter, the meta and index blocks and the
+// footer. It doesn't close the underlying writer.
+func (w *Writer[K, V]) Finish() error {
+	if w.done {
+		return ErrFinished
+	}
+	w.done = true
+	w.flushBlock()
+
+	var filter bloom
+	if w.opts.BitsPerKey > 0 {
+		filter = newBloom(w.hashes, w.opts.BitsPerKey)
+	}
+	filterHandle := w.writeBlock(filter)
+
+	meta := binary.AppendUvarint(nil, w.count)
+	if w.count > 0 {
+		meta = appendBytes(meta, w.first)
+		meta = appendBytes(meta, w.lastKey)
+	}
+	metaHandle := w.writeBlock(meta)
+	indexHandle := w.writeBlock(w.index)
+
+	footer := filterHandle.append(nil)
+	footer = metaHandle.append(footer)
+	footer = indexHandle.append(footer)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.Checksum(footer, crcTable))
+	w.write(append(footer, magic...))
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Count returns the number of pairs added so far
+func (w *Writer[K, V]) Count() uint64 {
+	return w.count
+}
+
+// Size returns the number of bytes written so far, the size of the file once
+// Finish returned
+func (w *Writer[K, V]) Size() uint64 {
+	return w.n
+}
+
+func commonPrefix(a, b []byte) []byte {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
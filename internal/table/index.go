@@ -0,0 +1,131 @@
+package table
+
+import (
+	"fmt"
+	"iter"
+
+	btree "github.com/LucasUTNFRD/db-from-scratch/internal/b-tree"
+)
+
+// Index is a secondary index of a table, SK is the type of its keys. Every
+// index key maps to the set of primary keys of the rows that have it, kept in
+// a tree of its own so lookups come out in primary key order.
+type Index[PK comparable, R any, SK comparable] struct {
+	table   *Table[PK, R]
+	name    string
+	unique  bool
+	extract func(R) SK
+	tree    *btree.BTree[SK, *btree.BTree[PK, struct{}]]
+}
+
+// AddIndex creates an index called name on the key extract returns for each
+// row, existing rows are indexed right away. With unique set no two rows can
+// share a key, which fails with ErrDuplicate if existing rows already do.
+func AddIndex[PK comparable, R any, SK comparable](
+	t *Table[PK, R],
+	name string,
+	cmp func(a, b SK) int,
+	extract func(R) SK,
+	unique bool,
+) (*Index[PK, R, SK], error) {
+	if _, ok := t.indexes[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrIndexExists, name)
+	}
+	idx := &Index[PK, R, SK]{
+		table:   t,
+		name:    name,
+		unique:  unique,
+		extract: extract,
+		tree:    btree.NewBTree[SK, *btree.BTree[PK, struct{}]](t.order, cmp),
+	}
+	for pk, r := range t.All() {
+		if other, ok := idx.conflict(pk, r); ok {
+			return nil, fmt.Errorf("%w: %s, rows %v and %v", ErrDuplicate, name, other, pk)
+		}
+		idx.add(pk, r)
+	}
+	t.indexes[name] = idx
+	t.names = append(t.names, name)
+	return idx, nil
+}
+
+func (idx *Index[PK, R, SK]) Name() string {
+	return idx.name
+}
+
+// Lookup returns the rows with key sk in primary key order
+func (idx *Index[PK, R, SK]) Lookup(sk SK) iter.Seq2[PK, R] {
+	return idx.table.rows(idx.pks(sk))
+}
+
+// Get returns the first row with key sk, the only one in a unique index
+func (idx *Index[PK, R, SK]) Get(sk SK) (r R, found bool) {
+	for _, r := range idx.Lookup(sk) {
+		return r, true
+	}
+	return r, false
+}
+
+// Count returns how many rows have key sk
+func (idx *Index[PK, R, SK]) Count(sk SK) int {
+	if pks, ok := idx.tree.Get(sk); ok {
+		return pks.Len()
+	}
+	return 0
+}
+
+func (idx *Index[PK, R, SK]) pks(sk SK) iter.Seq[PK] {
+	return func(yield func(PK) bool) {
+		pks, ok := idx.tree.Get(sk)
+		if !ok {
+			return
+		}
+		for pk := range pks.All() {
+			if !yield(pk) {
+				return
+			}
+		}
+	}
+}
+
+func (idx *Index[PK, R, SK]) conflict(pk PK, r R) (PK, bool) {
+	if idx.unique {
+		for other := range idx.pks(idx.extract(r)) {
+			if idx.table.cmp(other, pk) != 0 {
+				return other, true
+			}
+		}
+	}
+	var zero PK
+	return zero, false
+}
+
+func (idx *Index[PK, R, SK]) add(pk PK, r R) {
+	sk := idx.extract(r)
+	pks, ok := idx.tree.Get(sk)
+	if !ok {
+		pks = btree.NewBTree[PK, struct{}](idx.table.order, idx.table.cmp)
+		idx.tree.Put(sk, pks)
+	}
+	pks.Put(pk, struct{}{})
+}
+
+func (idx *Index[PK, R, SK]) remove(pk PK, r R) {
+	sk := idx.extract(r)
+	pks, ok := idx.tree.Get(sk)
+	if !ok {
+		return
+	}
+	pks.Delete(pk)
+	if pks.Len() == 0 {
+		idx.tree.Delete(sk)
+	}
+}
+
+func (idx *Index[PK, R, SK]) lookup(key any) (iter.Seq[PK], error) {
+	sk, ok := key.(SK)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s takes %T, got %T", ErrKeyType, idx.name, sk, key)
+	}
+	return idx.pks(sk), nil
+}
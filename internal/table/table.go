@@ -0,0 +1,154 @@
+package table
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+
+	btree "github.com/LucasUTNFRD/db-from-scratch/internal/b-tree"
+)
+
+var (
+	ErrNotFound    = errors.New("table: row not found")
+	ErrExists      = errors.New("table: row already exists")
+	ErrDuplicate   = errors.New("table: duplicate key in unique index")
+	ErrNoIndex     = errors.New("table: no such index")
+	ErrIndexExists = errors.New("table: index already exists")
+	ErrKeyType     = errors.New("table: wrong key type for index")
+)
+
+// Table stores rows in a primary BTree keyed by primary key and keeps any
+// number of secondary indexes in sync with it. Indexes are updated from the
+// hooks of the primary tree, so every change to a row reaches all of them;
+// unique indexes are checked before the row is touched.
+//
+// Like BTree, a Table is not safe for concurrent use.
+type Table[PK comparable, R any] struct {
+	primary *btree.BTree[PK, R]
+	key     func(R) PK
+	cmp     func(a, b PK) int
+	order   int
+
+	indexes map[string]secondary[PK, R]
+	names   []string // in creation order, so checks always run the same way
+}
+
+// secondary is what the table needs from an index, whatever its key type
+type secondary[PK comparable, R any] interface {
+	// conflict returns the primary key of another row with the same index
+	// key as r, only unique indexes have conflicts
+	conflict(pk PK, r R) (PK, bool)
+	add(pk PK, r R)
+	remove(pk PK, r R)
+	lookup(key any) (iter.Seq[PK], error)
+}
+
+// New creates an empty table, key extracts the primary key of a row. order is
+// the degree of the primary tree and of every index.
+func New[PK comparable, R any](order int, cmp func(a, b PK) int, key func(R) PK) *Table[PK, R] {
+	t := &Table[PK, R]{
+		primary: btree.NewBTree[PK, R](order, cmp),
+		key:     key,
+		cmp:     cmp,
+		order:   order,
+		indexes: map[string]secondary[PK, R]{},
+	}
+	t.primary.OnInsert(func(pk PK, r R) {
+		for _, name := range t.names {
+			t.indexes[name].add(pk, r)
+		}
+	})
+	t.primary.OnUpdate(func(pk PK, old, r R) {
+		for _, name := range t.names {
+			t.indexes[name].remove(pk, old)
+			t.indexes[name].add(pk, r)
+		}
+	})
+	t.primary.OnDelete(func(pk PK, old R) {
+		for _, name := range t.names {
+			t.indexes[name].remove(pk, old)
+		}
+	})
+	return t
+}
+
+// Len returns the number of rows
+func (t *Table[PK, R]) Len() int {
+	return t.primary.Len()
+}
+
+// Get returns the row with the primary key pk
+func (t *Table[PK, R]) Get(pk PK) (R, bool) {
+	return t.primary.Get(pk)
+}
+
+// All returns an iterator over the rows in primary key order
+func (t *Table[PK, R]) All() iter.Seq2[PK, R] {
+	return t.primary.All()
+}
+
+// Put inserts the row or replaces the one with the same primary key. It
+// fails with ErrDuplicate, changing nothing, if a unique index already has
+// the key of the row for another row.
+func (t *Table[PK, R]) Put(r R) error {
+	pk := t.key(r)
+	for _, name := range t.names {
+		if other, ok := t.indexes[name].conflict(pk, r); ok {
+			return fmt.Errorf("%w: %s already used by %v", ErrDuplicate, name, other)
+		}
+	}
+	return t.primary.Put(pk, r)
+}
+
+// Insert is Put for a row that must not exist yet
+func (t *Table[PK, R]) Insert(r R) error {
+	if _, ok := t.primary.Get(t.key(r)); ok {
+		return fmt.Errorf("%w: %v", ErrExists, t.key(r))
+	}
+	return t.Put(r)
+}
+
+// Update is Put for a row that must exist already
+func (t *Table[PK, R]) Update(r R) error {
+	if _, ok := t.primary.Get(t.key(r)); !ok {
+		return fmt.Errorf("%w: %v", ErrNotFound, t.key(r))
+	}
+	return t.Put(r)
+}
+
+// Delete removes the row with primary key pk from the table and every index
+func (t *Table[PK, R]) Delete(pk PK) error {
+	if err := t.primary.Delete(pk); err != nil {
+		if errors.Is(err, btree.ErrNotFound) || errors.Is(err, btree.ErrEmpty) {
+			return fmt.Errorf("%w: %v", ErrNotFound, pk)
+		}
+		return err
+	}
+	return nil
+}
+
+// Lookup returns the rows whose key in the index called name is key, in
+// primary key order. key must have the key type of the index.
+func (t *Table[PK, R]) Lookup(name string, key any) (iter.Seq2[PK, R], error) {
+	idx, ok := t.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoIndex, name)
+	}
+	pks, err := idx.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	return t.rows(pks), nil
+}
+
+// rows turns primary keys into rows
+func (t *Table[PK, R]) rows(pks iter.Seq[PK]) iter.Seq2[PK, R] {
+	return func(yield func(PK, R) bool) {
+		for pk := range pks {
+			r, _ := t.primary.Get(pk)
+			if !yield(pk, r) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package table
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID      int
+	Email   string
+	Country string
+}
+
+func newUsers(t *testing.T) (*Table[int, user], *Index[int, user, string], *Index[int, user, string]) {
+	users := New(4, cmp.Compare[int], func(u user) int { return u.ID })
+	byEmail, err := AddIndex(users, "email", strings.Compare, func(u user) string { return u.Email }, true)
+	assert.NoError(t, err)
+	byCountry, err := AddIndex(users, "country", strings.Compare, func(u user) string { return u.Country }, false)
+	assert.NoError(t, err)
+	return users, byEmail, byCountry
+}
+
+func ids[R any](seq iter.Seq2[int, R]) []int {
+	var out []int
+	for id := range seq {
+		out = append(out, id)
+	}
+	return out
+}
+
+// assertConsistent rebuilds what every index should hold from the rows
+func assertConsistent(t *testing.T, users *Table[int, user], indexes ...*Index[int, user, string]) {
+	t.Helper()
+	for _, idx := range indexes {
+		want := map[string][]int{}
+		for id, u := range users.All() {
+			sk := idx.extract(u)
+			want[sk] = append(want[sk], id)
+		}
+		assert.Equal(t, len(want), idx.tree.Len(), idx.name)
+		for sk, pks := range want {
+			assert.Equal(t, pks, ids(idx.Lookup(sk)), "%s %s", idx.name, sk)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	users, byEmail, byCountry := newUsers(t)
+	assert.NoError(t, users.Insert(user{1, "ana@x", "ar"}))
+	assert.NoError(t, users.Insert(user{2, "bo@x", "uy"}))
+	assert.NoError(t, users.Insert(user{3, "cy@x", "ar"}))
+	assertConsistent(t, users, byEmail, byCountry)
+
+	u, ok := byEmail.Get("bo@x")
+	assert.True(t, ok)
+	assert.Equal(t, 2, u.ID)
+	assert.Equal(t, []int{1, 3}, ids(byCountry.Lookup("ar")))
+	assert.Equal(t, 2, byCountry.Count("ar"))
+
+	// moving a user updates both indexes
+	assert.NoError(t, users.Update(user{1, "ana@y", "uy"}))
+	assertConsistent(t, users, byEmail, byCountry)
+	_, ok = byEmail.Get("ana@x")
+	assert.False(t, ok)
+	assert.Equal(t, []int{1, 2}, ids(byCountry.Lookup("uy")))
+	assert.Equal(t, []int{3}, ids(byCountry.Lookup("ar")))
+
+	assert.NoError(t, users.Delete(2))
+	assertConsistent(t, users, byEmail, byCountry)
+	assert.Equal(t, []int{1}, ids(byCountry.Lookup("uy")))
+	assert.Equal(t, 2, users.Len())
+}
+
+func TestTableErrors(t *testing.T) {
+	users, byEmail, byCountry := newUsers(t)
+	assert.NoError(t, users.Put(user{1, "ana@x", "ar"}))
+	assert.NoError(t, users.Put(user{2, "bo@x", "ar"}))
+
+	assert.ErrorIs(t, users.Insert(user{1, "new@x", "ar"}), ErrExists)
+	assert.ErrorIs(t, users.Update(user{9, "new@x", "ar"}), ErrNotFound)
+	assert.ErrorIs(t, users.Delete(9), ErrNotFound)
+
+	// a unique clash changes nothing
+	assert.ErrorIs(t, users.Put(user{2, "ana@x", "uy"}), ErrDuplicate)
+	assert.ErrorIs(t, users.Insert(user{3, "ana@x", "uy"}), ErrDuplicate)
+	u, _ := users.Get(2)
+	assert.Equal(t, user{2, "bo@x", "ar"}, u)
+	assertConsistent(t, users, byEmail, byCountry)
+
+	// keeping its own email is not a clash
+	assert.NoError(t, users.Put(user{2, "bo@x", "uy"}))
+	assertConsistent(t, users, byEmail, byCountry)
+
+	_, err := AddIndex(users, "email", strings.Compare, func(u user) string { return u.Email }, false)
+	assert.ErrorIs(t, err, ErrIndexExists)
+	_, err = AddIndex(users, "sameCountry", strings.Compare, func(u user) string { return "x" }, true)
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, err = users.Lookup("sameCountry", "x")
+	assert.ErrorIs(t, err, ErrNoIndex, "a failed index is not registered")
+}
+
+func TestLookupByName(t *testing.T) {
+	users, _, _ := newUsers(t)
+	for i := range 10 {
+		users.Put(user{i, fmt.Sprintf("u%d@x", i), []string{"ar", "uy"}[i%2]})
+	}
+	rows, err := users.Lookup("country", "uy")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 3, 5, 7, 9}, ids(rows))
+
+	_, err = users.Lookup("country", 3)
+	assert.ErrorIs(t, err, ErrKeyType)
+	_, err = users.Lookup("age", 3)
+	assert.ErrorIs(t, err, ErrNoIndex)
+}
+
+func TestIndexOverExistingRows(t *testing.T) {
+	users := New(3, cmp.Compare[int], func(u user) int { return u.ID })
+	for i := range 20 {
+		users.Put(user{i, fmt.Sprintf("u%d@x", i), fmt.Sprint(i % 3)})
+	}
+	byCountry, err := AddIndex(users, "country", strings.Compare, func(u user) string { return u.Country }, false)
+	assert.NoError(t, err)
+	assertConsistent(t, users, byCountry)
+	assert.Equal(t, 7, byCountry.Count("0"))
+}
+
+func TestTableRandomOps(t *testing.T) {
+	users, byEmail, byCountry := newUsers(t)
+	rng := rand.New(rand.NewSource(2))
+	for range 2000 {
+		id := rng.Intn(100)
+		switch rng.Intn(3) {
+		case 0:
+			users.Delete(id)
+		default:
+			// small email space so unique clashes happen
+			err := users.Put(user{id, fmt.Sprintf("%d@x", rng.Intn(150)), fmt.Sprint(rng.Intn(5))})
+			if err != nil {
+				assert.ErrorIs(t, err, ErrDuplicate)
+			}
+		}
+	}
+	assertConsistent(t, users, byEmail, byCountry)
+}
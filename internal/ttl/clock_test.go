@@ -0,0 +1,35 @@
+package ttl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestManualClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	soon, later := clock.After(time.Second), clock.After(time.Minute)
+	assert.True(t, fired(clock.After(0)), "nothing to wait for")
+	assert.False(t, fired(soon))
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(30*time.Second), clock.Now())
+	assert.True(t, fired(soon))
+	assert.False(t, fired(later))
+
+	clock.Advance(30 * time.Second)
+	assert.True(t, fired(later))
+}
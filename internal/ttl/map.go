@@ -0,0 +1,225 @@
+package ttl
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	btree "github.com/LucasUTNFRD/db-from-scratch/internal/b-tree"
+)
+
+var ErrNotFound = errors.New("ttl: key not found")
+
+// sweepBatch is how many entries Sweep removes before letting other callers
+// take the lock, so a big wave of expirations doesn't stall Get and Put
+const sweepBatch = 128
+
+// Options tune an expiring map
+type Options struct {
+	// Order of both BTrees, 32 if zero
+	Order int
+	// Clock tells the time, SystemClock if nil
+	Clock Clock
+	// SweepEvery is how often a background goroutine removes the expired
+	// entries. Zero disables it, Sweep can still be called by hand.
+	SweepEvery time.Duration
+}
+
+// Map is a key-value map where entries can expire. Entries live in a BTree by
+// key, and the ones with a TTL are also in a second BTree ordered by their
+// expiry time, so the sweeper finds the expired entries at the start of it
+// instead of scanning the whole map, and there's no timer per key.
+//
+// Expired entries are hidden by Get right away but only removed by Sweep, or
+// by Len which has to know how many are left.
+// A Map is safe for concurrent use.
+type Map[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries *btree.BTree[K, entry[V]]
+	expiry  *btree.BTree[deadline[K], struct{}]
+	clock   Clock
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type entry[V any] struct {
+	value   V
+	expires int64 // unix nanoseconds, 0 if the entry never expires
+}
+
+// deadline orders the expiry tree by time first, the key keeps entries
+// expiring at the same instant apart
+type deadline[K comparable] = btree.Tuple2[int64, K]
+
+// New creates an empty map ordered by cmp. Close must be called to stop the
+// sweeper when opts.SweepEvery is set.
+func New[K comparable, V any](cmp btree.Comparator[K], opts Options) *Map[K, V] {
+	if opts.Order == 0 {
+		opts.Order = 32
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	m := &Map[K, V]{
+		entries: btree.NewBTree[K, entry[V]](opts.Order, cmp),
+		expiry:  btree.NewBTree[deadline[K], struct{}](opts.Order, btree.CompareTuple2(cmpInt64, cmp)),
+		clock:   opts.Clock,
+		done:    make(chan struct{}),
+	}
+	if opts.SweepEvery > 0 {
+		m.wg.Add(1)
+		go m.sweeper(opts.SweepEvery)
+	}
+	return m
+}
+
+var cmpInt64 = cmp.Compare[int64]
+
+func (m *Map[K, V]) now() int64 {
+	return m.clock.Now().UnixNano()
+}
+
+func (e entry[V]) expired(now int64) bool {
+	return e.expires != 0 && e.expires <= now
+}
+
+// Put stores value under key, replacing any previous entry and its TTL. The
+// entry expires once ttl has passed, a ttl of zero or less keeps it forever.
+func (m *Map[K, V]) Put(key K, value V, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := entry[V]{value: value}
+	if ttl > 0 {
+		// saturate instead of wrapping into the past for huge TTLs
+		now := m.now()
+		e.expires = now + min(int64(ttl), math.MaxInt64-now)
+	}
+	if old, found := m.entries.Get(key); found && old.expires != 0 {
+		m.expiry.Delete(deadline[K]{A: old.expires, B: key})
+	}
+	m.entries.Put(key, e)
+	if e.expires != 0 {
+		m.expiry.Put(deadline[K]{A: e.expires, B: key}, struct{}{})
+	}
+}
+
+// Get returns the value of key, expired entries are reported as missing
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.entries.Get(key)
+	if !found || e.expired(m.now()) {
+		var zero V
+		return zero, false
+	}
+	return e.value, true
+}
+
+// TTL returns how long key has left, 0 if it never expires
+func (m *Map[K, V]) TTL(key K) (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.entries.Get(key)
+	now := m.now()
+	if !found || e.expired(now) {
+		return 0, false
+	}
+	if e.expires == 0 {
+		return 0, true
+	}
+	return time.Duration(e.expires - now), true
+}
+
+// Delete removes key, it returns ErrNotFound if it's missing or expired
+func (m *Map[K, V]) Delete(key K) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, found := m.entries.Get(key)
+	if !found {
+		return ErrNotFound
+	}
+	m.remove(key, e)
+	if e.expired(m.now()) {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *Map[K, V]) remove(key K, e entry[V]) {
+	m.entries.Delete(key)
+	if e.expires != 0 {
+		m.expiry.Delete(deadline[K]{A: e.expires, B: key})
+	}
+}
+
+// Len returns the number of entries that haven't expired. It removes the
+// expired ones first, so each of them is only looked at once.
+func (m *Map[K, V]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(m.now(), -1)
+	return m.entries.Len()
+}
+
+// expire removes up to limit expired entries, all of them if limit is
+// negative, and returns how many it removed. It must be called with mu held.
+func (m *Map[K, V]) expire(now int64, limit int) int {
+	keys := m.due(now, limit)
+	for _, key := range keys {
+		e, _ := m.entries.Get(key)
+		m.remove(key, e)
+	}
+	return len(keys)
+}
+
+// due returns the keys of up to limit expired entries, all of them if limit
+// is negative. They are the first ones of the expiry tree.
+func (m *Map[K, V]) due(now int64, limit int) []K {
+	var keys []K
+	for d := range m.expiry.All() {
+		if d.A > now || len(keys) == limit {
+			break
+		}
+		keys = append(keys, d.B)
+	}
+	return keys
+}
+
+// Sweep removes every expired entry and returns how many there were
+func (m *Map[K, V]) Sweep() int {
+	removed := 0
+	for {
+		m.mu.Lock()
+		n := m.expire(m.now(), sweepBatch)
+		m.mu.Unlock()
+		removed += n
+		if n < sweepBatch {
+			return removed
+		}
+	}
+}
+
+func (m *Map[K, V]) sweeper(every time.Duration) {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-m.clock.After(every):
+			m.Sweep()
+		}
+	}
+}
+
+// Close stops the background sweeper, the map stays usable
+func (m *Map[K, V]) Close() {
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	m.wg.Wait()
+}
@@ -0,0 +1,137 @@
+package ttl
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMap(opts Options) (*Map[string, int], *ManualClock) {
+	clock := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	opts.Clock = clock
+	opts.Order = 3
+	return New[string, int](cmp.Compare[string], opts), clock
+}
+
+func TestExpiry(t *testing.T) {
+	m, clock := newTestMap(Options{})
+	m.Put("forever", 1, 0)
+	m.Put("short", 2, time.Second)
+	m.Put("long", 3, time.Hour)
+	assert.Equal(t, 3, m.Len())
+
+	left, found := m.TTL("short")
+	assert.True(t, found)
+	assert.Equal(t, time.Second, left)
+	left, found = m.TTL("forever")
+	assert.True(t, found)
+	assert.Zero(t, left)
+
+	clock.Advance(time.Second)
+	_, found = m.Get("short")
+	assert.False(t, found, "expired entries are hidden before any sweep")
+	_, found = m.TTL("short")
+	assert.False(t, found)
+	assert.Equal(t, 2, m.Len())
+	assert.Equal(t, 2, m.entries.Len(), "Len removed what it didn't count")
+	v, found := m.Get("long")
+	assert.True(t, found)
+	assert.Equal(t, 3, v)
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, m.Sweep())
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, 1, m.entries.Len())
+	assert.Zero(t, m.expiry.Len())
+	v, found = m.Get("forever")
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+}
+
+func TestPutResetsTTL(t *testing.T) {
+	m, clock := newTestMap(Options{})
+	m.Put("k", 1, time.Second)
+	m.Put("k", 2, time.Minute)
+	assert.Equal(t, 1, m.expiry.Len(), "the old deadline is gone")
+
+	clock.Advance(time.Second)
+	v, found := m.Get("k")
+	assert.True(t, found)
+	assert.Equal(t, 2, v)
+
+	m.Put("k", 3, 0)
+	clock.Advance(time.Hour)
+	assert.Zero(t, m.Sweep())
+	v, _ = m.Get("k")
+	assert.Equal(t, 3, v)
+}
+
+func TestHugeTTLDoesNotOverflow(t *testing.T) {
+	m, clock := newTestMap(Options{})
+	m.Put("k", 1, math.MaxInt64)
+	clock.Advance(time.Hour)
+	v, found := m.Get("k")
+	assert.True(t, found, "the deadline saturates instead of wrapping around")
+	assert.Equal(t, 1, v)
+	left, found := m.TTL("k")
+	assert.True(t, found)
+	assert.Positive(t, left)
+	assert.Zero(t, m.Sweep())
+}
+
+func TestDelete(t *testing.T) {
+	m, clock := newTestMap(Options{})
+	m.Put("a", 1, time.Second)
+	m.Put("b", 2, time.Second)
+	assert.NoError(t, m.Delete("a"))
+	assert.ErrorIs(t, m.Delete("a"), ErrNotFound)
+
+	clock.Advance(time.Second)
+	assert.ErrorIs(t, m.Delete("b"), ErrNotFound, "expired counts as missing")
+	assert.Zero(t, m.expiry.Len())
+	assert.Zero(t, m.Sweep())
+}
+
+func TestSweepInBatches(t *testing.T) {
+	m, clock := newTestMap(Options{})
+	n := 3*sweepBatch + 7
+	for i := range n {
+		// several entries share each deadline
+		m.Put(fmt.Sprint(i), i, time.Duration(1+i%5)*time.Second)
+	}
+	m.Put("keep", 0, time.Hour)
+
+	clock.Advance(2 * time.Second)
+	swept := m.Sweep()
+	clock.Advance(3 * time.Second)
+	swept += m.Sweep()
+	assert.Equal(t, n, swept)
+	assert.Equal(t, 1, m.Len())
+	_, found := m.Get("keep")
+	assert.True(t, found)
+}
+
+func TestBackgroundSweeper(t *testing.T) {
+	m, clock := newTestMap(Options{SweepEvery: time.Second})
+	defer m.Close()
+	for i := range 10 {
+		m.Put(fmt.Sprint(i), i, time.Minute)
+	}
+	m.Put("keep", 0, 0)
+	clock.Advance(time.Minute)
+
+	// the sweeper may not be waiting on the clock yet, keep ticking
+	assert.Eventually(t, func() bool {
+		clock.Advance(time.Second)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.entries.Len() == 1
+	}, time.Second, time.Millisecond)
+
+	m.Close()
+	m.Close()
+}
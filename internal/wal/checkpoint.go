@@ -0,0 +1,113 @@
+package wal
+
+import (
+	"encoding/binary"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+const masterFile = "CHECKPOINT"
+
+// writeMaster records the begin LSN of the last complete checkpoint, this is
+// where recovery starts looking
+func writeMaster(dir string, lsn LSN) error {
+	tmp := filepath.Join(dir, masterFile+".tmp")
+	if err := os.WriteFile(tmp, binary.BigEndian.AppendUint64(nil, uint64(lsn)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, masterFile))
+}
+
+// readMaster returns 0 when no checkpoint was ever completed
+func readMaster(dir string) (LSN, error) {
+	data, err := os.ReadFile(filepath.Join(dir, masterFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, ErrCorrupt
+	}
+	return LSN(binary.BigEndian.Uint64(data)), nil
+}
+
+// flushBatch is how many pages flushPages copies per lock acquisition
+const flushBatch = 64
+
+// flushed is the copy of a page flushPages writes while the lock is released
+type flushed struct {
+	id    PageID
+	lsn   LSN
+	free  bool
+	image []byte
+}
+
+// flushPages writes the pages that were dirty when it started to their
+// files. The lock is only held to copy a batch of pages and sync the log,
+// the log goes to disk first so a page never gets there before the records
+// that explain it. A page changed again while it was written stays in the
+// dirty page table, its recLSN moves past what was written.
+func (t *Tree[K, V]) flushPages() error {
+	t.mu.Lock()
+	ids := slices.Collect(maps.Keys(t.dirty))
+	t.mu.Unlock()
+
+	for len(ids) > 0 {
+		batch := ids[:min(flushBatch, len(ids))]
+		ids = ids[len(batch):]
+
+		t.mu.Lock()
+		copies := make([]flushed, 0, len(batch))
+		var err error
+		for _, id := range batch {
+			p, ok := t.pages[id]
+			if _, dirty := t.dirty[id]; !ok || !dirty {
+				continue
+			}
+			f := flushed{id: id, lsn: p.lsn, free: p.free}
+			if !p.free {
+				if f.image, err = t.encodePage(p); err != nil {
+					break
+				}
+			}
+			copies = append(copies, f)
+		}
+		if err == nil {
+			err = t.log.Sync()
+		}
+		t.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		for _, f := range copies {
+			if f.free {
+				err = removePage(t.dir, f.id)
+			} else {
+				err = writePage(t.dir, f.id, f.lsn, f.image)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		t.mu.Lock()
+		for _, f := range copies {
+			switch p := t.pages[f.id]; {
+			case p.lsn != f.lsn:
+				t.dirty[f.id] = f.lsn + 1
+			case p.free:
+				delete(t.pages, f.id)
+				delete(t.dirty, f.id)
+			default:
+				delete(t.dirty, f.id)
+			}
+		}
+		t.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+// Package wal is a durable B+tree recovered with ARIES after a crash.
+//
+// It is a tree of its own, with pages, pageLSNs and a log, and not a layer
+// over the in-memory BTree of internal/b-tree: changes made to a btree.BTree
+// are never logged and don't survive a crash. Its split and merge code is
+// written again here so every structure modification can be logged page by
+// page as a nested top action.
+package wal
@@ -0,0 +1,237 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const segmentSuffix = ".wal"
+
+// Log is an append only sequence of records split in segment files.
+// Each segment is named after the first LSN it holds, so dropping the prefix
+// of the log that is no longer needed is just removing whole files.
+type Log struct {
+	dir      string
+	sync     bool
+	file     *os.File // active segment, always the last one
+	segments []LSN    // first LSN of every segment, in order
+	next     LSN      // LSN that the next appended record will get
+}
+
+// OpenLog opens (or creates) the log stored in dir. A torn record at the end
+// of the last segment, left by a crash in the middle of a write, is cut off.
+func OpenLog(dir string, sync bool) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, sync: sync, next: 1}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var first uint64
+		if _, err := fmt.Sscanf(name, "%020d"+segmentSuffix, &first); err != nil {
+			continue
+		}
+		l.segments = append(l.segments, LSN(first))
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+
+	if len(l.segments) == 0 {
+		return l, l.openSegment(l.next)
+	}
+
+	last := l.segments[len(l.segments)-1]
+	l.next = last
+	valid, err := scanSegment(l.segmentPath(last), true, func(r *Record) error {
+		l.next = r.LSN + 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Truncate(l.segmentPath(last), valid); err != nil {
+		return nil, err
+	}
+	l.file, err = os.OpenFile(l.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0o644)
+	return l, err
+}
+
+// NextLSN is the LSN the next appended record will receive
+func (l *Log) NextLSN() LSN {
+	return l.next
+}
+
+// Append assigns the next LSN to the record and writes it to the active segment
+func (l *Log) Append(r *Record) (LSN, error) {
+	r.LSN = l.next
+	if _, err := l.file.Write(r.encode()); err != nil {
+		return 0, err
+	}
+	if l.sync {
+		if err := l.file.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	l.next++
+	return r.LSN, nil
+}
+
+// Sync forces the active segment to stable storage
+func (l *Log) Sync() error {
+	return l.file.Sync()
+}
+
+// Rotate closes the active segment and starts a new one at the next LSN
+func (l *Log) Rotate() error {
+	if l.segments[len(l.segments)-1] == l.next {
+		return nil // active segment is still empty
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	return l.openSegment(l.next)
+}
+
+// TruncateBefore removes every segment whose records all have an LSN lower
+// than lsn. The active segment is never removed.
+func (l *Log) TruncateBefore(lsn LSN) error {
+	keep := 0
+	for keep < len(l.segments)-1 && l.segments[keep+1] <= lsn {
+		keep++
+	}
+	for _, first := range l.segments[:keep] {
+		if err := os.Remove(l.segmentPath(first)); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[keep:]
+	return nil
+}
+
+// FirstLSN is the lowest LSN that may still be in the log
+func (l *Log) FirstLSN() LSN {
+	return l.segments[0]
+}
+
+// Replay calls fn for every record with an LSN greater or equal than from,
+// in LSN order. A record that can't be read is ErrCorrupt, only a torn one at
+// the end of the last segment marks the end of the log.
+func (l *Log) Replay(from LSN, fn func(*Record) error) error {
+	for i, first := range l.segments {
+		if i+1 < len(l.segments) && l.segments[i+1] <= from {
+			continue // the whole segment is before from
+		}
+		_, err := scanSegment(l.segmentPath(first), i == len(l.segments)-1, func(r *Record) error {
+			if r.LSN < from {
+				return nil
+			}
+			return fn(r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the active segment
+func (l *Log) Close() error {
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	return l.file.Close()
+}
+
+func (l *Log) segmentPath(first LSN) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", first, segmentSuffix))
+}
+
+func (l *Log) openSegment(first LSN) error {
+	f, err := os.OpenFile(l.segmentPath(first), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.segments = append(l.segments, first)
+	return nil
+}
+
+// scanSegment reads the records of a segment until the end of the file. In
+// the last segment the final frame may be torn by a crash in the middle of a
+// write, incomplete or failing its checksum, and the scan stops there. Any
+// other frame that can't be read is ErrCorrupt: skipping it would replay the
+// records after it on top of a gap. It returns the offset where the valid
+// part of the segment ends.
+func scanSegment(path string, last bool, fn func(*Record) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	header := make([]byte, frameHeaderSize)
+	torn := func(what string) (int64, error) {
+		if last {
+			return offset, nil
+		}
+		return offset, fmt.Errorf("%w: %s at offset %d: %s", ErrCorrupt, path, offset, what)
+	}
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return torn("incomplete frame")
+			}
+			return offset, err
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		end := offset + int64(frameHeaderSize) + int64(size)
+		if end > info.Size() {
+			return torn("incomplete frame")
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return offset, err
+		}
+		if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+			if end == info.Size() {
+				return torn("checksum mismatch")
+			}
+			return offset, fmt.Errorf("%w: %s at offset %d: checksum mismatch", ErrCorrupt, path, offset)
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return offset, fmt.Errorf("%s at offset %d: %w", path, offset, err)
+		}
+		if err := fn(rec); err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+}
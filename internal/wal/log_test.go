@@ -0,0 +1,161 @@
+package wal
+
+import (
+	"cmp"
+	"os"
+	"testing"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replayAll(t *testing.T, l *Log, from LSN) []*Record {
+	var recs []*Record
+	require.NoError(t, l.Replay(from, func(r *Record) error {
+		recs = append(recs, r)
+		return nil
+	}))
+	return recs
+}
+
+func TestLogAppendReplay(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, false)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		lsn, err := l.Append(&Record{Type: RecordPut, Key: []byte{byte(i)}, Value: []byte("v")})
+		require.NoError(t, err)
+		assert.Equal(t, LSN(i+1), lsn)
+		if i == 4 {
+			require.NoError(t, l.Rotate())
+		}
+	}
+	require.NoError(t, l.Close())
+
+	l, err = OpenLog(dir, false)
+	require.NoError(t, err)
+	assert.Equal(t, LSN(11), l.NextLSN())
+
+	recs := replayAll(t, l, 3)
+	assert.Len(t, recs, 8)
+	assert.Equal(t, LSN(3), recs[0].LSN)
+	assert.Equal(t, []byte{2}, recs[0].Key)
+}
+
+func TestLogTruncateBefore(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, false)
+	require.NoError(t, err)
+
+	for i := 0; i < 9; i++ {
+		_, err := l.Append(&Record{Type: RecordPut})
+		require.NoError(t, err)
+		if i%3 == 2 {
+			require.NoError(t, l.Rotate()) // segments start at 1, 4, 7, 10
+		}
+	}
+	require.NoError(t, l.TruncateBefore(5))
+	assert.Equal(t, LSN(4), l.FirstLSN())
+	assert.Len(t, replayAll(t, l, 0), 6)
+
+	require.NoError(t, l.TruncateBefore(100))
+	assert.Equal(t, LSN(10), l.FirstLSN(), "active segment is never removed")
+}
+
+func TestLogTornTail(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, false)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := l.Append(&Record{Type: RecordPut, Key: []byte("key")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	// chop the last record in half, like a crash in the middle of a write
+	path := l.segmentPath(1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	l, err = OpenLog(dir, false)
+	require.NoError(t, err)
+	assert.Equal(t, LSN(3), l.NextLSN())
+	assert.Len(t, replayAll(t, l, 0), 2)
+
+	_, err = l.Append(&Record{Type: RecordDelete, Key: []byte("key")})
+	require.NoError(t, err)
+	recs := replayAll(t, l, 0)
+	assert.Len(t, recs, 3)
+	assert.Equal(t, RecordDelete, recs[2].Type)
+}
+
+func TestLogCorruptionBeforeTheTail(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenLog(dir, false)
+	require.NoError(t, err)
+	for i := 0; i < 6; i++ {
+		_, err := l.Append(&Record{Type: RecordPut, Key: []byte("key")})
+		require.NoError(t, err)
+		if i == 2 {
+			require.NoError(t, l.Rotate()) // segments start at 1 and 4
+		}
+	}
+	require.NoError(t, l.Close())
+
+	// a byte flipped in the second record of the first segment: the records
+	// after it must not be replayed on top of the gap
+	path := l.segmentPath(1)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	frame := len(data) / 3
+	data[frame+frameHeaderSize+2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	l, err = OpenLog(dir, false)
+	require.NoError(t, err, "the last segment is fine")
+	err = l.Replay(1, func(*Record) error { return nil })
+	assert.ErrorIs(t, err, ErrCorrupt)
+	require.NoError(t, l.Close())
+
+	// same for a frame cut short in a segment that isn't the last one
+	require.NoError(t, os.WriteFile(path, data[:len(data)-3], 0o644))
+	l, err = OpenLog(dir, false)
+	require.NoError(t, err)
+	assert.ErrorIs(t, l.Replay(1, func(*Record) error { return nil }), ErrCorrupt)
+	require.NoError(t, l.Close())
+
+	// in the last segment only the final frame may be torn
+	require.NoError(t, os.Remove(path))
+	last := l.segmentPath(4)
+	data, err = os.ReadFile(last)
+	require.NoError(t, err)
+	data[frame+frameHeaderSize+2] ^= 0xff
+	require.NoError(t, os.WriteFile(last, data, 0o644))
+	_, err = OpenLog(dir, false)
+	assert.ErrorIs(t, err, ErrCorrupt)
+}
+
+func TestTreeRefusesCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 4})
+	for i := 0; i < 20; i++ {
+		require.NoError(t, tree.Put(i, i))
+	}
+	require.NoError(t, tree.log.Rotate())
+	for i := 20; i < 40; i++ {
+		require.NoError(t, tree.Put(i, i))
+	}
+	tree.crash()
+
+	path := tree.log.segmentPath(1)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)/2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	_, err = Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{}, Options{Order: 4})
+	assert.ErrorIs(t, err, ErrCorrupt, "committed updates would be lost")
+}
@@ -0,0 +1,210 @@
+package wal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PageID identifies a page of the tree, 0 is never used. The root always
+// lives in rootPage, splitting it moves its contents down instead.
+type PageID uint64
+
+const (
+	rootPage   PageID = 1
+	pagePrefix        = "page-"
+)
+
+// page is a node of the tree, the unit that is logged and written to disk.
+// The tree is a B+tree: leaves hold the entries and internal pages only keys
+// to route lookups, children[i] holds the keys lower than keys[i] and
+// children[i+1] the ones greater or equal.
+//
+// lsn is the pageLSN, the last logged change applied to the page. Redo
+// compares it with the LSN of a record to know whether the page has it.
+type page[K comparable, V any] struct {
+	id       PageID
+	lsn      LSN
+	leaf     bool
+	free     bool // released by a merge, waiting for its file to be removed
+	keys     []K
+	values   []V      // leaves only
+	children []PageID // internal pages only
+}
+
+// entries returns how many entries of the tree the page holds
+func (p *page[K, V]) entries() int {
+	if !p.leaf || p.free {
+		return 0
+	}
+	return len(p.keys)
+}
+
+const (
+	pageLeaf = 1 << 0
+	pageFree = 1 << 1
+)
+
+// encodePage builds the image of a page, which is what RecordPage logs and
+// what the page file holds:
+// [flags uint8][count uvarint][keys...] then the values of a leaf or the
+// count+1 children of an internal page
+func (t *Tree[K, V]) encodePage(p *page[K, V]) ([]byte, error) {
+	if p.free {
+		return []byte{pageFree}, nil
+	}
+	var flags byte
+	if p.leaf {
+		flags |= pageLeaf
+	}
+	buf := binary.AppendUvarint([]byte{flags}, uint64(len(p.keys)))
+	var err error
+	for _, k := range p.keys {
+		if buf, err = appendEncoded(buf, t.kc.Encode, k); err != nil {
+			return nil, err
+		}
+	}
+	if p.leaf {
+		for _, v := range p.values {
+			if buf, err = appendEncoded(buf, t.vc.Encode, v); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	for _, child := range p.children {
+		buf = binary.AppendUvarint(buf, uint64(child))
+	}
+	return buf, nil
+}
+
+// appendEncoded appends the length of the encoding of v followed by it
+func appendEncoded[T any](dst []byte, encode func([]byte, T) ([]byte, error), v T) ([]byte, error) {
+	b, err := encode(nil, v)
+	if err != nil {
+		return dst, err
+	}
+	return appendBytes(dst, b), nil
+}
+
+// decodePage replaces the contents of p with the image, its id and pageLSN
+// are left alone
+func (t *Tree[K, V]) decodePage(p *page[K, V], image []byte) error {
+	d := decoder{buf: image}
+	flags := d.byte()
+	*p = page[K, V]{id: p.id, lsn: p.lsn, leaf: flags&pageLeaf != 0, free: flags&pageFree != 0}
+	if p.free || d.err != nil {
+		return d.err
+	}
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		return ErrCorrupt
+	}
+	p.keys = make([]K, n)
+	for i := range p.keys {
+		k, err := t.kc.Decode(d.bytes())
+		if d.err != nil {
+			return d.err
+		}
+		if err != nil {
+			return fmt.Errorf("%w: page %d: %v", ErrCorrupt, p.id, err)
+		}
+		p.keys[i] = k
+	}
+	if p.leaf {
+		p.values = make([]V, n)
+		for i := range p.values {
+			v, err := t.vc.Decode(d.bytes())
+			if d.err != nil {
+				return d.err
+			}
+			if err != nil {
+				return fmt.Errorf("%w: page %d: %v", ErrCorrupt, p.id, err)
+			}
+			p.values[i] = v
+		}
+	} else {
+		p.children = make([]PageID, n+1)
+		for i := range p.children {
+			p.children[i] = PageID(d.uvarint())
+		}
+	}
+	return d.err
+}
+
+func pagePath(dir string, id PageID) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d", pagePrefix, id))
+}
+
+// writePage stores a page image as [pageLSN uint64][image][crc32c uint32],
+// going through a temporary file so a crash never leaves a torn page
+func writePage(dir string, id PageID, lsn LSN, image []byte) error {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(lsn))
+	buf = append(buf, image...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.Checksum(buf, crcTable))
+
+	tmp := pagePath(dir, id) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pagePath(dir, id))
+}
+
+// removePage drops the file of a freed page, if it was ever written
+func removePage(dir string, id PageID) error {
+	err := os.Remove(pagePath(dir, id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readPages loads every page file of dir into the pool
+func (t *Tree[K, V]) readPages() error {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var id uint64
+		if !strings.HasPrefix(e.Name(), pagePrefix) || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		if _, err := fmt.Sscanf(e.Name(), pagePrefix+"%020d", &id); err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(t.dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		if len(data) < 12 {
+			return fmt.Errorf("%w: page %d too short", ErrCorrupt, id)
+		}
+		body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+		if crc32.Checksum(body, crcTable) != sum {
+			return fmt.Errorf("%w: page %d checksum mismatch", ErrCorrupt, id)
+		}
+		p := &page[K, V]{id: PageID(id), lsn: LSN(binary.BigEndian.Uint64(body))}
+		if err := t.decodePage(p, body[8:]); err != nil {
+			return err
+		}
+		t.pages[p.id] = p
+		t.nextPage = max(t.nextPage, p.id+1)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// LSN is the log sequence number, it grows by one for every record appended
+type LSN uint64
+
+// TxnID identifies a transaction, 0 is never used
+type TxnID uint64
+
+// RecordType tells how a record has to be interpreted during recovery
+type RecordType uint8
+
+const (
+	RecordPut RecordType = iota + 1
+	RecordDelete
+	RecordBeginCheckpoint
+	RecordEndCheckpoint
+	RecordCommit
+	RecordAbort
+	RecordCLR
+	RecordEnd
+	RecordPage
+)
+
+// Record is a single entry of the log, keys and values are already encoded
+// with the codecs of the tree that wrote them
+type Record struct {
+	LSN     LSN
+	Type    RecordType
+	TxnID   TxnID
+	PrevLSN LSN // previous record of the same transaction, 0 for the first one
+
+	// page the record changes, 0 for records that change no page
+	PageID PageID
+
+	Key   []byte
+	Value []byte
+
+	// Before image used to undo a put or delete. For a CLR it describes the
+	// compensation itself: put Value back if HadOld, delete Key otherwise.
+	HadOld   bool
+	OldValue []byte
+
+	// RecordPage logs a page changed by a structure modification, Value is
+	// the page after it and OldValue before it. A CLR with Image set puts the
+	// page image in Value back.
+	Image bool
+
+	// only set on RecordCLR, next record of the transaction left to undo
+	UndoNextLSN LSN
+
+	// only set on RecordEndCheckpoint
+	Checkpoint *CheckpointData
+}
+
+// isUpdate reports whether the record changes a page when redone, the dummy
+// CLR closing a nested top action changes none
+func (r *Record) isUpdate() bool {
+	switch r.Type {
+	case RecordPut, RecordDelete, RecordPage, RecordCLR:
+		return r.PageID != 0
+	}
+	return false
+}
+
+// CheckpointData is the payload of an end checkpoint record, both tables are
+// taken when the begin record is logged. Active is the active transaction
+// table, mapping a transaction to the last record it wrote. Dirty is the
+// dirty page table, mapping a page to the first change it doesn't have on
+// disk (its recLSN). Redo starts at RedoLSN, the oldest of them.
+type CheckpointData struct {
+	BeginLSN LSN
+	RedoLSN  LSN
+	NextTxn  TxnID
+	NextPage PageID
+	Active   map[TxnID]LSN
+	Dirty    map[PageID]LSN
+}
+
+var (
+	ErrCorrupt = errors.New("wal: corrupt record")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+const frameHeaderSize = 8 // payload length + crc
+
+const (
+	flagHadOld = 1 << 0
+	flagImage  = 1 << 1
+)
+
+// encode builds the on-disk frame of the record:
+// [payload len uint32][crc32c uint32][lsn uint64][type uint8][fields...]
+func (r *Record) encode() []byte {
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+48+len(r.Key)+len(r.Value)+len(r.OldValue))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(r.LSN))
+	buf = append(buf, byte(r.Type))
+	buf = binary.AppendUvarint(buf, uint64(r.TxnID))
+	buf = binary.AppendUvarint(buf, uint64(r.PrevLSN))
+	buf = binary.AppendUvarint(buf, uint64(r.UndoNextLSN))
+	buf = binary.AppendUvarint(buf, uint64(r.PageID))
+	var flags byte
+	if r.HadOld {
+		flags |= flagHadOld
+	}
+	if r.Image {
+		flags |= flagImage
+	}
+	buf = append(buf, flags)
+	buf = appendBytes(buf, r.Key)
+	buf = appendBytes(buf, r.Value)
+	buf = appendBytes(buf, r.OldValue)
+	if r.Checkpoint != nil {
+		buf = binary.AppendUvarint(buf, uint64(r.Checkpoint.BeginLSN))
+		buf = binary.AppendUvarint(buf, uint64(r.Checkpoint.RedoLSN))
+		buf = binary.AppendUvarint(buf, uint64(r.Checkpoint.NextTxn))
+		buf = binary.AppendUvarint(buf, uint64(r.Checkpoint.NextPage))
+		buf = binary.AppendUvarint(buf, uint64(len(r.Checkpoint.Active)))
+		for txn, last := range r.Checkpoint.Active {
+			buf = binary.AppendUvarint(buf, uint64(txn))
+			buf = binary.AppendUvarint(buf, uint64(last))
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(r.Checkpoint.Dirty)))
+		for id, recLSN := range r.Checkpoint.Dirty {
+			buf = binary.AppendUvarint(buf, uint64(id))
+			buf = binary.AppendUvarint(buf, uint64(recLSN))
+		}
+	}
+	payload := buf[frameHeaderSize:]
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	return buf
+}
+
+// decodeRecord parses a payload whose checksum was already verified
+func decodeRecord(payload []byte) (*Record, error) {
+	if len(payload) < 9 {
+		return nil, ErrCorrupt
+	}
+	r := &Record{
+		LSN:  LSN(binary.BigEndian.Uint64(payload)),
+		Type: RecordType(payload[8]),
+	}
+	d := decoder{buf: payload[9:]}
+	r.TxnID = TxnID(d.uvarint())
+	r.PrevLSN = LSN(d.uvarint())
+	r.UndoNextLSN = LSN(d.uvarint())
+	r.PageID = PageID(d.uvarint())
+	flags := d.byte()
+	r.HadOld = flags&flagHadOld != 0
+	r.Image = flags&flagImage != 0
+	r.Key = d.bytes()
+	r.Value = d.bytes()
+	r.OldValue = d.bytes()
+	if r.Type == RecordEndCheckpoint {
+		cp := &CheckpointData{
+			BeginLSN: LSN(d.uvarint()),
+			RedoLSN:  LSN(d.uvarint()),
+			NextTxn:  TxnID(d.uvarint()),
+			NextPage: PageID(d.uvarint()),
+			Active:   map[TxnID]LSN{},
+			Dirty:    map[PageID]LSN{},
+		}
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			txn := TxnID(d.uvarint())
+			cp.Active[txn] = LSN(d.uvarint())
+		}
+		for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+			id := PageID(d.uvarint())
+			cp.Dirty[id] = LSN(d.uvarint())
+		}
+		r.Checkpoint = cp
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return r, nil
+}
+
+func appendBytes(dst, b []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// decoder reads consecutive fields and remembers the first error so callers
+// can check once at the end
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) == 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = ErrCorrupt
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
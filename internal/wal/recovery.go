@@ -0,0 +1,156 @@
+package wal
+
+// recover follows ARIES:
+//
+//  1. analysis: starting at the last checkpoint, rebuild the active
+//     transaction table to know which transactions never finished, and the
+//     dirty page table to know which pages may lack logged changes
+//  2. redo: repeat history from the oldest recLSN, reapplying every change a
+//     page doesn't have yet according to its pageLSN, including the ones of
+//     unfinished transactions, CLRs and structure modifications
+//  3. undo: roll the unfinished transactions back, newest change first,
+//     logging a CLR for each undone change. Completed structure
+//     modifications are skipped through their dummy CLRs, one cut short by
+//     the crash is undone page by page before anything else.
+func (t *Tree[K, V]) recover() error {
+	begin, err := readMaster(t.dir)
+	if err != nil {
+		return err
+	}
+	if err := t.readPages(); err != nil {
+		return err
+	}
+	t.stats.Pages = len(t.pages)
+
+	// the log was only truncated up to what undo may still need, keep all of it
+	var records []*Record
+	byLSN := map[LSN]*Record{}
+	err = t.log.Replay(t.log.FirstLSN(), func(r *Record) error {
+		records = append(records, r)
+		byLSN[r.LSN] = r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// analysis
+	att := map[TxnID]LSN{} // loser candidates -> last LSN
+	t.stats.CheckpointLSN = begin
+	for _, r := range records {
+		if r.Type == RecordEndCheckpoint && r.Checkpoint.BeginLSN == begin {
+			for id, last := range r.Checkpoint.Active {
+				att[id] = last
+			}
+			for id, recLSN := range r.Checkpoint.Dirty {
+				t.dirty[id] = recLSN
+			}
+			t.nextTxn = max(t.nextTxn, r.Checkpoint.NextTxn)
+			t.nextPage = max(t.nextPage, r.Checkpoint.NextPage)
+		}
+	}
+	for _, r := range records {
+		t.nextPage = max(t.nextPage, r.PageID+1)
+		if r.LSN <= begin {
+			continue
+		}
+		if _, ok := t.dirty[r.PageID]; r.isUpdate() && !ok {
+			t.dirty[r.PageID] = r.LSN
+		}
+		if r.TxnID == 0 {
+			continue
+		}
+		t.nextTxn = max(t.nextTxn, r.TxnID+1)
+		switch r.Type {
+		case RecordCommit, RecordEnd:
+			delete(att, r.TxnID)
+		default:
+			att[r.TxnID] = r.LSN
+		}
+	}
+
+	// redo
+	for _, r := range records {
+		recLSN, dirty := t.dirty[r.PageID]
+		if !r.isUpdate() || !dirty || r.LSN < recLSN || t.page(r.PageID).lsn >= r.LSN {
+			continue
+		}
+		if err := t.apply(r); err != nil {
+			return err
+		}
+		t.stats.Replayed++
+	}
+
+	// undo
+	t.stats.Losers = len(att)
+	losers := map[TxnID]*txnState{}
+	for id, last := range att {
+		losers[id] = &txnState{id: id, lastLSN: last}
+	}
+	next := att // transaction -> next LSN to look at
+	for len(next) > 0 {
+		var id TxnID
+		var lsn LSN
+		for txn, l := range next {
+			if l > lsn {
+				id, lsn = txn, l
+			}
+		}
+		st := losers[id]
+		r, ok := byLSN[lsn]
+		if !ok {
+			return ErrCorrupt // the chain points to a truncated record
+		}
+
+		switch r.Type {
+		case RecordPut, RecordDelete:
+			if err := t.compensate(st, r); err != nil {
+				return err
+			}
+			t.stats.Compensated++
+			lsn = r.PrevLSN
+		case RecordPage:
+			if err := t.compensateImage(st, r); err != nil {
+				return err
+			}
+			t.stats.Compensated++
+			lsn = r.PrevLSN
+		case RecordCLR:
+			lsn = r.UndoNextLSN
+		default:
+			lsn = r.PrevLSN
+		}
+
+		if lsn == 0 {
+			if err := t.appendTxn(st, &Record{Type: RecordEnd}); err != nil {
+				return err
+			}
+			delete(next, id)
+		} else {
+			next[id] = lsn
+		}
+	}
+	// a split cut short by the crash may leave entries on pages not linked
+	// yet, count once undo has put the old pages back
+	t.size = t.count(t.page(rootPage))
+
+	// what a crash right now would replay, until the next checkpoint
+	redo := t.log.NextLSN()
+	for _, recLSN := range t.dirty {
+		redo = min(redo, recLSN)
+	}
+	t.sinceCheckpoint = int(t.log.NextLSN() - redo)
+	return t.log.Sync()
+}
+
+// count returns the number of entries under p
+func (t *Tree[K, V]) count(p *page[K, V]) int {
+	if p.leaf {
+		return len(p.keys)
+	}
+	n := 0
+	for _, child := range p.children {
+		n += t.count(t.page(child))
+	}
+	return n
+}
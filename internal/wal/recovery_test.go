@@ -0,0 +1,254 @@
+package wal
+
+import (
+	"cmp"
+	"testing"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoveryRollsBackLosers(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, tree.Put(i, i))
+	}
+
+	loser := tree.Begin()
+	require.NoError(t, loser.Put(1, 100)) // overwrite
+	require.NoError(t, loser.Put(50, 50)) // new key
+	require.NoError(t, loser.Delete(2))   // delete
+	require.NoError(t, loser.Put(1, 200)) // second write to the same key
+	require.NoError(t, tree.Put(3, 33))   // committed work after the loser
+	assert.ErrorIs(t, tree.Put(50, 0), ErrConflict)
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	expected := map[int]int{0: 0, 1: 1, 2: 2, 3: 33, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8, 9: 9}
+	assertContents(t, tree, expected)
+	stats := tree.Recovered()
+	assert.Equal(t, 1, stats.Losers)
+	assert.Equal(t, 4, stats.Compensated)
+	tree.crash()
+
+	// the rollback was logged, nothing is left to undo the second time
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assert.Equal(t, 0, tree.Recovered().Losers)
+}
+
+func TestAbort(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	require.NoError(t, tree.Put(1, 1))
+
+	txn := tree.Begin()
+	require.NoError(t, txn.Put(1, 10))
+	require.NoError(t, txn.Put(2, 20))
+	v, _ := tree.Get(1)
+	assert.Equal(t, 10, v, "reads see uncommitted values")
+
+	require.NoError(t, txn.Abort())
+	assert.ErrorIs(t, txn.Commit(), ErrTxnDone)
+	assertContents(t, tree, map[int]int{1: 1})
+	require.NoError(t, tree.Put(2, 2), "locks are released on abort")
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, map[int]int{1: 1, 2: 2})
+	assert.Equal(t, 0, tree.Recovered().Losers)
+}
+
+func TestCrashDuringUndo(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	loser := tree.Begin()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, loser.Put(i, i))
+	}
+	tree.crash()
+
+	compensation := func(r *Record) bool { return r.Type == RecordCLR && r.Key != nil }
+	_, err := Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{},
+		Options{Order: 3, beforeAppend: crashBefore(3, compensation)})
+	assert.ErrorIs(t, err, errCrash)
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, map[int]int{})
+	stats := tree.Recovered()
+	assert.Equal(t, 1, stats.Losers)
+	assert.Equal(t, 3, stats.Compensated, "changes undone before the crash are skipped through the CLRs")
+}
+
+func TestAbortKeepsStructureModifications(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	for i := 0; i < 10; i++ {
+		require.NoError(t, tree.Put(i*10, i))
+	}
+	txn := tree.Begin()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, txn.Put(i*10+5, i))
+	}
+	require.NoError(t, txn.Delete(0))
+	require.NoError(t, txn.Abort())
+
+	expected := map[int]int{}
+	for i := 0; i < 10; i++ {
+		expected[i*10] = i
+	}
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+
+	// splits are skipped by their dummy CLRs, the rollback deletes the keys
+	// wherever they went instead of putting the old pages back
+	var images, dummies int
+	require.NoError(t, tree.log.Replay(1, func(r *Record) error {
+		switch {
+		case r.Type == RecordCLR && r.Image:
+			images++
+		case r.Type == RecordCLR && r.PageID == 0:
+			dummies++
+		}
+		return nil
+	}))
+	assert.Zero(t, images)
+	assert.NotZero(t, dummies)
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+	assert.Equal(t, 0, tree.Recovered().Losers)
+}
+
+func TestCrashDuringStructureModification(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	expected := map[int]int{}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, tree.Put(i, i))
+		expected[i] = i
+	}
+	require.NoError(t, tree.Checkpoint())
+	tree.crash()
+
+	// die right after the first page of the next split is logged
+	pageRecord := func(r *Record) bool { return r.Type == RecordPage }
+	tree = openIntTree(t, dir, Options{Order: 3, beforeAppend: crashBefore(2, pageRecord)})
+	assert.ErrorIs(t, tree.Put(20, 20), errCrash)
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+	stats := tree.Recovered()
+	assert.Equal(t, 1, stats.Losers)
+	assert.Equal(t, 2, stats.Compensated, "the page of the split and the put")
+
+	require.NoError(t, tree.Put(20, 20), "the tree is usable again")
+	expected[20] = 20
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+}
+
+func TestCrashDuringUndoOfStructureModification(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, tree.Put(i*100, i))
+	}
+	loser := tree.Begin()
+	for i := 0; i < 30; i++ {
+		require.NoError(t, loser.Put(i*3+1, i))
+	}
+	tree.crash()
+
+	// the rollback deletes keys, which merges pages, die in the first merge
+	pageRecord := func(r *Record) bool { return r.Type == RecordPage }
+	_, err := Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{},
+		Options{Order: 3, beforeAppend: crashBefore(2, pageRecord)})
+	assert.ErrorIs(t, err, errCrash)
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	assertContents(t, tree, map[int]int{0: 0, 100: 1, 200: 2, 300: 3, 400: 4})
+	// pages left out of bounds by the merge that was undone are fixed the
+	// next time they change, the tree is still correct
+	assertValidTree(t, tree, false)
+	assert.Equal(t, 1, tree.Recovered().Losers)
+	images := 0
+	require.NoError(t, tree.log.Replay(1, func(r *Record) error {
+		if r.Type == RecordCLR && r.Image {
+			images++
+		}
+		return nil
+	}))
+	assert.Equal(t, 1, images, "the page the merge logged before the crash is put back")
+}
+
+func TestLoserSpanningCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 3})
+	require.NoError(t, tree.Put(1, 1))
+
+	loser := tree.Begin()
+	require.NoError(t, loser.Put(1, 10))
+	for i := 2; i < 20; i++ {
+		require.NoError(t, tree.Put(i, i))
+	}
+	require.NoError(t, tree.Checkpoint())
+	assert.LessOrEqual(t, tree.log.FirstLSN(), LSN(3), "log is kept back to the loser's first record")
+	require.NoError(t, loser.Put(100, 100))
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 3})
+	defer tree.Close()
+	v, found := tree.Get(1)
+	assert.True(t, found)
+	assert.Equal(t, 1, v)
+	_, found = tree.Get(100)
+	assert.False(t, found)
+	assert.Equal(t, 1, tree.Recovered().Losers)
+}
+
+func TestLenAfterCrashInsideSplit(t *testing.T) {
+	pageRecord := func(r *Record) bool { return r.Type == RecordPage }
+	for _, n := range []int{10, 20, 37, 50} {
+		for at := 2; at <= 6; at++ {
+			dir := t.TempDir()
+			tree := openIntTree(t, dir, Options{Order: 3})
+			expected := map[int]int{}
+			for i := 0; i < n; i++ {
+				require.NoError(t, tree.Put(i, i))
+				expected[i] = i
+			}
+			tree.crash()
+
+			// die between the page records of the splits the next put starts
+			tree = openIntTree(t, dir, Options{Order: 3, beforeAppend: crashBefore(at, pageRecord)})
+			if err := tree.Put(n, n); err == nil {
+				expected[n] = n // fewer page records than at
+			} else {
+				require.ErrorIs(t, err, errCrash)
+			}
+			tree.crash()
+
+			tree = openIntTree(t, dir, Options{Order: 3})
+			assert.Equal(t, len(expected), tree.Len(), "%d keys, crash before page record %d", n, at)
+			assertContents(t, tree, expected)
+			assertValidTree(t, tree, false)
+			require.NoError(t, tree.Close())
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package wal
+
+import "slices"
+
+// Structure modifications (split, mergeChildren, borrowFromLeft and
+// borrowFromRight) move entries between pages without changing what the tree
+// holds. They run as nested top actions: once complete they stay even if the
+// transaction that triggered them rolls back, undoing its changes is logical
+// and finds the keys wherever they moved. Only a modification cut short by a
+// crash is rolled back, page by page.
+
+// nested is a structure modification in progress, it keeps the before image
+// of every page it touches so they can be logged once it is done
+type nested[K comparable, V any] struct {
+	t      *Tree[K, V]
+	pages  []*page[K, V]
+	before [][]byte
+}
+
+// touch must be called before a page is changed
+func (s *nested[K, V]) touch(pages ...*page[K, V]) error {
+	for _, p := range pages {
+		if slices.Contains(s.pages, p) {
+			continue
+		}
+		image, err := s.t.encodePage(p)
+		if err != nil {
+			return err
+		}
+		s.pages = append(s.pages, p)
+		s.before = append(s.before, image)
+	}
+	return nil
+}
+
+// alloc returns a new empty page, its before image is a free page
+func (s *nested[K, V]) alloc(leaf bool) (*page[K, V], error) {
+	p := &page[K, V]{id: s.t.nextPage, free: true}
+	s.t.nextPage++
+	s.t.pages[p.id] = p
+	if err := s.touch(p); err != nil {
+		return nil, err
+	}
+	p.free, p.leaf = false, leaf
+	return p, nil
+}
+
+// release frees a page that is no longer part of the tree
+func (s *nested[K, V]) release(p *page[K, V]) error {
+	if err := s.touch(p); err != nil {
+		return err
+	}
+	*p = page[K, V]{id: p.id, lsn: p.lsn, free: true}
+	return nil
+}
+
+// nestedTopAction runs fn as a nested top action of the transaction. Every
+// page fn touched is logged with its before and after images, then a dummy
+// CLR points undo to what came before the action, skipping it. A crash
+// before the dummy CLR leaves the page records for undo to roll back.
+func (t *Tree[K, V]) nestedTopAction(st *txnState, fn func(s *nested[K, V]) error) error {
+	undoNext := st.undoNext
+	s := &nested[K, V]{t: t}
+	if err := fn(s); err != nil {
+		return err
+	}
+	for i, p := range s.pages {
+		after, err := t.encodePage(p)
+		if err != nil {
+			return err
+		}
+		rec := &Record{Type: RecordPage, PageID: p.id, Value: after, OldValue: s.before[i]}
+		if err := t.appendTxn(st, rec); err != nil {
+			return err
+		}
+		t.applied(p, rec.LSN)
+	}
+	return t.appendTxn(st, &Record{Type: RecordCLR, UndoNextLSN: undoNext})
+}
+
+func (t *Tree[K, V]) maxEntries() int {
+	return t.opts.Order - 1
+}
+
+func (t *Tree[K, V]) minEntries() int {
+	return (t.opts.Order+1)/2 - 1 // ceil(m/2) children
+}
+
+// restructure runs the structure modification the leaf at the end of path
+// needs after a change, if any
+func (t *Tree[K, V]) restructure(st *txnState, path []*page[K, V], indexes []int) error {
+	leaf := path[len(path)-1]
+	switch {
+	case len(leaf.keys) > t.maxEntries():
+		return t.nestedTopAction(st, func(s *nested[K, V]) error {
+			return t.split(s, path, indexes)
+		})
+	case len(leaf.keys) < t.minEntries() && leaf.id != rootPage:
+		return t.nestedTopAction(st, func(s *nested[K, V]) error {
+			return t.rebalance(s, path, indexes)
+		})
+	}
+	return nil
+}
+
+// split brings an overflowing page back in bounds moving its upper half to a
+// new page, the separator goes up and may overflow the parent in turn
+func (t *Tree[K, V]) split(s *nested[K, V], path []*page[K, V], indexes []int) error {
+	for d := len(path) - 1; d >= 0 && len(path[d].keys) > t.maxEntries(); d-- {
+		if d == 0 {
+			return t.splitRoot(s, path[0])
+		}
+		separator, right, err := t.splitOff(s, path[d])
+		if err != nil {
+			return err
+		}
+		parent, i := path[d-1], indexes[d-1]
+		if err := s.touch(parent); err != nil {
+			return err
+		}
+		parent.keys = slices.Insert(parent.keys, i, separator)
+		parent.children = slices.Insert(parent.children, i+1, right.id)
+	}
+	return nil
+}
+
+// splitOff keeps the lower half of p in place and moves the upper half to a
+// new page, it returns the key that separates them in the parent
+func (t *Tree[K, V]) splitOff(s *nested[K, V], p *page[K, V]) (separator K, right *page[K, V], err error) {
+	if err := s.touch(p); err != nil {
+		return separator, nil, err
+	}
+	if right, err = s.alloc(p.leaf); err != nil {
+		return separator, nil, err
+	}
+	middle := len(p.keys) / 2
+	separator = p.keys[middle]
+	if p.leaf {
+		// the separator is a copy, the entry stays in the right leaf
+		right.keys = append(right.keys, p.keys[middle:]...)
+		right.values = append(right.values, p.values[middle:]...)
+		clear(p.values[middle:])
+		p.values = p.values[:middle]
+	} else {
+		right.keys = append(right.keys, p.keys[middle+1:]...)
+		right.children = append(right.children, p.children[middle+1:]...)
+		p.children = p.children[:middle+1]
+	}
+	clear(p.keys[middle:])
+	p.keys = p.keys[:middle]
+	return separator, right, nil
+}
+
+// splitRoot moves the contents of the root to a new page and splits that one,
+// the root becomes an internal page with the two halves as children
+func (t *Tree[K, V]) splitRoot(s *nested[K, V], root *page[K, V]) error {
+	if err := s.touch(root); err != nil {
+		return err
+	}
+	left, err := s.alloc(root.leaf)
+	if err != nil {
+		return err
+	}
+	left.keys, left.values, left.children = root.keys, root.values, root.children
+	separator, right, err := t.splitOff(s, left)
+	if err != nil {
+		return err
+	}
+	root.leaf = false
+	root.keys, root.values = []K{separator}, nil
+	root.children = []PageID{left.id, right.id}
+	return nil
+}
+
+// rebalance fixes an underflowing page borrowing from a sibling or merging
+// with one, a merge takes a key from the parent which may underflow in turn.
+// A root left without keys is replaced by its only child.
+func (t *Tree[K, V]) rebalance(s *nested[K, V], path []*page[K, V], indexes []int) error {
+	for d := len(path) - 1; d > 0 && len(path[d].keys) < t.minEntries(); d-- {
+		parent, i := path[d-1], indexes[d-1]
+		var err error
+		switch {
+		case i > 0 && len(t.pages[parent.children[i-1]].keys) > t.minEntries():
+			err = t.borrowFromLeft(s, parent, i)
+		case i < len(parent.children)-1 && len(t.pages[parent.children[i+1]].keys) > t.minEntries():
+			err = t.borrowFromRight(s, parent, i)
+		case i > 0:
+			err = t.mergeChildren(s, parent, i-1)
+		default:
+			err = t.mergeChildren(s, parent, i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	root := path[0]
+	if root.leaf || len(root.keys) > 0 {
+		return nil
+	}
+	child := t.pages[root.children[0]]
+	if err := s.touch(root, child); err != nil {
+		return err
+	}
+	root.leaf = child.leaf
+	root.keys, root.values, root.children = child.keys, child.values, child.children
+	return s.release(child)
+}
+
+// borrowFromLeft moves the last entry of the left sibling of child i to it
+func (t *Tree[K, V]) borrowFromLeft(s *nested[K, V], parent *page[K, V], i int) error {
+	node, left := t.pages[parent.children[i]], t.pages[parent.children[i-1]]
+	if err := s.touch(parent, node, left); err != nil {
+		return err
+	}
+	last := len(left.keys) - 1
+	if node.leaf {
+		node.keys = slices.Insert(node.keys, 0, left.keys[last])
+		node.values = slices.Insert(node.values, 0, left.values[last])
+		left.values = slices.Delete(left.values, last, last+1)
+		parent.keys[i-1] = node.keys[0]
+	} else {
+		// the separator comes down and the last key of left goes up
+		node.keys = slices.Insert(node.keys, 0, parent.keys[i-1])
+		node.children = slices.Insert(node.children, 0, left.children[last+1])
+		left.children = slices.Delete(left.children, last+1, last+2)
+		parent.keys[i-1] = left.keys[last]
+	}
+	left.keys = slices.Delete(left.keys, last, last+1)
+	return nil
+}
+
+// borrowFromRight moves the first entry of the right sibling of child i to it
+func (t *Tree[K, V]) borrowFromRight(s *nested[K, V], parent *page[K, V], i int) error {
+	node, right := t.pages[parent.children[i]], t.pages[parent.children[i+1]]
+	if err := s.touch(parent, node, right); err != nil {
+		return err
+	}
+	if node.leaf {
+		node.keys = append(node.keys, right.keys[0])
+		node.values = append(node.values, right.values[0])
+		right.values = slices.Delete(right.values, 0, 1)
+		right.keys = slices.Delete(right.keys, 0, 1)
+		parent.keys[i] = right.keys[0]
+		return nil
+	}
+	node.keys = append(node.keys, parent.keys[i])
+	node.children = append(node.children, right.children[0])
+	parent.keys[i] = right.keys[0]
+	right.keys = slices.Delete(right.keys, 0, 1)
+	right.children = slices.Delete(right.children, 0, 1)
+	return nil
+}
+
+// mergeChildren merges child i+1 of parent into child i and frees it
+func (t *Tree[K, V]) mergeChildren(s *nested[K, V], parent *page[K, V], i int) error {
+	left, right := t.pages[parent.children[i]], t.pages[parent.children[i+1]]
+	if err := s.touch(parent, left, right); err != nil {
+		return err
+	}
+	if left.leaf {
+		left.keys = append(left.keys, right.keys...)
+		left.values = append(left.values, right.values...)
+	} else {
+		left.keys = append(append(left.keys, parent.keys[i]), right.keys...)
+		left.children = append(left.children, right.children...)
+	}
+	parent.keys = slices.Delete(parent.keys, i, i+1)
+	parent.children = slices.Delete(parent.children, i+1, i+2)
+	return s.release(right)
+}
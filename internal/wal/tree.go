@@ -0,0 +1,417 @@
+package wal
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+)
+
+// Options tune a durable tree
+type Options struct {
+	// Order is the maximum number of children of a page, 32 if zero. It must
+	// be at least 3.
+	Order int
+	// CheckpointEvery is the number of log records after which a checkpoint
+	// is started in the background. Writers that get twice as far ahead of
+	// the last one take a checkpoint themselves, so recovery never replays
+	// much more than twice this. Zero disables automatic checkpoints.
+	CheckpointEvery int
+	// Sync forces every record to stable storage before the mutation returns
+	Sync bool
+
+	// beforeAppend is called with every record the tree is about to log for
+	// a transaction, an error keeps it out of the log. Tests use it to crash
+	// at a chosen point.
+	beforeAppend func(*Record) error
+}
+
+var (
+	ErrOrder    = errors.New("wal: order must be at least 3")
+	ErrNotFound = errors.New("wal: key not found")
+)
+
+// RecoveryStats describes what the last Open had to do to rebuild the tree
+type RecoveryStats struct {
+	CheckpointLSN LSN // begin LSN of the checkpoint recovery started from, 0 if none
+	Pages         int // pages read from disk
+	Replayed      int // log records redone on pages that didn't have them
+	Losers        int // transactions rolled back because they never committed
+	Compensated   int // compensation records written while rolling them back
+}
+
+// Tree is a B+tree whose changes are written to a log before being applied,
+// so its contents survive a crash. Every page carries the LSN of the last
+// change applied to it and is written to its own file when a checkpoint
+// flushes it. All the pages stay in memory, the pool never evicts.
+type Tree[K comparable, V any] struct {
+	mu   sync.RWMutex
+	log  *Log
+	dir  string
+	opts Options
+	cmp  func(K, K) int
+	kc   codec.Codec[K]
+	vc   codec.Codec[V]
+
+	pages map[PageID]*page[K, V]
+	// dirty page table: pages that changed since they were last written,
+	// with the LSN of the first such change (recLSN)
+	dirty    map[PageID]LSN
+	nextPage PageID
+	size     int
+
+	nextTxn TxnID
+	active  map[TxnID]*txnState
+	locks   map[string]TxnID // encoded key -> transaction that wrote it
+
+	// records recovery would replay if the process died now: logged since
+	// the redo LSN of the last complete checkpoint
+	sinceCheckpoint int
+	stats           RecoveryStats
+
+	// background checkpointer
+	cpMu    sync.Mutex // one checkpoint at a time
+	trigger chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	cpErr   error
+}
+
+// Open recovers the tree stored in dir, or creates an empty one
+func Open[K comparable, V any](
+	dir string,
+	cmp func(K, K) int,
+	kc codec.Codec[K],
+	vc codec.Codec[V],
+	opts Options,
+) (*Tree[K, V], error) {
+	if opts.Order == 0 {
+		opts.Order = 32
+	}
+	if opts.Order < 3 {
+		return nil, ErrOrder
+	}
+	log, err := OpenLog(dir, opts.Sync)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree[K, V]{
+		log:      log,
+		dir:      dir,
+		opts:     opts,
+		cmp:      cmp,
+		kc:       kc,
+		vc:       vc,
+		pages:    map[PageID]*page[K, V]{},
+		dirty:    map[PageID]LSN{},
+		nextPage: rootPage + 1,
+		nextTxn:  1,
+		active:   map[TxnID]*txnState{},
+		locks:    map[string]TxnID{},
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if err := t.recover(); err != nil {
+		log.Close()
+		return nil, err
+	}
+	if opts.CheckpointEvery > 0 {
+		t.wg.Add(1)
+		go t.checkpointer()
+	}
+	return t, nil
+}
+
+// page returns a page of the pool, a page that was never written starts as
+// an empty leaf
+func (t *Tree[K, V]) page(id PageID) *page[K, V] {
+	p, ok := t.pages[id]
+	if !ok {
+		p = &page[K, V]{id: id, leaf: true}
+		t.pages[id] = p
+	}
+	return p
+}
+
+// descend returns the pages from the root down to the leaf where key belongs,
+// with the index of the child taken in each internal page
+func (t *Tree[K, V]) descend(key K) (path []*page[K, V], indexes []int) {
+	p := t.page(rootPage)
+	for !p.leaf {
+		i := sort.Search(len(p.keys), func(i int) bool { return t.cmp(key, p.keys[i]) < 0 })
+		path, indexes = append(path, p), append(indexes, i)
+		p = t.page(p.children[i])
+	}
+	return append(path, p), indexes
+}
+
+// find returns the position of key in a leaf, or where it would go
+func (t *Tree[K, V]) find(leaf *page[K, V], key K) (int, bool) {
+	i := sort.Search(len(leaf.keys), func(i int) bool { return t.cmp(leaf.keys[i], key) >= 0 })
+	return i, i < len(leaf.keys) && t.cmp(leaf.keys[i], key) == 0
+}
+
+// apply redoes a logged change on its page, it is used both at runtime and
+// during recovery so both paths always agree on what a record means
+func (t *Tree[K, V]) apply(r *Record) error {
+	p := t.page(r.PageID)
+	var err error
+	switch {
+	case r.Type == RecordPage, r.Type == RecordCLR && r.Image:
+		// entries move between pages, only an image put back by undo
+		// changes how many the tree holds
+		t.size -= p.entries()
+		err = t.decodePage(p, r.Value)
+		t.size += p.entries()
+	case r.Type == RecordPut, r.Type == RecordCLR && r.HadOld:
+		err = t.applyPut(p, r.Key, r.Value)
+	case r.Type == RecordDelete, r.Type == RecordCLR:
+		err = t.applyDelete(p, r.Key)
+	}
+	if err != nil {
+		return err
+	}
+	t.applied(p, r.LSN)
+	return nil
+}
+
+// applied advances the pageLSN and adds the page to the dirty page table
+func (t *Tree[K, V]) applied(p *page[K, V], lsn LSN) {
+	p.lsn = lsn
+	if _, ok := t.dirty[p.id]; !ok {
+		t.dirty[p.id] = lsn
+	}
+}
+
+func (t *Tree[K, V]) applyPut(leaf *page[K, V], k, v []byte) error {
+	key, err := t.kc.Decode(k)
+	if err != nil {
+		return err
+	}
+	value, err := t.vc.Decode(v)
+	if err != nil {
+		return err
+	}
+	i, found := t.find(leaf, key)
+	if found {
+		leaf.values[i] = value
+		return nil
+	}
+	leaf.keys = slices.Insert(leaf.keys, i, key)
+	leaf.values = slices.Insert(leaf.values, i, value)
+	t.size++
+	return nil
+}
+
+func (t *Tree[K, V]) applyDelete(leaf *page[K, V], k []byte) error {
+	key, err := t.kc.Decode(k)
+	if err != nil {
+		return err
+	}
+	i, found := t.find(leaf, key)
+	if !found {
+		return nil // redo may run on a page that never held the key
+	}
+	leaf.keys = slices.Delete(leaf.keys, i, i+1)
+	leaf.values = slices.Delete(leaf.values, i, i+1)
+	t.size--
+	return nil
+}
+
+// Recovered reports the work done by recovery when the tree was opened
+func (t *Tree[K, V]) Recovered() RecoveryStats {
+	return t.stats
+}
+
+// Put writes a single key in its own transaction
+func (t *Tree[K, V]) Put(key K, value V) error {
+	txn := t.Begin()
+	if err := txn.Put(key, value); err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+// Delete removes a single key in its own transaction, a missing key is
+// ErrNotFound and nothing is written to the log
+func (t *Tree[K, V]) Delete(key K) error {
+	txn := t.Begin()
+	if err := txn.Delete(key); err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (t *Tree[K, V]) Get(key K) (value V, found bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	path, _ := t.descend(key)
+	leaf := path[len(path)-1]
+	if i, found := t.find(leaf, key); found {
+		return leaf.values[i], true
+	}
+	return value, false
+}
+
+// Len returns the number of keys in the tree
+func (t *Tree[K, V]) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+// logged counts a new record and wakes up the checkpointer once the interval
+// is reached, it must be called with mu held
+func (t *Tree[K, V]) logged() {
+	t.sinceCheckpoint++
+	if t.opts.CheckpointEvery > 0 && t.sinceCheckpoint >= t.opts.CheckpointEvery {
+		select {
+		case t.trigger <- struct{}{}:
+		default: // a checkpoint is already pending
+		}
+	}
+}
+
+// throttle takes a checkpoint right away, in the writer, once the log grew
+// past twice the interval because the background checkpointer fell behind.
+// It is called without mu held, after a write.
+func (t *Tree[K, V]) throttle() error {
+	if t.opts.CheckpointEvery == 0 {
+		return nil
+	}
+	behind := func() bool {
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		return t.sinceCheckpoint >= 2*t.opts.CheckpointEvery
+	}
+	if !behind() {
+		return nil
+	}
+	t.cpMu.Lock()
+	defer t.cpMu.Unlock()
+	if !behind() {
+		return nil // another writer took it meanwhile
+	}
+	return t.checkpoint()
+}
+
+func (t *Tree[K, V]) checkpointer() {
+	defer t.wg.Done()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-t.trigger:
+			if err := t.Checkpoint(); err != nil {
+				t.cpMu.Lock()
+				t.cpErr = err
+				t.cpMu.Unlock()
+			}
+		}
+	}
+}
+
+// Checkpoint takes a fuzzy checkpoint:
+//
+//  1. flush the dirty pages, a few at a time, without holding the lock
+//     while they are written so writers keep going
+//  2. under the lock, log a begin record and take the active transaction
+//     table and the dirty page table, pages dirtied during the flush
+//     included
+//  3. log the end record with both tables and point the master file at
+//     the begin record
+//  4. drop the log segments recovery will never need again: redo starts at
+//     the oldest recLSN of the dirty page table and undo may go back to the
+//     first record of the oldest running transaction
+func (t *Tree[K, V]) Checkpoint() error {
+	t.cpMu.Lock()
+	defer t.cpMu.Unlock()
+	return t.checkpoint()
+}
+
+func (t *Tree[K, V]) checkpoint() error {
+	if err := t.flushPages(); err != nil {
+		return err
+	}
+	return t.logCheckpoint()
+}
+
+func (t *Tree[K, V]) logCheckpoint() error {
+	t.mu.Lock()
+	begin, err := t.log.Append(&Record{Type: RecordBeginCheckpoint})
+	if err == nil {
+		err = t.log.Rotate()
+	}
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	data := &CheckpointData{
+		BeginLSN: begin,
+		RedoLSN:  begin,
+		NextTxn:  t.nextTxn,
+		NextPage: t.nextPage,
+		Active:   map[TxnID]LSN{},
+		Dirty:    maps.Clone(t.dirty),
+	}
+	keep := begin + 1
+	for _, recLSN := range t.dirty {
+		data.RedoLSN = min(data.RedoLSN, recLSN)
+		keep = min(keep, recLSN)
+	}
+	for id, st := range t.active {
+		if st.lastLSN == 0 {
+			continue // nothing logged yet
+		}
+		data.Active[id] = st.lastLSN
+		keep = min(keep, st.firstLSN)
+	}
+	_, err = t.log.Append(&Record{Type: RecordEndCheckpoint, Checkpoint: data})
+	if err == nil {
+		err = t.log.Sync()
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeMaster(t.dir, begin); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sinceCheckpoint = int(t.log.NextLSN() - data.RedoLSN)
+	if t.sinceCheckpoint < t.opts.CheckpointEvery {
+		select {
+		case <-t.trigger: // asked for before this one was done
+		default:
+		}
+	}
+	return t.log.TruncateBefore(keep)
+}
+
+// Close stops the background checkpointer and closes the log. It reports
+// the error of a failed background checkpoint, if any.
+func (t *Tree[K, V]) Close() error {
+	t.stop()
+	if err := t.log.Close(); err != nil {
+		return err
+	}
+	t.cpMu.Lock()
+	defer t.cpMu.Unlock()
+	return t.cpErr
+}
+
+func (t *Tree[K, V]) stop() {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	t.wg.Wait()
+}
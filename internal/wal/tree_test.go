@@ -0,0 +1,319 @@
+package wal
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/LucasUTNFRD/db-from-scratch/internal/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openIntTree(t *testing.T, dir string, opts Options) *Tree[int, int] {
+	tree, err := Open[int, int](dir, cmp.Compare[int], codec.Int{}, codec.Int{}, opts)
+	require.NoError(t, err)
+	return tree
+}
+
+// crash simulates the process dying: the background checkpointer stops and
+// the files are abandoned without a final checkpoint
+func (t *Tree[K, V]) crash() {
+	t.stop()
+	t.log.file.Close()
+}
+
+var errCrash = errors.New("crash")
+
+// crashBefore returns a beforeAppend hook that dies instead of logging the
+// n-th record matching match, nothing is logged after that
+func crashBefore(n int, match func(*Record) bool) func(*Record) error {
+	seen := 0
+	return func(r *Record) error {
+		if seen < n && match(r) {
+			seen++
+		}
+		if seen == n {
+			return errCrash
+		}
+		return nil
+	}
+}
+
+// updatesFrom counts the logged changes from lsn on, what redo has to apply
+// when no page was flushed after lsn
+func updatesFrom(t *testing.T, l *Log, lsn LSN) int {
+	n := 0
+	require.NoError(t, l.Replay(lsn, func(r *Record) error {
+		if r.isUpdate() {
+			n++
+		}
+		return nil
+	}))
+	return n
+}
+
+// assertValidTree checks the ordering of keys across pages, that every leaf
+// is at the same depth and, if full is set, that pages are within bounds
+func assertValidTree(t *testing.T, tree *Tree[int, int], full bool) {
+	leafDepth := -1
+	n := 0
+	var walk func(id PageID, depth int, lo, hi *int)
+	walk = func(id PageID, depth int, lo, hi *int) {
+		p, ok := tree.pages[id]
+		require.True(t, ok, "page %d is in the pool", id)
+		require.False(t, p.free, "page %d is reachable", id)
+		if full && id != rootPage {
+			assert.GreaterOrEqual(t, len(p.keys), tree.minEntries(), "page %d", id)
+			assert.LessOrEqual(t, len(p.keys), tree.maxEntries(), "page %d", id)
+		}
+		for i, k := range p.keys {
+			if i > 0 {
+				assert.Less(t, p.keys[i-1], k, "page %d sorted", id)
+			}
+			if lo != nil {
+				assert.GreaterOrEqual(t, k, *lo, "page %d", id)
+			}
+			if hi != nil {
+				assert.Less(t, k, *hi, "page %d", id)
+			}
+		}
+		if p.leaf {
+			if leafDepth < 0 {
+				leafDepth = depth
+			}
+			assert.Equal(t, leafDepth, depth, "leaf %d depth", id)
+			assert.Len(t, p.values, len(p.keys))
+			n += len(p.keys)
+			return
+		}
+		require.Len(t, p.children, len(p.keys)+1, "page %d", id)
+		for i, child := range p.children {
+			childLo, childHi := lo, hi
+			if i > 0 {
+				childLo = &p.keys[i-1]
+			}
+			if i < len(p.keys) {
+				childHi = &p.keys[i]
+			}
+			walk(child, depth+1, childLo, childHi)
+		}
+	}
+	walk(rootPage, 0, nil, nil)
+	assert.Equal(t, tree.Len(), n)
+}
+
+func assertContents(t *testing.T, tree *Tree[int, int], expected map[int]int) {
+	assert.Equal(t, len(expected), tree.Len())
+	for k, v := range expected {
+		got, found := tree.Get(k)
+		assert.True(t, found, "key %d", k)
+		assert.Equal(t, v, got)
+	}
+}
+
+func TestTreeRecoverWithoutCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 4})
+	expected := map[int]int{}
+	for i := 0; i < 100; i++ {
+		require.NoError(t, tree.Put(i, i*i))
+		expected[i] = i * i
+	}
+	for i := 0; i < 100; i += 3 {
+		require.NoError(t, tree.Delete(i))
+		delete(expected, i)
+	}
+	assert.ErrorIs(t, tree.Delete(0), ErrNotFound, "missing keys are not logged")
+	updates := updatesFrom(t, tree.log, 1)
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 4})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+	assert.Equal(t, RecoveryStats{Replayed: updates}, tree.Recovered())
+}
+
+func TestTreeCheckpointTruncatesLog(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 4})
+	for i := 0; i < 50; i++ {
+		require.NoError(t, tree.Put(i, i))
+	}
+	begin := tree.log.NextLSN()
+	require.NoError(t, tree.Checkpoint())
+	assert.Equal(t, begin+1, tree.log.FirstLSN(), "prefix before the checkpoint is dropped")
+	assert.Empty(t, tree.dirty)
+	pages := len(tree.pages)
+
+	require.NoError(t, tree.Put(100, 100))
+	updates := updatesFrom(t, tree.log, begin)
+	require.NoError(t, tree.Close())
+
+	tree = openIntTree(t, dir, Options{Order: 4})
+	defer tree.Close()
+	stats := tree.Recovered()
+	assert.Equal(t, begin, stats.CheckpointLSN)
+	assert.Equal(t, pages, stats.Pages)
+	assert.Equal(t, updates, stats.Replayed, "only what came after the checkpoint is redone")
+	v, found := tree.Get(100)
+	assert.True(t, found)
+	assert.Equal(t, 100, v)
+	assert.Equal(t, 51, tree.Len())
+	assertValidTree(t, tree, true)
+}
+
+func TestTreeRecoveryBoundedByCheckpointInterval(t *testing.T) {
+	const interval = 200
+	dir := t.TempDir()
+	opts := Options{Order: 8, CheckpointEvery: interval}
+	tree := openIntTree(t, dir, opts)
+
+	r := rand.New(rand.NewSource(7))
+	expected := map[int]int{}
+	for i := 0; i < 5000; i++ {
+		key := r.Intn(1000)
+		if _, ok := expected[key]; ok && r.Intn(3) == 0 {
+			require.NoError(t, tree.Delete(key))
+			delete(expected, key)
+			continue
+		}
+		require.NoError(t, tree.Put(key, i))
+		expected[key] = i
+	}
+	tree.crash()
+
+	tree = openIntTree(t, dir, opts)
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+
+	stats := tree.Recovered()
+	assert.NotZero(t, stats.CheckpointLSN)
+	// a checkpoint is triggered every interval records and writers keep going
+	// while it runs, until they are twice the interval ahead and take one
+	// themselves
+	assert.LessOrEqual(t, stats.Replayed, 2*interval)
+}
+
+func TestFuzzyCheckpointKeepsDirtyPages(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 4})
+	expected := map[int]int{}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, tree.Put(i, i))
+		expected[i] = i
+	}
+	require.NoError(t, tree.Checkpoint())
+	for i := 100; i < 110; i++ {
+		require.NoError(t, tree.Put(i, i))
+		expected[i] = i
+	}
+	dirty := maps.Clone(tree.dirty)
+	require.NotEmpty(t, dirty)
+
+	// log a checkpoint without flushing, as if every page was written by
+	// someone else since the flush
+	begin := tree.log.NextLSN()
+	require.NoError(t, tree.logCheckpoint())
+	var data *CheckpointData
+	require.NoError(t, tree.log.Replay(begin, func(r *Record) error {
+		if r.Type == RecordEndCheckpoint {
+			data = r.Checkpoint
+		}
+		return nil
+	}))
+	require.NotNil(t, data)
+	assert.Equal(t, dirty, data.Dirty)
+	assert.Less(t, data.RedoLSN, begin, "redo starts at the oldest recLSN")
+	for _, recLSN := range dirty {
+		assert.LessOrEqual(t, data.RedoLSN, recLSN)
+	}
+	assert.LessOrEqual(t, tree.log.FirstLSN(), data.RedoLSN, "what redo needs is kept")
+
+	require.NoError(t, tree.Put(200, 200))
+	expected[200] = 200
+	updates := updatesFrom(t, tree.log, data.RedoLSN)
+	tree.crash()
+
+	tree = openIntTree(t, dir, Options{Order: 4})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+	stats := tree.Recovered()
+	assert.Equal(t, begin, stats.CheckpointLSN)
+	assert.Equal(t, updates, stats.Replayed)
+}
+
+func TestCheckpointWhileWriting(t *testing.T) {
+	dir := t.TempDir()
+	tree := openIntTree(t, dir, Options{Order: 4})
+
+	const writers, keys = 4, 300
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				assert.NoError(t, tree.Put(w*keys+i, i))
+				if i%3 == 0 {
+					assert.NoError(t, tree.Delete(w*keys+i))
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	checkpoints := 0
+	for running := true; running; checkpoints++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		require.NoError(t, tree.Checkpoint())
+	}
+	assert.Greater(t, checkpoints, 1)
+	tree.crash()
+
+	expected := map[int]int{}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < keys; i++ {
+			if i%3 != 0 {
+				expected[w*keys+i] = i
+			}
+		}
+	}
+	tree = openIntTree(t, dir, Options{Order: 4})
+	defer tree.Close()
+	assertContents(t, tree, expected)
+	assertValidTree(t, tree, true)
+}
+
+func TestWritersCatchUpWithCheckpoints(t *testing.T) {
+	const interval = 50
+	dir := t.TempDir()
+	opts := Options{Order: 4, CheckpointEvery: interval}
+	tree := openIntTree(t, dir, opts)
+	// without the background checkpointer only the writers take checkpoints
+	tree.stop()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, tree.Put(i, i))
+		assert.Less(t, tree.sinceCheckpoint, 2*interval, "put %d", i)
+	}
+	assert.Greater(t, tree.log.FirstLSN(), LSN(1), "checkpoints truncated the log")
+	tree.crash()
+
+	tree = openIntTree(t, dir, opts)
+	defer tree.Close()
+	assert.Equal(t, 1000, tree.Len())
+	assert.LessOrEqual(t, tree.Recovered().Replayed, 2*interval)
+}
@@ -0,0 +1,243 @@
+package wal
+
+import "errors"
+
+var (
+	ErrConflict = errors.New("wal: key is locked by another transaction")
+	ErrTxnDone  = errors.New("wal: transaction already committed or aborted")
+)
+
+// txnState is the entry of the active transaction table
+type txnState struct {
+	id       TxnID
+	firstLSN LSN
+	lastLSN  LSN
+	// record a rollback would undo first, what a nested top action skips to
+	undoNext LSN
+	updates  []*Record // put and delete records, in the order they were written
+	keys     []string  // locked keys
+}
+
+// Txn groups mutations that must be applied all together or not at all.
+//
+// Each key written by a transaction stays locked until it commits or aborts,
+// another transaction touching it gets ErrConflict right away instead of
+// waiting. Reads are not isolated, Get sees uncommitted values.
+type Txn[K comparable, V any] struct {
+	t     *Tree[K, V]
+	state *txnState
+	done  bool
+}
+
+// Begin starts a new transaction, nothing is logged until its first write
+func (t *Tree[K, V]) Begin() *Txn[K, V] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st := &txnState{id: t.nextTxn}
+	t.nextTxn++
+	t.active[st.id] = st
+	return &Txn[K, V]{t: t, state: st}
+}
+
+func (x *Txn[K, V]) Put(key K, value V) error {
+	return x.throttled(x.write(RecordPut, key, value))
+}
+
+// Delete removes key, a missing key is ErrNotFound and nothing is logged
+func (x *Txn[K, V]) Delete(key K) error {
+	var zero V
+	return x.throttled(x.write(RecordDelete, key, zero))
+}
+
+// throttled lets the tree catch up with checkpoints once an operation
+// that succeeded released the lock
+func (x *Txn[K, V]) throttled(err error) error {
+	if err != nil {
+		return err
+	}
+	return x.t.throttle()
+}
+
+func (x *Txn[K, V]) write(typ RecordType, key K, value V) error {
+	t := x.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if x.done {
+		return ErrTxnDone
+	}
+
+	k, err := t.kc.Encode(nil, key)
+	if err != nil {
+		return err
+	}
+	if owner, locked := t.locks[string(k)]; locked && owner != x.state.id {
+		return ErrConflict
+	}
+	path, indexes := t.descend(key)
+	leaf := path[len(path)-1]
+	i, had := t.find(leaf, key)
+	if typ == RecordDelete && !had {
+		return ErrNotFound
+	}
+
+	rec := &Record{Type: typ, PageID: leaf.id, Key: k, HadOld: had}
+	if had {
+		if rec.OldValue, err = t.vc.Encode(nil, leaf.values[i]); err != nil {
+			return err
+		}
+	}
+	if typ == RecordPut {
+		if rec.Value, err = t.vc.Encode(nil, value); err != nil {
+			return err
+		}
+	}
+	if err := t.appendTxn(x.state, rec); err != nil {
+		return err
+	}
+	x.state.updates = append(x.state.updates, rec)
+	if _, locked := t.locks[string(k)]; !locked {
+		t.locks[string(k)] = x.state.id
+		x.state.keys = append(x.state.keys, string(k))
+	}
+	if err := t.apply(rec); err != nil {
+		return err
+	}
+	return t.restructure(x.state, path, indexes)
+}
+
+// Commit makes the transaction durable
+func (x *Txn[K, V]) Commit() error {
+	return x.throttled(x.commit())
+}
+
+func (x *Txn[K, V]) commit() error {
+	t := x.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if x.done {
+		return ErrTxnDone
+	}
+	x.done = true
+	defer t.release(x.state)
+
+	if x.state.lastLSN == 0 {
+		return nil // read only
+	}
+	if err := t.appendTxn(x.state, &Record{Type: RecordCommit}); err != nil {
+		return err
+	}
+	if t.opts.Sync {
+		return nil // already synced by Append
+	}
+	return t.log.Sync()
+}
+
+// Abort rolls back every change of the transaction, writing a compensation
+// record for each of them
+func (x *Txn[K, V]) Abort() error {
+	return x.throttled(x.abort())
+}
+
+func (x *Txn[K, V]) abort() error {
+	t := x.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if x.done {
+		return ErrTxnDone
+	}
+	x.done = true
+	defer t.release(x.state)
+
+	if x.state.lastLSN == 0 {
+		return nil
+	}
+	if err := t.appendTxn(x.state, &Record{Type: RecordAbort}); err != nil {
+		return err
+	}
+	for i := len(x.state.updates) - 1; i >= 0; i-- {
+		if err := t.compensate(x.state, x.state.updates[i]); err != nil {
+			return err
+		}
+	}
+	return t.appendTxn(x.state, &Record{Type: RecordEnd})
+}
+
+// appendTxn links the record into the transaction chain and logs it
+func (t *Tree[K, V]) appendTxn(st *txnState, rec *Record) error {
+	rec.TxnID = st.id
+	rec.PrevLSN = st.lastLSN
+	if t.opts.beforeAppend != nil {
+		if err := t.opts.beforeAppend(rec); err != nil {
+			return err
+		}
+	}
+	lsn, err := t.log.Append(rec)
+	if err != nil {
+		return err
+	}
+	if st.firstLSN == 0 {
+		st.firstLSN = lsn
+	}
+	st.lastLSN = lsn
+	switch rec.Type {
+	case RecordPut, RecordDelete, RecordPage:
+		st.undoNext = lsn
+	case RecordCLR:
+		st.undoNext = rec.UndoNextLSN
+	}
+	t.logged()
+	return nil
+}
+
+// compensate undoes update, logging a CLR first. The CLR points to the record
+// before update so, if we crash halfway through a rollback, recovery resumes
+// where it stopped instead of undoing the same change twice.
+//
+// Undo is logical: structure modifications may have moved the key since
+// update was logged, so the CLR goes to the leaf that holds it now.
+func (t *Tree[K, V]) compensate(st *txnState, update *Record) error {
+	key, err := t.kc.Decode(update.Key)
+	if err != nil {
+		return err
+	}
+	path, indexes := t.descend(key)
+	clr := &Record{
+		Type:        RecordCLR,
+		PageID:      path[len(path)-1].id,
+		Key:         update.Key,
+		HadOld:      update.HadOld,
+		Value:       update.OldValue,
+		UndoNextLSN: update.PrevLSN,
+	}
+	if err := t.appendTxn(st, clr); err != nil {
+		return err
+	}
+	if err := t.apply(clr); err != nil {
+		return err
+	}
+	return t.restructure(st, path, indexes)
+}
+
+// compensateImage puts back the page a structure modification cut short by a
+// crash had changed, undo is physical here since nothing else could touch
+// the page in the meantime
+func (t *Tree[K, V]) compensateImage(st *txnState, r *Record) error {
+	clr := &Record{
+		Type:        RecordCLR,
+		PageID:      r.PageID,
+		Image:       true,
+		Value:       r.OldValue,
+		UndoNextLSN: r.PrevLSN,
+	}
+	if err := t.appendTxn(st, clr); err != nil {
+		return err
+	}
+	return t.apply(clr)
+}
+
+func (t *Tree[K, V]) release(st *txnState) {
+	for _, k := range st.keys {
+		delete(t.locks, k)
+	}
+	delete(t.active, st.id)
+}